@@ -2,8 +2,13 @@ package controllers
 
 import (
 	"bytes"
+	"database/sql/driver"
 	"encoding/json"
 	"log"
+	"mime/multipart"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
 )
 
 func init() {
@@ -14,3 +19,40 @@ func parsePayload(p interface{}) *bytes.Buffer {
 	data, _ := json.Marshal(p)
 	return bytes.NewBuffer(data)
 }
+
+// filePayload builds a multipart body with the file and the form fields,
+// it returns the content type to send it with
+func filePayload(file string, fields map[string]string) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+
+	if file != "" {
+		part, _ := writer.CreateFormFile("file", "import.csv")
+		part.Write([]byte(file))
+	}
+
+	writer.Close()
+
+	return body, writer.FormDataContentType()
+}
+
+// expectExportCursor expects an export declaring its cursor for q with args
+// and getting rows, a short batch, on the first fetch
+func expectExportCursor(dbMock sqlmock.Sqlmock, q string, rows *sqlmock.Rows, args ...driver.Value) {
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DECLARE export_cursor NO SCROLL CURSOR FOR " + q).WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("FETCH FORWARD 500 FROM export_cursor").WillReturnRows(rows)
+	dbMock.ExpectRollback()
+}
+
+func currencyRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"code", "name", "minor_unit", "symbol", "created_at", "updated_at"}).
+		AddRow("IDR", "Indonesian Rupiah", 2, "Rp", time.Now(), time.Now()).
+		AddRow("USD", "US Dollar", 2, "$", time.Now(), time.Now()).
+		AddRow("JPY", "Japanese Yen", 0, "¥", time.Now(), time.Now())
+}
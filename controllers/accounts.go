@@ -0,0 +1,381 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+func (api *API) GetAccounts(c *gin.Context) {
+	u := ParsePayload(c)
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	order := c.Query("order")
+	orderBy := c.Query("order_by")
+
+	filter := models.Account{
+		UserId:   c.Query("user_id"),
+		Name:     c.Query("name"),
+		Type:     strings.ToUpper(c.Query("type")),
+		Currency: strings.ToUpper(c.Query("currency")),
+	}
+
+	if u.Role == string(models.Customer) {
+		filter.UserId = u.Id
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	if strings.ToUpper(order) != "ASC" && strings.ToUpper(order) != "DESC" {
+		order = "DESC"
+	}
+
+	mapOrderBy := map[string]string{
+		"id":              "a.id",
+		"user_id":         "a.user_id",
+		"name":            "a.name",
+		"type":            "a.type",
+		"currency":        "a.currency",
+		"opening_balance": "a.opening_balance",
+		"created_at":      "a.created_at",
+		"updated_at":      "a.updated_at",
+	}
+
+	if val, ok := mapOrderBy[orderBy]; ok {
+		orderBy = val
+	} else {
+		orderBy = "a.updated_at"
+	}
+
+	countQ := `SELECT COUNT(1) FROM accounts a
+		WHERE NOT a.deleted`
+	selectQ := `SELECT
+			a.id, a.user_id, a.name, a.type, a.currency,
+			a.opening_balance, a.created_at, a.updated_at
+		FROM accounts a
+		WHERE NOT a.deleted`
+
+	var accountList models.AccountList
+	var accounts []models.Account
+	var err error
+
+	filterQ, stms := getFilterAccount(filter)
+
+	selectQ = selectQ + filterQ
+	countQ = countQ + filterQ
+
+	offset := (page - 1) * limit
+	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
+	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+
+	log.Println(selectQ + orderVal + pagination)
+
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var account models.Account
+
+		err = rows.Scan(&account.Id, &account.UserId, &account.Name, &account.Type, &account.Currency,
+			&account.OpeningBalance, &account.CreatedAt, &account.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	accountList.Total, err = api.GetTotal(countQ, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	accountList.Accounts = accounts
+	accountList.Limit = limit
+	accountList.Page = page
+
+	c.JSON(http.StatusOK, accountList)
+}
+
+func (api *API) UpsertAccounts(c *gin.Context) {
+	u := ParsePayload(c)
+	var payload models.UpsertAccountRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	accounts := payload.Data
+	if len(accounts) == 0 {
+		sendError(c, http.StatusBadRequest, "missing-accounts")
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var errAccounts []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	customer := false
+	if u.Role == string(models.Customer) {
+		customer = true
+	}
+
+	for i, account := range accounts {
+		if customer {
+			account.UserId = u.Id
+		}
+
+		if _, err := uuid.FromString(account.Id); err != nil {
+			account.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateAccount(&account, currencies); err != nil {
+			errAccounts = append(errAccounts, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO accounts
+		(id, user_id, name, type, currency, opening_balance, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+		user_id = $2, name = $3, type = $4, currency = $5, opening_balance = $6, updated_at = CURRENT_TIMESTAMP, deleted = false
+		`, account.Id, account.UserId, account.Name, account.Type, account.Currency, account.OpeningBalance); err != nil {
+			log.Println(err)
+			errAccounts = append(errAccounts, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+	}
+
+	code := http.StatusInternalServerError
+	obj := gin.H{"message": "error", "details": errAccounts}
+
+	if len(errAccounts) == 0 {
+		if err := tx.Commit(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		code = http.StatusOK
+		obj = gin.H{"message": "success", "total": len(accounts)}
+	}
+
+	c.JSON(code, obj)
+}
+
+func (api *API) DeleteAccounts(c *gin.Context) {
+	api.BatchDeletes(c, "accounts")
+}
+
+// GetAccountsBalances computes the balance of every account from its opening
+// balance and the incomes, expenses and transfers booked on it up to date
+// (default today)
+func (api *API) GetAccountsBalances(c *gin.Context) {
+	u := ParsePayload(c)
+
+	filter := models.Account{
+		Id:       c.Query("account_id"),
+		UserId:   c.Query("user_id"),
+		Type:     strings.ToUpper(c.Query("type")),
+		Currency: strings.ToUpper(c.Query("currency")),
+	}
+
+	if u.Role == string(models.Customer) {
+		filter.UserId = u.Id
+	}
+
+	date, err := time.Parse(dateFormat, c.DefaultQuery("date", time.Now().Format(dateFormat)))
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-date(yyyy-mm-dd)")
+		return
+	}
+
+	filterQ, stms := getFilterAccount(filter)
+	dateArg := fmt.Sprintf("$%d", len(stms)+1)
+	stms = append(stms, date)
+
+	selectQ := `SELECT
+			a.id, a.user_id, a.name, a.type, a.currency, a.opening_balance,
+			COALESCE(i.total, 0), COALESCE(e.total, 0), COALESCE(tin.total, 0), COALESCE(tout.total, 0),
+			COALESCE(i.missing, 0) + COALESCE(e.missing, 0) + COALESCE(tin.missing, 0) + COALESCE(tout.missing, 0)
+		FROM accounts a` +
+		accountTotalQ("incomes", "account_id", "fx.rate", "i", dateArg) +
+		accountTotalQ("expenses", "account_id", "fx.rate", "e", dateArg) +
+		accountTotalQ("transfers", "to_account_id", "COALESCE(t.rate, fx.rate)", "tin", dateArg) +
+		accountTotalQ("transfers", "from_account_id", "fx.rate", "tout", dateArg) + `
+		WHERE NOT a.deleted` + filterQ + `
+		ORDER BY a.name`
+
+	log.Println(selectQ)
+
+	rows, err := api.Db.Query(selectQ, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	balances := []models.AccountBalance{}
+
+	for rows.Next() {
+		var balance models.AccountBalance
+
+		err = rows.Scan(&balance.AccountId, &balance.UserId, &balance.Name, &balance.Type, &balance.Currency,
+			&balance.OpeningBalance, &balance.Incomes, &balance.Expenses, &balance.TransfersIn, &balance.TransfersOut,
+			&balance.MissingRates)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		balance.Incomes = roundAmount(balance.Incomes)
+		balance.Expenses = roundAmount(balance.Expenses)
+		balance.TransfersIn = roundAmount(balance.TransfersIn)
+		balance.TransfersOut = roundAmount(balance.TransfersOut)
+		balance.Balance = roundAmount(balance.OpeningBalance + balance.Incomes - balance.Expenses +
+			balance.TransfersIn - balance.TransfersOut)
+
+		balances = append(balances, balance)
+	}
+
+	c.JSON(http.StatusOK, balances)
+}
+
+// accountTotalQ joins as alias.total the sum of the rows of table booked on
+// the account through column up to date, converted into the account currency
+// with rate, fx.rate being the one of rateJoinQ
+func accountTotalQ(table, column, rate, alias, date string) string {
+	return fmt.Sprintf(`
+		LEFT JOIN LATERAL (
+			SELECT SUM(CASE WHEN t.currency = a.currency THEN t.amount ELSE t.amount * %[3]s END) AS total,
+				COUNT(1) FILTER (WHERE t.currency <> a.currency AND %[3]s IS NULL) AS missing
+			FROM %[1]s t`+rateJoinQ("t", "a.currency")+`
+			WHERE t.%[2]s = a.id AND NOT t.deleted AND t.date <= %[5]s
+		) %[4]s ON true`, table, column, rate, alias, date)
+}
+
+// accountCurrency returns the currency of the account, sql.ErrNoRows when it
+// does not belong to userId
+func accountCurrency(tx *sql.Tx, accountId, userId string) (currency string, err error) {
+	err = tx.QueryRow("SELECT currency FROM accounts WHERE id = $1 AND user_id = $2 AND NOT deleted",
+		accountId, userId).Scan(&currency)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+
+	return
+}
+
+// accountExists tells whether the account belongs to userId
+func accountExists(tx *sql.Tx, accountId, userId string) (exists bool, err error) {
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1 AND user_id = $2 AND NOT deleted)",
+		accountId, userId).Scan(&exists)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+func getFilterAccount(filter models.Account) (filterQ string, stms []interface{}) {
+	if _, err := uuid.FromString(filter.Id); err == nil {
+		filterQ = fmt.Sprintf(" AND a.id = $%d", len(stms)+1)
+		stms = append(stms, filter.Id)
+	}
+
+	if _, err := uuid.FromString(filter.UserId); err == nil {
+		filterQ += fmt.Sprintf(" AND a.user_id = $%d", len(stms)+1)
+		stms = append(stms, filter.UserId)
+	}
+
+	if filter.Name != "" {
+		filterQ += fmt.Sprintf(" AND a.name ILIKE $%d", len(stms)+1)
+		stms = append(stms, "%"+filter.Name+"%")
+	}
+
+	if filter.Type != "" {
+		filterQ += fmt.Sprintf(" AND a.type = $%d", len(stms)+1)
+		stms = append(stms, filter.Type)
+	}
+
+	if isCurrencyCode(filter.Currency) {
+		filterQ += fmt.Sprintf(" AND a.currency = $%d", len(stms)+1)
+		stms = append(stms, filter.Currency)
+	}
+
+	return
+}
+
+func validateAccount(account *models.Account, currencies map[string]models.Currency) error {
+	account.Type = strings.ToUpper(account.Type)
+
+	if account.Name == "" {
+		return errors.New("missing-name")
+	}
+
+	if account.Type == "" {
+		return errors.New("missing-type")
+	}
+
+	if account.Currency == "" {
+		return errors.New("missing-currency")
+	}
+
+	if _, err := uuid.FromString(account.UserId); err != nil {
+		return errors.New("invalid-user-id")
+	}
+
+	switch models.AccountType(account.Type) {
+	case models.BankAccount, models.CashAccount, models.CreditCardAccount, models.EWalletAccount,
+		models.SavingsAccount, models.InvestmentAccount, models.LoanAccount, models.OtherAccount:
+	default:
+		return errors.New("invalid-type(bank|cash|credit_card|e_wallet|savings|investment|loan|other)")
+	}
+
+	// a credit card or a loan usually opens with a negative balance
+	return validateAmountCurrency(&account.Currency, account.OpeningBalance, currencies)
+}
@@ -0,0 +1,445 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetAccounts(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// err select (500)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM accounts.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// scan error (500)
+	label := []string{
+		"id", "user_id", "name", "type", "currency",
+		"opening_balance", "created_at", "updated_at",
+	}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM accounts.*").
+		WillReturnRows(sqlmock.NewRows(label[6:]).AddRow(time.Now(), time.Now()))
+
+	req, _ = http.NewRequest("GET", "?order_by=name", nil)
+	c.Request = req
+	api.GetAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 2 destination arguments in Scan, not 8", genericResp.Message)
+
+	// err count (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM accounts.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, "BCA", "BANK", "IDR", 1500000, time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-count", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM accounts.*").WithArgs(mockUserID, "%bca%", "BANK", "IDR").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, "BCA", "BANK", "IDR", 1500000, time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	q := url.Values{}
+	q.Add("name", "bca")
+	q.Add("type", "bank")
+	q.Add("currency", "idr")
+
+	req, _ = http.NewRequest("GET", "", nil)
+	req.URL.RawQuery = q.Encode()
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetAccounts(c)
+
+	var resp models.AccountList
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, int(resp.Total))
+	assert.Equal(t, 1, len(resp.Accounts))
+	assert.Equal(t, "BCA", resp.Accounts[0].Name)
+	assert.Equal(t, 1500000.0, resp.Accounts[0].OpeningBalance)
+}
+
+func TestUpsertAccounts(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+
+	// nil request (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	api.UpsertAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// bad request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.UpsertAccountRequest{})
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-accounts", genericResp.Message)
+
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertAccountRequest{Data: []models.Account{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-currencies"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-currencies", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertAccountRequest{Data: []models.Account{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// accounts validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	accounts := models.UpsertAccountRequest{Data: []models.Account{
+		{},
+		{Name: "BCA"},
+		{Name: "BCA", Type: "bank"},
+		{Name: "BCA", Type: "bank", Currency: "IDR", UserId: "err"},
+		{Name: "BCA", Type: "stocks", Currency: "IDR", UserId: mockUserID},
+		{Name: "BCA", Type: "bank", Currency: "EUR", UserId: mockUserID},
+		{Name: "Cash", Type: "cash", Currency: "jpy", OpeningBalance: 5.5, UserId: mockUserID},
+		{Id: mockID, Name: "Visa", Type: "credit_card", Currency: "usd", OpeningBalance: -250.5, UserId: mockUserID},
+	}}
+	payload = parsePayload(accounts)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO accounts.*").
+		WithArgs(mockID, mockUserID, "Visa", "CREDIT_CARD", "USD", -250.5).
+		WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	api.UpsertAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 8, len(respErrors.Details))
+	assert.Equal(t, "missing-name", respErrors.Details[0].Message)
+	assert.Equal(t, "missing-type", respErrors.Details[1].Message)
+	assert.Equal(t, "missing-currency", respErrors.Details[2].Message)
+	assert.Equal(t, "invalid-user-id", respErrors.Details[3].Message)
+	assert.Equal(t, "invalid-type(bank|cash|credit_card|e_wallet|savings|investment|loan|other)", respErrors.Details[4].Message)
+	assert.Equal(t, "unsupported-currency", respErrors.Details[5].Message)
+	assert.Equal(t, "amount-exceeds-currency-minor-unit", respErrors.Details[6].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[7].Message)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	accounts = models.UpsertAccountRequest{Data: []models.Account{
+		{Name: "BCA", Type: "bank", Currency: "IDR", OpeningBalance: 1500000},
+		{Name: "Cash", Type: "cash", Currency: "IDR"},
+	}}
+	payload = parsePayload(accounts)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO accounts.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO accounts.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO accounts.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO accounts.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload = parsePayload(accounts)
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 2, respSuccess.Total)
+}
+
+func TestDeleteAccounts(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	var genericResp GenericResponse
+
+	// err exists (500)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	payload := parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectQuery("SELECT EXISTS.*account_id.*").WillReturnError(fmt.Errorf("err-exists"))
+
+	req, _ := http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.DeleteAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-exists", genericResp.Message)
+
+	// account still used by transactions (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectQuery("SELECT EXISTS.*account_id.*").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.DeleteAccounts(c)
+
+	var rowResp models.RowResponseError
+
+	err = json.NewDecoder(w.Body).Decode(&rowResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 1, len(rowResp.Detail))
+	assert.Equal(t, "conflict-id", rowResp.Detail[0].Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectQuery("SELECT EXISTS.*account_id.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE accounts.*").WithArgs(sqlmock.AnyArg(), mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.DeleteAccounts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+}
+
+func TestGetAccountsBalances(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+
+	// invalid date (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("GET", "?date=2022-13-01", nil)
+	c.Request = req
+	api.GetAccountsBalances(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-date(yyyy-mm-dd)", genericResp.Message)
+
+	// err select (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM accounts a.*LEFT JOIN LATERAL.*").WillReturnError(errors.New("err-select"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetAccountsBalances(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// scan error (500)
+	label := []string{
+		"id", "user_id", "name", "type", "currency", "opening_balance",
+		"incomes", "expenses", "transfers_in", "transfers_out", "missing_rates",
+	}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM accounts a.*").
+		WillReturnRows(sqlmock.NewRows(label[8:]).AddRow(0, 0, 0))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetAccountsBalances(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 11", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	date := time.Date(2022, 3, 31, 0, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery("SELECT.*FROM accounts a.*").WithArgs(mockUserID, "BANK", date).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, "BCA", "BANK", "IDR", 1500000, 15000000, 3500000.004, 7123000.5, 2000000, 0).
+			AddRow(mockID2, mockUserID, "Payoneer", "BANK", "USD", 0, 500, 35.5, 0, 480, 1))
+
+	q := url.Values{}
+	q.Add("type", "bank")
+	q.Add("date", "2022-03-31")
+
+	req, _ = http.NewRequest("GET", "", nil)
+	req.URL.RawQuery = q.Encode()
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetAccountsBalances(c)
+
+	var resp []models.AccountBalance
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, len(resp))
+	assert.Equal(t, 3500000.0, resp[0].Expenses)
+	assert.Equal(t, 7123000.5, resp[0].TransfersIn)
+	assert.Equal(t, 18123000.5, resp[0].Balance)
+	assert.Equal(t, -15.5, resp[1].Balance)
+	assert.Equal(t, 1, resp[1].MissingRates)
+}
@@ -1,10 +1,10 @@
 package controllers
 
 import (
+	"budgetingapi/middlewares"
 	"budgetingapi/models"
+	"budgetingapi/tokens"
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
@@ -37,13 +37,13 @@ func (api *API) Authenticate(c *gin.Context) {
 
 	var authResponse models.AuthResponse
 
-	var correct bool
+	var correct, twoFactor bool
 	err := api.Db.QueryRow(`
-		SELECT id, email, name, role, created_at, updated_at, password = crypt($2, password)
+		SELECT id, email, name, role, created_at, updated_at, password = crypt($2, password), totp_enabled
 		FROM users
 		WHERE email = $1
 	`, authRequest.Email, authRequest.Password).Scan(&authResponse.User.Id, &authResponse.User.Email, &authResponse.User.Name, &authResponse.User.Role,
-		&authResponse.User.CreatedAt, &authResponse.User.UpdatedAt, &correct)
+		&authResponse.User.CreatedAt, &authResponse.User.UpdatedAt, &correct, &twoFactor)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -61,46 +61,90 @@ func (api *API) Authenticate(c *gin.Context) {
 		return
 	}
 
-	sessPayload, _ := api.Redis.Get(context.Background(), "auth:"+authRequest.Email).Result()
-	if sessPayload != "" {
-		log.Println("removing old session..")
-		api.Redis.Del(context.Background(), sessPayload)
+	// the session waits for the second factor
+	if twoFactor {
+		api.challengeTwoFactor(c, authResponse.User)
+		return
 	}
 
-	authResponse.Token, err = api.GenerateToken(authResponse)
+	api.startSession(c, authResponse)
+}
+
+// startSession logs the user in once all the factors are checked
+func (api *API) startSession(c *gin.Context, authResponse models.AuthResponse) {
+	var err error
+
+	// each login is a session of its own, the other devices stay logged in
+	session := newSession(c)
+
+	authResponse.Token, err = api.GenerateToken(authResponse, &session)
 	if err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	authResponse.RefreshToken = session.RefreshToken
+
+	// for the web app keeping the token in a cookie
+	if err := middlewares.SetCSRFCookie(c); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	c.JSON(http.StatusOK, authResponse)
 }
 
 func (api *API) CheckSession(c *gin.Context) {
 	u := ParsePayload(c)
 
-	err := api.Redis.Get(context.Background(), "auth:"+u.Email).Err()
+	exists, err := api.Redis.Exists(context.Background(), sessionKey(u.SessionId)).Result()
 	if err != nil {
-		if err == redis.Nil {
-			sendError(c, http.StatusUnauthorized, "unauthorized")
-			return
-		}
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if exists == 0 {
+		sendError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
 	c.JSON(http.StatusOK, genericOK)
 }
 
+// usedRefreshKey remembers a rotated refresh token for as long as it would
+// have lived, presenting it again means it leaked
+func usedRefreshKey(refreshToken string) string {
+	return "refresh-used:" + refreshToken
+}
+
+// RefreshSession trades a refresh token for a new pair of tokens, the refresh
+// token is single use. Reusing one revokes its session, every token that came
+// from the same login with it.
 func (api *API) RefreshSession(c *gin.Context) {
-	u := ParsePayload(c)
+	var refreshRequest models.RefreshRequest
+	if err := c.ShouldBindJSON(&refreshRequest); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	refreshPayload, err := api.Redis.Get(context.Background(), u.RefreshToken).Result()
+	if refreshRequest.RefreshToken == "" {
+		sendError(c, http.StatusBadRequest, "missing-refresh-token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	refreshToken := refreshRequest.RefreshToken
+
+	refreshPayload, err := api.Redis.Get(ctx, tokens.RefreshKey(refreshToken)).Result()
 	if err != nil {
 		if err == redis.Nil {
-			sendError(c, http.StatusUnauthorized, "unauthorized")
+			api.refreshTokenReused(c, refreshToken)
 			return
 		}
 		log.Println(err)
@@ -108,17 +152,36 @@ func (api *API) RefreshSession(c *gin.Context) {
 		return
 	}
 
-	var authResponse models.AuthResponse
+	// deleting it claims the token, a concurrent refresh with it gets nothing
+	deleted, err := api.Redis.Del(ctx, tokens.RefreshKey(refreshToken)).Result()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if deleted == 0 {
+		api.refreshTokenReused(c, refreshToken)
+		return
+	}
+
+	err = api.Redis.Set(ctx, usedRefreshKey(refreshToken), refreshPayload, refreshTokenTTL).Err()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	if err := json.Unmarshal([]byte(refreshPayload), &authResponse); err != nil {
+	var u models.RedisPayload
+	if err := json.Unmarshal([]byte(refreshPayload), &u); err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = api.Redis.Get(context.Background(), "auth:"+u.Email).Err()
+	session, err := api.getSession(u.SessionId)
 	if err != nil {
-		if err == redis.Nil {
+		if err == errSessionNotFound {
 			sendError(c, http.StatusUnauthorized, "unauthorized")
 			return
 		}
@@ -127,36 +190,79 @@ func (api *API) RefreshSession(c *gin.Context) {
 		return
 	}
 
-	authResponse.Token, err = api.GenerateToken(authResponse)
+	authResponse := models.AuthResponse{User: u.User}
+
+	authResponse.Token, err = api.GenerateToken(authResponse, &session)
 	if err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	authResponse.RefreshToken = session.RefreshToken
+
+	// the csrf cookie is renewed along with the refresh token
+	if err := middlewares.SetCSRFCookie(c); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	c.JSON(http.StatusOK, authResponse)
 }
 
+// refreshTokenReused answers a refresh token that is not valid, one that was
+// already rotated takes its whole session down
+func (api *API) refreshTokenReused(c *gin.Context, refreshToken string) {
+	refreshPayload, err := api.Redis.Get(context.Background(), usedRefreshKey(refreshToken)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			sendError(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var u models.RedisPayload
+	if err := json.Unmarshal([]byte(refreshPayload), &u); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Println("refresh token reused, revoking session", u.SessionId)
+
+	if err := api.revokeSession(u.Id, u.SessionId); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sendError(c, http.StatusUnauthorized, "refresh-token-reused")
+}
+
 func (api *API) Logout(c *gin.Context) {
 	u := ParsePayload(c)
-	token, _ := c.Cookie("token")
-	tokenString := strings.Replace(token, "Bearer ", "", -1)
+	// the header or cookie token auth went with
+	tokenString := strings.Replace(c.GetString("token"), "Bearer ", "", -1)
 
-	err := api.Redis.Del(context.Background(), tokenString).Err()
+	err := api.Redis.Del(context.Background(), tokens.AccessKey(tokenString)).Err()
 	if err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = api.Redis.Del(context.Background(), u.RefreshToken).Err()
+	err = api.Redis.Del(context.Background(), tokens.RefreshKey(u.RefreshToken)).Err()
 	if err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = api.Redis.Del(context.Background(), "auth:"+u.Email).Err()
+	err = api.revokeSession(u.Id, u.SessionId)
 	if err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
@@ -325,58 +431,125 @@ func (api *API) CheckResetToken(c *gin.Context) (userId string, err error) {
 	return
 }
 
-func (api *API) GenerateToken(resp models.AuthResponse) (string, error) {
+// GenerateToken signs new tokens for the session and stores them, replacing
+// the ones the session had
+func (api *API) GenerateToken(resp models.AuthResponse, session *models.Session) (string, error) {
+	var tokenString, refreshToken, redisPayload string
+	var err error
+
+	if tokens.Stateless() {
+		tokenString, refreshToken, redisPayload, err = statelessTokens(resp, session)
+	} else {
+		tokenString, refreshToken, redisPayload, err = sessionTokens(resp, session)
+	}
 
-	key, err := base64.StdEncoding.DecodeString(os.Getenv("SESSION_KEY"))
 	if err != nil {
 		log.Println(err)
 		return "", err
 	}
-	mac := hmac.New(sha256.New, key)
-	mac.Write([]byte(resp.Id))
-	mac.Write(key)
 
-	sum := mac.Sum(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if old := tokenKeys(session.Token, session.RefreshToken); len(old) > 0 {
+		if err = api.Redis.Del(ctx, old...).Err(); err != nil {
+			log.Println(err)
+			return "", err
+		}
+	}
+
+	// the stateless access tokens are not stored
+	if !tokens.Stateless() {
+		err = api.Redis.Set(ctx, tokens.AccessKey(tokenString), redisPayload, accessTokenTTL).Err()
+		if err != nil {
+			log.Println(err)
+			return "", err
+		}
+	}
+
+	err = api.Redis.Set(ctx, tokens.RefreshKey(refreshToken), redisPayload, refreshTokenTTL).Err()
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	session.Token, session.RefreshToken = tokenString, refreshToken
+	session.LastSeen = time.Now().UTC()
+
+	if err = api.saveSession(ctx, resp.Id, *session); err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	auth := fmt.Sprintf("Bearer %s", tokenString)
+
+	return auth, nil
+}
+
+// sessionTokens signs the tokens with SESSION_KEY, redis holds what they
+// stand for
+func sessionTokens(resp models.AuthResponse, session *models.Session) (tokenString, refreshToken, redisPayload string, err error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("SESSION_KEY"))
+	if err != nil {
+		return
+	}
 
-	sEnc := base64.StdEncoding.EncodeToString(sum)
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 	claims["user-id"] = resp.Id
-	claims["session-id"] = sEnc
-	claims["expires"] = 1800
-	refreshToken, err := token.SignedString(key)
+	claims["session-id"] = session.Id
+	claims["issued-at"] = time.Now().UnixNano()
+	claims["expires"] = int(refreshTokenTTL.Seconds())
+	refreshToken, err = token.SignedString(key)
 	if err != nil {
-		log.Println(err)
-		return "", err
+		return
 	}
+	claims["expires"] = int(accessTokenTTL.Seconds())
 	claims["refresh-token"] = refreshToken
 	claims["user"] = resp.User
 
-	redisPayload, _ := json.Marshal(claims)
-	tokenString, err := token.SignedString(key)
+	payload, _ := json.Marshal(claims)
+	tokenString, err = token.SignedString(key)
+
+	return tokenString, refreshToken, string(payload), err
+}
+
+// statelessTokens signs the access token with the keyring, it carries the
+// user so that no lookup is needed. The refresh token is an opaque one
+// stored in redis, the client can read the access token.
+func statelessTokens(resp models.AuthResponse, session *models.Session) (tokenString, refreshToken, redisPayload string, err error) {
+	ring, err := tokens.LoadKeyring()
 	if err != nil {
-		log.Println(err)
-		return "", err
+		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
-	data := map[string]string{
-		tokenString:          string(redisPayload),
-		refreshToken:         string(redisPayload),
-		"auth:" + resp.Email: tokenString,
+	tokenString, err = ring.Sign(jwt.MapClaims{
+		"sub":  resp.Id,
+		"sid":  session.Id,
+		"user": resp.User,
+	}, accessTokenTTL)
+	if err != nil {
+		return
 	}
 
-	for k, v := range data {
-		err = api.Redis.Set(ctx, k, v, 30*time.Minute).Err()
-		if err != nil {
-			log.Println(err)
-			return "", err
-		}
+	refreshToken = tokenGenerator()
+
+	payload, _ := json.Marshal(models.RedisPayload{User: resp.User, RefreshToken: refreshToken, SessionId: session.Id})
+
+	return tokenString, refreshToken, string(payload), nil
+}
 
+// tokenKeys are the redis keys of the tokens of a session, a new session has
+// no tokens yet
+func tokenKeys(token, refreshToken string) []string {
+	var keys []string
+	if token != "" {
+		keys = append(keys, tokens.AccessKey(token))
 	}
 
-	auth := fmt.Sprintf("Bearer %s", tokenString)
+	if refreshToken != "" {
+		keys = append(keys, tokens.RefreshKey(refreshToken))
+	}
 
-	return auth, nil
+	return keys
 }
@@ -2,11 +2,14 @@ package controllers
 
 import (
 	"budgetingapi/models"
+	"budgetingapi/tokens"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -80,7 +83,7 @@ func TestAuthenticate(t *testing.T) {
 	})
 
 	dbMock.ExpectQuery("SELECT id.*").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct"}))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct", "totp_enabled"}))
 
 	req, _ = http.NewRequest("POST", "", payload)
 	c.Request = req
@@ -102,8 +105,8 @@ func TestAuthenticate(t *testing.T) {
 	payload = parsePayload(reqAuth)
 
 	dbMock.ExpectQuery("SELECT id.*").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct"}).
-			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), false))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct", "totp_enabled"}).
+			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), false, false))
 
 	req, _ = http.NewRequest("POST", "", payload)
 	c.Request = req
@@ -123,11 +126,10 @@ func TestAuthenticate(t *testing.T) {
 	payload = parsePayload(reqAuth)
 
 	dbMock.ExpectQuery("SELECT id.*").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct"}).
-			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), true))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct", "totp_enabled"}).
+			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), true, false))
 
-	redisMock.ExpectGet("auth:" + reqAuth.Email).SetVal("test")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetErr(errors.New("err-set"))
+	redisMock.Regexp().ExpectSet("^access:.*[.]", "[.]", accessTokenTTL).SetErr(errors.New("err-set"))
 
 	req, _ = http.NewRequest("POST", "", payload)
 	c.Request = req
@@ -138,6 +140,54 @@ func TestAuthenticate(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "err-set", genericResp.Message)
 
+	// two-factor enabled, a challenge instead of a session (200)
+	redisDB, redisMock = redismock.NewClientMock()
+	api.Redis = redisDB
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(reqAuth)
+
+	dbMock.ExpectQuery("SELECT id.*totp_enabled").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct", "totp_enabled"}).
+			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), true, true))
+
+	redisMock.ExpectGet("2fa-attempts:" + mockUUID).RedisNil()
+	redisMock.Regexp().ExpectSet("^2fa-challenge:[0-9a-f]{64}$", mockUUID, challengeTTL).SetVal("OK")
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.Authenticate(c)
+
+	var challenge models.TwoFactorChallenge
+
+	err = json.NewDecoder(w.Body).Decode(&challenge)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 64, len(challenge.ChallengeToken))
+	assert.Equal(t, 300, challenge.ExpiresIn)
+
+	// locked out of two-factor, no new challenge for more tries (429)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(reqAuth)
+
+	dbMock.ExpectQuery("SELECT id.*totp_enabled").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct", "totp_enabled"}).
+			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), true, true))
+
+	redisMock.ExpectGet("2fa-attempts:" + mockUUID).SetVal("5")
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.Authenticate(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "too-many-attempts", genericResp.Message)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+
 	// (200)
 	redisDB, redisMock = redismock.NewClientMock()
 	api.Redis = redisDB
@@ -147,13 +197,11 @@ func TestAuthenticate(t *testing.T) {
 	payload = parsePayload(reqAuth)
 
 	dbMock.ExpectQuery("SELECT id.*").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct"}).
-			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), true))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct", "totp_enabled"}).
+			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), true, false))
 
-	redisMock.ExpectGet("auth:" + reqAuth.Email).SetVal("test")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetVal("OK")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetVal("OK")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetVal("OK")
+	// a new session, the previous ones are kept
+	expectSaveSession(redisMock, mockUUID, "[0-9a-f-]{36}")
 
 	req, _ = http.NewRequest("POST", "", payload)
 	c.Request = req
@@ -166,6 +214,75 @@ func TestAuthenticate(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, reqAuth.Email, respOK.Email)
 	assert.Equal(t, "test", respOK.Name)
+	assert.Equal(t, true, respOK.RefreshToken != "")
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+
+	// stateless (200), only the refresh token is stored
+	os.Setenv("AUTH_MODE", "stateless")
+	os.Setenv("JWT_KEYS", "k1:HS256:"+base64.StdEncoding.EncodeToString([]byte("secret")))
+	defer os.Unsetenv("AUTH_MODE")
+	defer os.Unsetenv("JWT_KEYS")
+
+	redisDB, redisMock = redismock.NewClientMock()
+	api.Redis = redisDB
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(reqAuth)
+
+	dbMock.ExpectQuery("SELECT id.*").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "role", "created_at", "updated_at", "is_correct", "totp_enabled"}).
+			AddRow(mockUUID, "test@gmail.com", "test", models.Admin, time.Now(), time.Now(), true, false))
+
+	// the refresh token is an opaque one
+	redisMock.Regexp().ExpectSet("^refresh:[0-9a-f]{64}$", "[.]", refreshTokenTTL).SetVal("OK")
+	redisMock.Regexp().ExpectHSet("^session:[0-9a-f-]{36}$", map[string]interface{}{
+		"token":         "[.]",
+		"refresh_token": "^[0-9a-f]{64}$",
+		"user_agent":    "",
+		"ip":            "",
+		"created_at":    "^20",
+		"last_seen":     "^20",
+	}).SetVal(6)
+	redisMock.Regexp().ExpectExpire("^session:[0-9a-f-]{36}$", sessionTTL).SetVal(true)
+	redisMock.Regexp().ExpectSAdd("sessions:"+mockUUID, "^[0-9a-f-]{36}$").SetVal(1)
+	redisMock.ExpectExpire("sessions:"+mockUUID, sessionTTL).SetVal(true)
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.Authenticate(c)
+
+	respOK = models.AuthResponse{}
+	err = json.NewDecoder(w.Body).Decode(&respOK)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+
+	// the access token verifies against the keyring
+	ring, err := tokens.LoadKeyring()
+	assert.Equal(t, nil, err)
+
+	claims, err := ring.Verify(strings.TrimPrefix(respOK.Token, "Bearer "))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, mockUUID, claims["sub"])
+}
+
+// expectSaveSession expects the tokens of a session to be stored along with
+// the session itself
+func expectSaveSession(redisMock redismock.ClientMock, userId, sessionId string) {
+	redisMock.Regexp().ExpectSet("^access:.*[.]", "[.]", accessTokenTTL).SetVal("OK")
+	redisMock.Regexp().ExpectSet("^refresh:.*[.]", "[.]", refreshTokenTTL).SetVal("OK")
+	redisMock.Regexp().ExpectHSet("^session:"+sessionId+"$", map[string]interface{}{
+		"token":         "[.]",
+		"refresh_token": "[.]",
+		"user_agent":    "",
+		"ip":            "",
+		"created_at":    "^20",
+		"last_seen":     "^20",
+	}).SetVal(6)
+	redisMock.Regexp().ExpectExpire("^session:"+sessionId+"$", sessionTTL).SetVal(true)
+	redisMock.Regexp().ExpectSAdd("sessions:"+userId, "^"+sessionId+"$").SetVal(1)
+	redisMock.ExpectExpire("sessions:"+userId, sessionTTL).SetVal(true)
 }
 
 func TestCheckSession(t *testing.T) {
@@ -174,16 +291,18 @@ func TestCheckSession(t *testing.T) {
 	redisDB, redisMock := redismock.NewClientMock()
 	api.Redis = redisDB
 
+	payload := "{\"session-id\":\"test-session\",\"user\":{\"email\":\"test@gmail.com\"}}"
+
 	// err redis (500)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	var genericResp GenericResponse
 
-	redisMock.ExpectGet("auth:test@gmail.com").SetErr(errors.New("err-redis"))
+	redisMock.ExpectExists("session:test-session").SetErr(errors.New("err-redis"))
 
 	req, _ := http.NewRequest("POST", "", nil)
 	c.Request = req
-	c.Request.Header.Set("payload", "{\"user\":{\"email\":\"test@gmail.com\"}}")
+	c.Request.Header.Set("payload", payload)
 	api.CheckSession(c)
 
 	err := json.NewDecoder(w.Body).Decode(&genericResp)
@@ -195,11 +314,11 @@ func TestCheckSession(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	redisMock.ExpectGet("auth:test@gmail.com").SetErr(redis.Nil)
+	redisMock.ExpectExists("session:test-session").SetVal(0)
 
 	req, _ = http.NewRequest("POST", "", nil)
 	c.Request = req
-	c.Request.Header.Set("payload", "{\"user\":{\"email\":\"test@gmail.com\"}}")
+	c.Request.Header.Set("payload", payload)
 	api.CheckSession(c)
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
@@ -211,11 +330,11 @@ func TestCheckSession(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	redisMock.ExpectGet("auth:test@gmail.com").SetVal("OK")
+	redisMock.ExpectExists("session:test-session").SetVal(1)
 
 	req, _ = http.NewRequest("POST", "", nil)
 	c.Request = req
-	c.Request.Header.Set("payload", "{\"user\":{\"email\":\"test@gmail.com\"}}")
+	c.Request.Header.Set("payload", payload)
 	api.CheckSession(c)
 
 	genericRespOk := struct {
@@ -234,86 +353,100 @@ func TestRefreshSession(t *testing.T) {
 	redisDB, redisMock := redismock.NewClientMock()
 	api.Redis = redisDB
 
-	// err redis refresh token (500)
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
 	var genericResp GenericResponse
 
-	redisMock.ExpectGet("test-refresh").SetErr(errors.New("err-redis"))
+	refreshPayload := "{\"refresh-token\":\"test-refresh\",\"session-id\":\"test-session\",\"user\":{\"id\":\"test-user\",\"email\":\"test@gmail.com\"}}"
+	session := map[string]string{"token": "old-token", "refresh_token": "test-refresh", "user_agent": "curl/7.68.0",
+		"ip": "10.0.0.1", "created_at": "2021-01-01T00:00:00Z", "last_seen": "2021-01-01T00:10:00Z"}
 
-	req, _ := http.NewRequest("POST", "", nil)
-	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
-	api.RefreshSession(c)
+	refresh := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		req, _ := http.NewRequest("POST", "", strings.NewReader(body))
+		c.Request = req
+		api.RefreshSession(c)
+
+		return w
+	}
+
+	// missing refresh token (400)
+	w := refresh("{}")
 
 	err := json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-refresh-token", genericResp.Message)
+
+	// err redis refresh token (500)
+	redisMock.ExpectGet("refresh:test-refresh").SetErr(errors.New("err-redis"))
+
+	w = refresh("{\"refresh_token\":\"test-refresh\"}")
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "err-redis", genericResp.Message)
 
-	// unauthorized refresh token (401)
-	w = httptest.NewRecorder()
-	c, _ = gin.CreateTestContext(w)
+	// unknown refresh token (401)
+	redisMock.ExpectGet("refresh:test-refresh").SetErr(redis.Nil)
+	redisMock.ExpectGet("refresh-used:test-refresh").SetErr(redis.Nil)
 
-	redisMock.ExpectGet("test-refresh").SetErr(redis.Nil)
-
-	req, _ = http.NewRequest("POST", "", nil)
-	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
-	api.RefreshSession(c)
+	w = refresh("{\"refresh_token\":\"test-refresh\"}")
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 	assert.Equal(t, "unauthorized", genericResp.Message)
 
-	// invalid refresh payload (500)
-	w = httptest.NewRecorder()
-	c, _ = gin.CreateTestContext(w)
-
-	redisMock.ExpectGet("test-refresh").SetVal("")
+	// an access token is not a refresh token (401)
+	redisMock.ExpectGet("refresh:old-token").SetErr(redis.Nil)
+	redisMock.ExpectGet("refresh-used:old-token").SetErr(redis.Nil)
 
-	req, _ = http.NewRequest("POST", "", nil)
-	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
-	api.RefreshSession(c)
+	w = refresh("{\"refresh_token\":\"old-token\"}")
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "unexpected end of JSON input", genericResp.Message)
-
-	// err redis auth (500)
-	authResponseByte, _ := json.Marshal(models.AuthResponse{
-		Token: "test-token", User: models.User{Email: "test@gmail.com"},
-	})
-	w = httptest.NewRecorder()
-	c, _ = gin.CreateTestContext(w)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "unauthorized", genericResp.Message)
 
-	redisMock.ExpectGet("test-refresh").SetVal(string(authResponseByte))
-	redisMock.ExpectGet("auth:test@gmail.com").SetErr(errors.New("err-redis-auth"))
+	// reused refresh token, its session is revoked (401)
+	redisMock.ExpectGet("refresh:test-refresh").SetErr(redis.Nil)
+	redisMock.ExpectGet("refresh-used:test-refresh").SetVal(refreshPayload)
+	redisMock.ExpectHGetAll("session:test-session").SetVal(map[string]string{"token": "new-token", "refresh_token": "new-refresh"})
+	redisMock.ExpectDel("session:test-session", "access:new-token", "refresh:new-refresh").SetVal(3)
+	redisMock.ExpectSRem("sessions:test-user", "test-session").SetVal(1)
 
-	req, _ = http.NewRequest("POST", "", nil)
-	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
-	api.RefreshSession(c)
+	w = refresh("{\"refresh_token\":\"test-refresh\"}")
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "err-redis-auth", genericResp.Message)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "refresh-token-reused", genericResp.Message)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
 
-	// unauthorized redis auth (401)
-	w = httptest.NewRecorder()
-	c, _ = gin.CreateTestContext(w)
+	// refresh token claimed by a concurrent refresh, counts as reused (401)
+	redisMock.ExpectGet("refresh:test-refresh").SetVal(refreshPayload)
+	redisMock.ExpectDel("refresh:test-refresh").SetVal(0)
+	redisMock.ExpectGet("refresh-used:test-refresh").SetVal(refreshPayload)
+	redisMock.ExpectHGetAll("session:test-session").SetVal(map[string]string{})
+	redisMock.ExpectDel("session:test-session").SetVal(0)
+	redisMock.ExpectSRem("sessions:test-user", "test-session").SetVal(0)
 
-	redisMock.ExpectGet("test-refresh").SetVal(string(authResponseByte))
-	redisMock.ExpectGet("auth:test@gmail.com").SetErr(redis.Nil)
+	w = refresh("{\"refresh_token\":\"test-refresh\"}")
 
-	req, _ = http.NewRequest("POST", "", nil)
-	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
-	api.RefreshSession(c)
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "refresh-token-reused", genericResp.Message)
+
+	// session revoked (401)
+	redisMock.ExpectGet("refresh:test-refresh").SetVal(refreshPayload)
+	redisMock.ExpectDel("refresh:test-refresh").SetVal(1)
+	redisMock.ExpectSet("refresh-used:test-refresh", refreshPayload, refreshTokenTTL).SetVal("OK")
+	redisMock.ExpectHGetAll("session:test-session").SetVal(map[string]string{})
+
+	w = refresh("{\"refresh_token\":\"test-refresh\"}")
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
@@ -321,37 +454,29 @@ func TestRefreshSession(t *testing.T) {
 	assert.Equal(t, "unauthorized", genericResp.Message)
 
 	// err generate token (500)
-	w = httptest.NewRecorder()
-	c, _ = gin.CreateTestContext(w)
+	redisMock.ExpectGet("refresh:test-refresh").SetVal(refreshPayload)
+	redisMock.ExpectDel("refresh:test-refresh").SetVal(1)
+	redisMock.ExpectSet("refresh-used:test-refresh", refreshPayload, refreshTokenTTL).SetVal("OK")
+	redisMock.ExpectHGetAll("session:test-session").SetVal(session)
+	redisMock.ExpectDel("access:old-token", "refresh:test-refresh").SetVal(1)
+	redisMock.Regexp().ExpectSet("^access:.*[.]", "[.]", accessTokenTTL).SetErr(errors.New("err-set-generate-token"))
 
-	redisMock.ExpectGet("test-refresh").SetVal(string(authResponseByte))
-	redisMock.ExpectGet("auth:test@gmail.com").SetVal("")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetErr(errors.New("err-set-generate-token"))
-
-	req, _ = http.NewRequest("POST", "", nil)
-	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
-	api.RefreshSession(c)
+	w = refresh("{\"refresh_token\":\"test-refresh\"}")
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "err-set-generate-token", genericResp.Message)
 
-	// 200
-	w = httptest.NewRecorder()
-	c, _ = gin.CreateTestContext(w)
+	// 200, the tokens of the session are replaced
+	redisMock.ExpectGet("refresh:test-refresh").SetVal(refreshPayload)
+	redisMock.ExpectDel("refresh:test-refresh").SetVal(1)
+	redisMock.ExpectSet("refresh-used:test-refresh", refreshPayload, refreshTokenTTL).SetVal("OK")
+	redisMock.ExpectHGetAll("session:test-session").SetVal(session)
+	redisMock.ExpectDel("access:old-token", "refresh:test-refresh").SetVal(1)
+	expectSaveSession(redisMock, "test-user", "test-session")
 
-	redisMock.ExpectGet("test-refresh").SetVal(string(authResponseByte))
-	redisMock.ExpectGet("auth:test@gmail.com").SetVal("")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetVal("OK")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetVal("OK")
-	redisMock.Regexp().ExpectSet("[.]", "[.]", 30*time.Minute).SetVal("OK")
-
-	req, _ = http.NewRequest("POST", "", nil)
-	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
-	api.RefreshSession(c)
+	w = refresh("{\"refresh_token\":\"test-refresh\"}")
 
 	var respOk models.AuthResponse
 
@@ -359,6 +484,10 @@ func TestRefreshSession(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "test@gmail.com", respOk.User.Email)
+	assert.Equal(t, true, strings.HasPrefix(respOk.Token, "Bearer "))
+	assert.Equal(t, true, respOk.RefreshToken != "" && respOk.RefreshToken != "test-refresh")
+	assert.Equal(t, true, strings.Contains(w.Header().Get("Set-Cookie"), "Max-Age=604800"))
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
 }
 
 func TestLogout(t *testing.T) {
@@ -367,16 +496,19 @@ func TestLogout(t *testing.T) {
 	redisDB, redisMock := redismock.NewClientMock()
 	api.Redis = redisDB
 
+	payload := "{\"refresh-token\":\"test-refresh\",\"session-id\":\"test-session\",\"user\":{\"id\":\"test-user\",\"email\":\"test@gmail.com\"}}"
+	session := map[string]string{"token": "test-token", "refresh_token": "test-refresh"}
+
 	// err redis token string (500)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	var genericResp GenericResponse
 
-	redisMock.ExpectDel("").SetErr(errors.New("err-redis-token-string"))
+	redisMock.ExpectDel("access:").SetErr(errors.New("err-redis-token-string"))
 
 	req, _ := http.NewRequest("POST", "", nil)
 	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
+	c.Request.Header.Set("payload", payload)
 	api.Logout(c)
 
 	err := json.NewDecoder(w.Body).Decode(&genericResp)
@@ -388,12 +520,12 @@ func TestLogout(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	redisMock.ExpectDel("").SetVal(1)
-	redisMock.ExpectDel("test-refresh").SetErr(errors.New("err-redis-refresh-token"))
+	redisMock.ExpectDel("access:").SetVal(1)
+	redisMock.ExpectDel("refresh:test-refresh").SetErr(errors.New("err-redis-refresh-token"))
 
 	req, _ = http.NewRequest("POST", "", nil)
 	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
+	c.Request.Header.Set("payload", payload)
 	api.Logout(c)
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
@@ -401,35 +533,38 @@ func TestLogout(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "err-redis-refresh-token", genericResp.Message)
 
-	// err redis auth email (500)
+	// err redis session (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	redisMock.ExpectDel("").SetVal(1)
-	redisMock.ExpectDel("test-refresh").SetVal(1)
-	redisMock.ExpectDel("auth:test@gmail.com").SetErr(errors.New("err-redis-auth-email"))
+	redisMock.ExpectDel("access:").SetVal(1)
+	redisMock.ExpectDel("refresh:test-refresh").SetVal(1)
+	redisMock.ExpectHGetAll("session:test-session").SetErr(errors.New("err-redis-session"))
 
 	req, _ = http.NewRequest("POST", "", nil)
 	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
+	c.Request.Header.Set("payload", payload)
 	api.Logout(c)
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "err-redis-auth-email", genericResp.Message)
+	assert.Equal(t, "err-redis-session", genericResp.Message)
 
 	// 200
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	redisMock.ExpectDel("").SetVal(1)
-	redisMock.ExpectDel("test-refresh").SetVal(1)
-	redisMock.ExpectDel("auth:test@gmail.com").SetVal(1)
+	redisMock.ExpectDel("access:test-token").SetVal(1)
+	redisMock.ExpectDel("refresh:test-refresh").SetVal(1)
+	redisMock.ExpectHGetAll("session:test-session").SetVal(session)
+	redisMock.ExpectDel("session:test-session", "access:test-token", "refresh:test-refresh").SetVal(3)
+	redisMock.ExpectSRem("sessions:test-user", "test-session").SetVal(1)
 
 	req, _ = http.NewRequest("POST", "", nil)
 	c.Request = req
-	c.Request.Header.Set("payload", "{\"refresh-token\":\"test-refresh\",\"user\":{\"email\":\"test@gmail.com\"}}")
+	c.Request.Header.Set("payload", payload)
+	c.Set("token", "Bearer test-token")
 	api.Logout(c)
 
 	genericRespOk := struct {
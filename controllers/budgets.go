@@ -0,0 +1,597 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+func (api *API) GetBudgets(c *gin.Context) {
+	u := ParsePayload(c)
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	order := c.Query("order")
+	orderBy := c.Query("order_by")
+
+	filter := models.BudgetFilter{
+		Budget: models.Budget{
+			UserId:     c.Query("user_id"),
+			CategoryId: c.Query("category_id"),
+			Currency:   strings.ToUpper(c.Query("currency")),
+			Period:     c.Query("period"),
+		},
+		MinPeriod: c.Query("min_period"),
+		MaxPeriod: c.Query("max_period"),
+	}
+
+	if u.Role == string(models.Customer) {
+		filter.UserId = u.Id
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	if strings.ToUpper(order) != "ASC" && strings.ToUpper(order) != "DESC" {
+		order = "DESC"
+	}
+
+	mapOrderBy := map[string]string{
+		"id":            "b.id",
+		"user_id":       "b.user_id",
+		"category_id":   "b.category_id",
+		"category_name": "c.name",
+		"period":        "b.period",
+		"currency":      "b.currency",
+		"amount":        "b.amount",
+		"created_at":    "b.created_at",
+		"updated_at":    "b.updated_at",
+	}
+
+	if val, ok := mapOrderBy[orderBy]; ok {
+		orderBy = val
+	} else {
+		orderBy = "b.period"
+	}
+
+	countQ := `SELECT COUNT(1) FROM budgets b
+		JOIN categories c ON b.category_id = c.id
+		WHERE NOT b.deleted`
+	selectQ := `SELECT
+			b.id, b.user_id, b.category_id, c.name,
+			b.period, b.currency, b.amount, b.rollover,
+			b.closed_at, b.created_at, b.updated_at
+		FROM budgets b
+		JOIN categories c ON b.category_id = c.id
+		WHERE NOT b.deleted`
+
+	var budgetList models.BudgetList
+	var budgets []models.Budget
+	var err error
+
+	filterQ, stms := getFilterBudget(filter)
+
+	selectQ = selectQ + filterQ
+	countQ = countQ + filterQ
+
+	offset := (page - 1) * limit
+	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
+	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+
+	log.Println(selectQ + orderVal + pagination)
+
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var budget models.Budget
+		var categoryName sql.NullString
+		var period, closedAt sql.NullTime
+
+		err = rows.Scan(&budget.Id, &budget.UserId, &budget.CategoryId, &categoryName,
+			&period, &budget.Currency, &budget.Amount, &budget.Rollover,
+			&closedAt, &budget.CreatedAt, &budget.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		budget.CategoryName = categoryName.String
+
+		if period.Valid {
+			budget.Period = period.Time.Format(periodFormat)
+		}
+
+		if closedAt.Valid {
+			budget.ClosedAt = &closedAt.Time
+		}
+
+		budgets = append(budgets, budget)
+	}
+
+	budgetList.Total, err = api.GetTotal(countQ, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	budgetList.Budgets = budgets
+	budgetList.Limit = limit
+	budgetList.Page = page
+
+	c.JSON(http.StatusOK, budgetList)
+}
+
+func (api *API) UpsertBudgets(c *gin.Context) {
+	u := ParsePayload(c)
+	var payload models.UpsertBudgetRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	budgets := payload.Data
+	if len(budgets) == 0 {
+		sendError(c, http.StatusBadRequest, "missing-budgets")
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var errBudgets []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	customer := false
+	if u.Role == string(models.Customer) {
+		customer = true
+	}
+
+	for i, budget := range budgets {
+		if customer {
+			budget.UserId = u.Id
+		}
+
+		if _, err := uuid.FromString(budget.Id); err != nil {
+			budget.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateBudget(&budget, currencies); err != nil {
+			errBudgets = append(errBudgets, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		// the category has to belong to the budget owner
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1 AND user_id = $2 AND NOT deleted)",
+			budget.CategoryId, budget.UserId).Scan(&exists); err != nil {
+			log.Println(err)
+			errBudgets = append(errBudgets, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if !exists {
+			errBudgets = append(errBudgets, models.RowError{Row: i + 1, Message: "category-not-found"})
+			continue
+		}
+
+		// closed budgets are left untouched, their carried amount is history
+		tag, err := tx.Exec(`
+		INSERT INTO budgets
+		(id, user_id, category_id, period, currency, amount, rollover, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+		user_id = $2, category_id = $3, period = $4, currency = $5, amount = $6, rollover = $7, updated_at = CURRENT_TIMESTAMP, deleted = false
+		WHERE budgets.closed_at IS NULL
+		`, budget.Id, budget.UserId, budget.CategoryId, budget.Period+"-01", budget.Currency, budget.Amount, budget.Rollover)
+		if err != nil {
+			log.Println(err)
+			errBudgets = append(errBudgets, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if t, _ := tag.RowsAffected(); t == 0 {
+			errBudgets = append(errBudgets, models.RowError{Row: i + 1, Message: "budget-closed"})
+			continue
+		}
+	}
+
+	code := http.StatusInternalServerError
+	obj := gin.H{"message": "error", "details": errBudgets}
+
+	if len(errBudgets) == 0 {
+		if err := tx.Commit(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		code = http.StatusOK
+		obj = gin.H{"message": "success", "total": len(budgets)}
+	}
+
+	c.JSON(code, obj)
+}
+
+func (api *API) DeleteBudgets(c *gin.Context) {
+	api.BatchDeletes(c, "budgets")
+}
+
+// GetBudgetsStatus compares the budgets of a month with the expenses of their
+// category in the same month
+func (api *API) GetBudgetsStatus(c *gin.Context) {
+	u := ParsePayload(c)
+
+	period, err := time.Parse(periodFormat, c.DefaultQuery("period", time.Now().Format(periodFormat)))
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-period(yyyy-mm)")
+		return
+	}
+
+	filter := models.BudgetFilter{
+		Budget: models.Budget{
+			UserId:     c.Query("user_id"),
+			CategoryId: c.Query("category_id"),
+		},
+	}
+
+	if u.Role == string(models.Customer) {
+		filter.UserId = u.Id
+	}
+
+	report := models.BudgetStatusReport{Period: period.Format(periodFormat)}
+
+	report.Statuses, err = api.getBudgetStatuses(filter, period)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CloseBudgets freezes the available amount of every budget of a user in a
+// month, later changes to that month no longer move the carried amount
+func (api *API) CloseBudgets(c *gin.Context) {
+	u := ParsePayload(c)
+	var payload models.CloseBudgetRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if u.Role == string(models.Customer) {
+		payload.UserId = u.Id
+	}
+
+	if _, err := uuid.FromString(payload.UserId); err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-user-id")
+		return
+	}
+
+	period, err := time.Parse(periodFormat, payload.Period)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-period(yyyy-mm)")
+		return
+	}
+
+	statuses, err := api.getBudgetStatuses(models.BudgetFilter{Budget: models.Budget{UserId: payload.UserId}}, period)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(statuses) == 0 {
+		sendError(c, http.StatusNotFound, "budgets-not-found")
+		return
+	}
+
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	total := 0
+	for _, status := range statuses {
+		if status.Closed {
+			continue
+		}
+
+		if _, err := tx.Exec(`UPDATE budgets SET carry_out = $1, closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2 AND closed_at IS NULL`, status.Available, status.BudgetId); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		total++
+	}
+
+	if total == 0 {
+		sendError(c, http.StatusConflict, "period-already-closed")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "total": total})
+}
+
+// budgetSpentQ joins as l the expense lines of the budget category and month
+// converted into the budget currency, the select has to group by b.id
+var budgetSpentQ = `
+		LEFT JOIN (expenses e` + expenseLinesQ + ` JOIN products p ON l.product_id = p.id AND NOT p.deleted)
+			ON p.category_id = b.category_id AND e.user_id = b.user_id AND NOT e.deleted
+			AND e.date >= b.period AND e.date < b.period + INTERVAL '1 month'` + rateJoinQ("e", "b.currency")
+
+// budgetPeriod is a previous month of a rollover budget
+type budgetPeriod struct {
+	period   time.Time
+	currency string
+	amount   float64
+	spent    float64
+	carryOut float64
+	closed   bool
+}
+
+func (api *API) getBudgetStatuses(filter models.BudgetFilter, period time.Time) (statuses []models.BudgetStatus, err error) {
+	filter.Period = period.Format(periodFormat)
+	filterQ, stms := getFilterBudget(filter)
+
+	selectQ := `SELECT
+			b.id, b.user_id, b.category_id, c.name, b.currency, b.amount,
+			b.rollover, b.closed_at IS NOT NULL, COALESCE(b.carry_out, 0),
+			COALESCE(SUM(` + convertedQ("e", "l.amount", "b.currency") + `), 0),
+			` + missingRateQ("e", "b.currency") + `
+		FROM budgets b
+		JOIN categories c ON b.category_id = c.id` + budgetSpentQ + `
+		WHERE NOT b.deleted` + filterQ + `
+		GROUP BY b.id, c.name
+		ORDER BY c.name`
+
+	log.Println(selectQ)
+
+	rows, err := api.Db.Query(selectQ, stms...)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	defer rows.Close()
+
+	var carryOuts []float64
+
+	for rows.Next() {
+		var status models.BudgetStatus
+		var categoryName sql.NullString
+		var carryOut float64
+
+		err = rows.Scan(&status.BudgetId, &status.UserId, &status.CategoryId, &categoryName,
+			&status.Currency, &status.Planned, &status.Rollover, &status.Closed, &carryOut,
+			&status.Spent, &status.MissingRates)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		status.CategoryName = categoryName.String
+		status.Spent = roundAmount(status.Spent)
+		status.Remaining = roundAmount(status.Planned - status.Spent)
+
+		if status.Planned > 0 {
+			status.Percent = roundAmount(status.Spent / status.Planned * 100)
+		}
+
+		statuses = append(statuses, status)
+		carryOuts = append(carryOuts, carryOut)
+	}
+
+	if len(statuses) == 0 {
+		return
+	}
+
+	history, err := api.getBudgetHistory(filter, period)
+	if err != nil {
+		return
+	}
+
+	for i := range statuses {
+		status := &statuses[i]
+		status.CarryIn = carryIn(history[status.UserId+"/"+status.CategoryId], period, status.Currency)
+		status.Available = roundAmount(status.Planned + status.CarryIn - status.Spent)
+
+		if status.Closed {
+			status.Available = carryOuts[i]
+		}
+	}
+
+	return
+}
+
+// getBudgetHistory returns the rollover budgets before period, keyed by
+// user and category and sorted by period
+func (api *API) getBudgetHistory(filter models.BudgetFilter, period time.Time) (history map[string][]budgetPeriod, err error) {
+	filter.Period = ""
+	filter.MaxPeriod = period.AddDate(0, -1, 0).Format(periodFormat)
+	filterQ, stms := getFilterBudget(filter)
+
+	selectQ := `SELECT
+			b.user_id, b.category_id, b.period, b.currency, b.amount,
+			b.closed_at IS NOT NULL, COALESCE(b.carry_out, 0),
+			COALESCE(SUM(` + convertedQ("e", "l.amount", "b.currency") + `), 0)
+		FROM budgets b` + budgetSpentQ + `
+		WHERE NOT b.deleted AND b.rollover` + filterQ + `
+		GROUP BY b.id
+		ORDER BY b.period`
+
+	rows, err := api.Db.Query(selectQ, stms...)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	defer rows.Close()
+
+	history = map[string][]budgetPeriod{}
+	for rows.Next() {
+		var userId, categoryId string
+		var h budgetPeriod
+
+		err = rows.Scan(&userId, &categoryId, &h.period, &h.currency, &h.amount, &h.closed, &h.carryOut, &h.spent)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		key := userId + "/" + categoryId
+		history[key] = append(history[key], h)
+	}
+
+	return
+}
+
+// carryIn walks back over the consecutive rollover months before period and
+// sums what is left of them. The walk stops at a gap, a currency change or a
+// closed month, whose frozen carry is used as is.
+func carryIn(history []budgetPeriod, period time.Time, currency string) float64 {
+	start := len(history)
+	expected := period.AddDate(0, -1, 0)
+
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i]
+		if !h.period.Equal(expected) || h.currency != currency {
+			break
+		}
+
+		start = i
+		if h.closed {
+			break
+		}
+
+		expected = expected.AddDate(0, -1, 0)
+	}
+
+	var carry float64
+	for _, h := range history[start:] {
+		if h.closed {
+			carry = h.carryOut
+			continue
+		}
+
+		carry = h.amount + carry - h.spent
+	}
+
+	return roundAmount(carry)
+}
+
+func getFilterBudget(filter models.BudgetFilter) (filterQ string, stms []interface{}) {
+	if _, err := uuid.FromString(filter.UserId); err == nil {
+		filterQ = fmt.Sprintf(" AND b.user_id = $%d", len(stms)+1)
+		stms = append(stms, filter.UserId)
+	}
+
+	if _, err := uuid.FromString(filter.CategoryId); err == nil {
+		filterQ += fmt.Sprintf(" AND b.category_id = $%d", len(stms)+1)
+		stms = append(stms, filter.CategoryId)
+	}
+
+	if isCurrencyCode(filter.Currency) {
+		filterQ += fmt.Sprintf(" AND b.currency = $%d", len(stms)+1)
+		stms = append(stms, filter.Currency)
+	}
+
+	if period, err := time.Parse(periodFormat, filter.Period); err == nil {
+		filterQ += fmt.Sprintf(" AND b.period = $%d", len(stms)+1)
+		stms = append(stms, period)
+	}
+
+	if period, err := time.Parse(periodFormat, filter.MinPeriod); err == nil {
+		filterQ += fmt.Sprintf(" AND b.period >= $%d", len(stms)+1)
+		stms = append(stms, period)
+	}
+
+	if period, err := time.Parse(periodFormat, filter.MaxPeriod); err == nil {
+		filterQ += fmt.Sprintf(" AND b.period <= $%d", len(stms)+1)
+		stms = append(stms, period)
+	}
+
+	return
+}
+
+func validateBudget(budget *models.Budget, currencies map[string]models.Currency) error {
+	if budget.CategoryId == "" {
+		return errors.New("missing-category-id")
+	}
+
+	if budget.Period == "" {
+		return errors.New("missing-period")
+	}
+
+	if budget.Currency == "" {
+		return errors.New("missing-currency")
+	}
+
+	if _, err := uuid.FromString(budget.UserId); err != nil {
+		return errors.New("invalid-user-id")
+	}
+
+	if _, err := uuid.FromString(budget.CategoryId); err != nil {
+		return errors.New("invalid-category-id")
+	}
+
+	if _, err := time.Parse(periodFormat, budget.Period); err != nil {
+		return errors.New("invalid-period(yyyy-mm)")
+	}
+
+	if budget.Amount < 0 {
+		return errors.New("amount-shall-not-be-negative")
+	}
+
+	return validateAmountCurrency(&budget.Currency, budget.Amount, currencies)
+}
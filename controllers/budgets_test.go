@@ -0,0 +1,651 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetBudgets(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// err select (500)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// scan error (500)
+	label := []string{"id", "user_id", "category_id", "name", "period", "currency", "amount", "rollover", "closed_at", "created_at", "updated_at"}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets.*").
+		WillReturnRows(sqlmock.NewRows(label[9:]).AddRow(time.Now(), time.Now()))
+
+	req, _ = http.NewRequest("GET", "?order_by=amount", nil)
+	c.Request = req
+	api.GetBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 2 destination arguments in Scan, not 11", genericResp.Message)
+
+	// err count (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, "Food", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "IDR", 1500000, false, nil, time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-count", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets.*").WithArgs(mockUserID, mockID, "IDR", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, "Food", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "IDR", 1500000, true, time.Now(), time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	q := url.Values{}
+	q.Add("category_id", mockID)
+	q.Add("currency", "idr")
+	q.Add("period", "2022-01")
+	q.Add("min_period", "2022-01")
+	q.Add("max_period", "2022-12")
+
+	req, _ = http.NewRequest("GET", "", nil)
+	req.URL.RawQuery = q.Encode()
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetBudgets(c)
+
+	var resp models.BudgetList
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, int(resp.Total))
+	assert.Equal(t, 1, len(resp.Budgets))
+	assert.Equal(t, "2022-01", resp.Budgets[0].Period)
+	assert.Equal(t, "Food", resp.Budgets[0].CategoryName)
+	assert.Equal(t, true, resp.Budgets[0].Rollover)
+	assert.Equal(t, true, resp.Budgets[0].ClosedAt != nil)
+}
+
+func TestUpsertBudgets(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+
+	// nil request (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	api.UpsertBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// bad request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.UpsertBudgetRequest{})
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-budgets", genericResp.Message)
+
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertBudgetRequest{Data: []models.Budget{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-currencies"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-currencies", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertBudgetRequest{Data: []models.Budget{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// budgets validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	budgets := models.UpsertBudgetRequest{Data: []models.Budget{
+		{},
+		{CategoryId: mockID},
+		{CategoryId: mockID, Period: "2022-01"},
+		{CategoryId: mockID, Period: "2022-01", Currency: "IDR"},
+		{CategoryId: "err", Period: "2022-01", Currency: "IDR", UserId: mockUserID},
+		{CategoryId: mockID, Period: "2022-01-01", Currency: "IDR", UserId: mockUserID},
+		{CategoryId: mockID, Period: "2022-01", Currency: "IDR", UserId: mockUserID, Amount: -1},
+		{CategoryId: mockID, Period: "2022-01", Currency: "EUR", UserId: mockUserID, Amount: 100},
+		{CategoryId: mockID, Period: "2022-01", Currency: "JPY", UserId: mockUserID, Amount: 100.5},
+		{CategoryId: mockID, Period: "2022-01", Currency: "idr", UserId: mockUserID, Amount: 1500000},
+		{CategoryId: mockID, Period: "2022-01", Currency: "idr", UserId: mockUserID, Amount: 1500000},
+		{CategoryId: mockID, Period: "2022-01", Currency: "idr", UserId: mockUserID, Amount: 1500000},
+		{CategoryId: mockID, Period: "2022-01", Currency: "idr", UserId: mockUserID, Amount: 1500000, Rollover: true},
+	}}
+	payload = parsePayload(budgets)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WithArgs(mockID, mockUserID).WillReturnError(fmt.Errorf("err-exists"))
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO budgets.*").
+		WithArgs(sqlmock.AnyArg(), mockUserID, mockID, "2022-01-01", "IDR", 1500000.0, false).WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO budgets.*WHERE budgets.closed_at IS NULL.*").
+		WithArgs(sqlmock.AnyArg(), mockUserID, mockID, "2022-01-01", "IDR", 1500000.0, true).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	api.UpsertBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 13, len(respErrors.Details))
+	assert.Equal(t, "missing-category-id", respErrors.Details[0].Message)
+	assert.Equal(t, "missing-period", respErrors.Details[1].Message)
+	assert.Equal(t, "missing-currency", respErrors.Details[2].Message)
+	assert.Equal(t, "invalid-user-id", respErrors.Details[3].Message)
+	assert.Equal(t, "invalid-category-id", respErrors.Details[4].Message)
+	assert.Equal(t, "invalid-period(yyyy-mm)", respErrors.Details[5].Message)
+	assert.Equal(t, "amount-shall-not-be-negative", respErrors.Details[6].Message)
+	assert.Equal(t, "unsupported-currency", respErrors.Details[7].Message)
+	assert.Equal(t, "amount-exceeds-currency-minor-unit", respErrors.Details[8].Message)
+	assert.Equal(t, "err-exists", respErrors.Details[9].Message)
+	assert.Equal(t, "category-not-found", respErrors.Details[10].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[11].Message)
+	assert.Equal(t, "budget-closed", respErrors.Details[12].Message)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	budgets = models.UpsertBudgetRequest{Data: []models.Budget{
+		{CategoryId: mockID, Period: "2022-01", Currency: "IDR", Amount: 1500000},
+		{CategoryId: mockID, Period: "2022-02", Currency: "IDR", Amount: 1750000},
+	}}
+	payload = parsePayload(budgets)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO budgets.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO budgets.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO budgets.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT EXISTS.*categories.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO budgets.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload = parsePayload(budgets)
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 2, respSuccess.Total)
+}
+
+func TestDeleteBudgets(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	// bad request (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	payload := parsePayload(models.BatchDeleteRequest{})
+	req, _ := http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.DeleteBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-data", genericResp.Message)
+
+	// 200
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE budgets.*").WithArgs(sqlmock.AnyArg(), mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.DeleteBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+}
+
+func TestGetBudgetsStatus(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+
+	// invalid period (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("GET", "?period=2022-13", nil)
+	c.Request = req
+	api.GetBudgetsStatus(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-period(yyyy-mm)", genericResp.Message)
+
+	// err select (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*LEFT JOIN.*expenses e.*LEFT JOIN LATERAL.*").WillReturnError(errors.New("err-select"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetBudgetsStatus(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// err scan (500)
+	label := []string{"id", "user_id", "category_id", "name", "currency", "amount", "rollover", "closed", "carry_out", "spent", "missing"}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").WillReturnRows(sqlmock.NewRows(label[:1]).AddRow(mockID))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetBudgetsStatus(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 1 destination arguments in Scan, not 11", genericResp.Message)
+
+	// err select history (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").
+		WillReturnRows(sqlmock.NewRows(label).AddRow(mockID, mockUserID, mockID, "Food", "IDR", 1500000, true, false, 0, 0, 0))
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*b.rollover.*").WillReturnError(errors.New("err-select-history"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetBudgetsStatus(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-history", genericResp.Message)
+
+	// 200
+	historyLabel := []string{"user_id", "category_id", "period", "currency", "amount", "closed", "carry_out", "spent"}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").WithArgs(mockUserID, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, "Food", "IDR", 1500000, true, false, 0, 1125000.004, 0).
+			AddRow(mockID2, mockUserID, mockID2, "Travel", "USD", 200, false, false, 0, 250, 1))
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*b.rollover.*").WithArgs(mockUserID, time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows(historyLabel).
+			// closed, its frozen carry is used instead of the stale spent
+			AddRow(mockUserID, mockID, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "IDR", 1500000, true, 100000, 9999999).
+			AddRow(mockUserID, mockID, time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC), "IDR", 1500000, false, 0, 1700000).
+			// a gap in the months, not carried
+			AddRow(mockUserID, mockID2, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "USD", 200, false, 0, 0))
+
+	req, _ = http.NewRequest("GET", "?period=2022-03", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetBudgetsStatus(c)
+
+	var report models.BudgetStatusReport
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2022-03", report.Period)
+	assert.Equal(t, 2, len(report.Statuses))
+	assert.Equal(t, float64(1125000), report.Statuses[0].Spent)
+	assert.Equal(t, float64(375000), report.Statuses[0].Remaining)
+	assert.Equal(t, float64(75), report.Statuses[0].Percent)
+	assert.Equal(t, float64(-100000), report.Statuses[0].CarryIn)
+	assert.Equal(t, float64(275000), report.Statuses[0].Available)
+	assert.Equal(t, float64(-50), report.Statuses[1].Remaining)
+	assert.Equal(t, float64(125), report.Statuses[1].Percent)
+	assert.Equal(t, float64(0), report.Statuses[1].CarryIn)
+	assert.Equal(t, float64(-50), report.Statuses[1].Available)
+	assert.Equal(t, 1, report.Statuses[1].MissingRates)
+}
+
+func TestCloseBudgets(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	customerPayload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	label := []string{"id", "user_id", "category_id", "name", "currency", "amount", "rollover", "closed", "carry_out", "spent", "missing"}
+	historyLabel := []string{"user_id", "category_id", "period", "currency", "amount", "closed", "carry_out", "spent"}
+
+	// nil request (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// admin without user id (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.CloseBudgetRequest{Period: "2022-01"})
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-user-id", genericResp.Message)
+
+	// invalid period (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.CloseBudgetRequest{Period: "2022-01-01"})
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", customerPayload)
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-period(yyyy-mm)", genericResp.Message)
+
+	// err select (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.CloseBudgetRequest{Period: "2022-02"})
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").WillReturnError(errors.New("err-select"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", customerPayload)
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// not found (404)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.CloseBudgetRequest{Period: "2022-02"})
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").WillReturnRows(sqlmock.NewRows(label))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", customerPayload)
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "budgets-not-found", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.CloseBudgetRequest{Period: "2022-02"})
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").
+		WillReturnRows(sqlmock.NewRows(label).AddRow(mockID, mockUserID, mockID, "Food", "IDR", 1500000, true, false, 0, 1700000, 0))
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*b.rollover.*").WillReturnRows(sqlmock.NewRows(historyLabel))
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", customerPayload)
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// already closed (409)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.CloseBudgetRequest{Period: "2022-02"})
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").
+		WillReturnRows(sqlmock.NewRows(label).AddRow(mockID, mockUserID, mockID, "Food", "IDR", 1500000, true, true, -200000, 1700000, 0))
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*b.rollover.*").WillReturnRows(sqlmock.NewRows(historyLabel))
+	dbMock.ExpectBegin()
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", customerPayload)
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "period-already-closed", genericResp.Message)
+
+	// err update (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.CloseBudgetRequest{Period: "2022-02"})
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").
+		WillReturnRows(sqlmock.NewRows(label).AddRow(mockID, mockUserID, mockID, "Food", "IDR", 1500000, true, false, 0, 1700000, 0))
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*b.rollover.*").WillReturnRows(sqlmock.NewRows(historyLabel))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE budgets SET carry_out.*").WillReturnError(fmt.Errorf("err-update"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", customerPayload)
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-update", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.CloseBudgetRequest{Period: "2022-02"})
+
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, "Food", "IDR", 1500000, true, false, 0, 1700000, 0).
+			AddRow(mockID2, mockUserID, mockID2, "Travel", "USD", 200, false, true, 50, 150, 0))
+	dbMock.ExpectQuery("SELECT.*FROM budgets b.*b.rollover.*").
+		WillReturnRows(sqlmock.NewRows(historyLabel).
+			AddRow(mockUserID, mockID, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "IDR", 1500000, false, 0, 1000000))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE budgets SET carry_out.*").WithArgs(300000.0, mockID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", customerPayload)
+	api.CloseBudgets(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
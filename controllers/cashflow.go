@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCashflowBuckets keeps a daily report over several years from flooding
+// the response
+const maxCashflowBuckets = 1000
+
+var placeholderRe = regexp.MustCompile(`\$(\d+)`)
+
+// shiftPlaceholders renumbers the $n of a filter built on its own so that it
+// can follow another one in the same query
+func shiftPlaceholders(filterQ string, offset int) string {
+	return placeholderRe.ReplaceAllStringFunc(filterQ, func(placeholder string) string {
+		n, _ := strconv.Atoi(placeholder[1:])
+		return fmt.Sprintf("$%d", n+offset)
+	})
+}
+
+// cashflowBuckets is the number of intervals from minDate to maxDate, both
+// included
+func cashflowBuckets(interval string, minDate, maxDate time.Time) int {
+	switch interval {
+	case "day":
+		return int(maxDate.Sub(minDate).Hours()/24) + 1
+	case "week":
+		// the weeks start on monday as date_trunc has them
+		monday := minDate.AddDate(0, 0, -(int(minDate.Weekday())+6)%7)
+		return int(maxDate.Sub(monday).Hours()/24)/7 + 1
+	case "month":
+		return (maxDate.Year()-minDate.Year())*12 + int(maxDate.Month()) - int(minDate.Month()) + 1
+	default:
+		return maxDate.Year() - minDate.Year() + 1
+	}
+}
+
+// GetCashflowReport totals the incomes and the expenses per currency for each
+// day, week, month or year between min_date and max_date. It takes the filters
+// of the expenses and incomes lists, each applying to its own side.
+func (api *API) GetCashflowReport(c *gin.Context) {
+	u := ParsePayload(c)
+
+	interval := strings.ToLower(c.DefaultQuery("interval", "month"))
+	switch interval {
+	case "day", "week", "month", "year":
+	default:
+		sendError(c, http.StatusBadRequest, "invalid-interval(day|week|month|year)")
+		return
+	}
+
+	minDate, err := time.Parse(dateFormat, c.Query("min_date"))
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-min-date")
+		return
+	}
+
+	maxDate, err := time.Parse(dateFormat, c.Query("max_date"))
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-max-date")
+		return
+	}
+
+	if maxDate.Before(minDate) {
+		sendError(c, http.StatusBadRequest, "invalid-date-range")
+		return
+	}
+
+	if cashflowBuckets(interval, minDate, maxDate) > maxCashflowBuckets {
+		sendError(c, http.StatusBadRequest, fmt.Sprintf("too-many-buckets(max %d)", maxCashflowBuckets))
+		return
+	}
+
+	amount, _ := strconv.ParseFloat(c.Query("amount"), 64)
+	minAmount, _ := strconv.ParseFloat(c.Query("min_amount"), 64)
+	maxAmount, _ := strconv.ParseFloat(c.Query("max_amount"), 64)
+	tags, tagsMatch := parseTagsQuery(c)
+
+	expenseFilter := models.ExpenseFilter{
+		Expense: models.Expense{
+			UserId:      c.Query("user_id"),
+			CategoryId:  c.Query("category_id"),
+			ProductId:   c.Query("product_id"),
+			ProductName: c.Query("product_name"),
+			AccountId:   c.Query("account_id"),
+			Currency:    c.Query("currency"),
+			Amount:      amount,
+			Date:        c.Query("date"),
+			Tags:        tags,
+		},
+		MinDate:   c.Query("min_date"),
+		MaxDate:   c.Query("max_date"),
+		MinAmount: minAmount,
+		MaxAmount: maxAmount,
+		TagsMatch: tagsMatch,
+	}
+
+	incomeFilter := models.IncomeFilter{
+		Income: models.Income{
+			Name:        c.Query("name"),
+			Description: c.Query("description"),
+			UserId:      c.Query("user_id"),
+			AccountId:   c.Query("account_id"),
+			Currency:    c.Query("currency"),
+			Amount:      amount,
+			Date:        c.Query("date"),
+			Tags:        tags,
+		},
+		MinDate:   c.Query("min_date"),
+		MaxDate:   c.Query("max_date"),
+		MinAmount: minAmount,
+		MaxAmount: maxAmount,
+		TagsMatch: tagsMatch,
+	}
+
+	if u.Role == string(models.Customer) {
+		expenseFilter.UserId = u.Id
+		incomeFilter.UserId = u.Id
+	}
+
+	report, err := api.cashflowReport(interval, minDate, maxDate, expenseFilter, incomeFilter)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (api *API) cashflowReport(interval string, minDate, maxDate time.Time, expenseFilter models.ExpenseFilter, incomeFilter models.IncomeFilter) (models.CashflowReport, error) {
+	report := models.CashflowReport{Interval: interval, Buckets: []models.CashflowBucket{}}
+
+	expenseFilterQ, stms := getFilterExpense(expenseFilter)
+	incomeFilterQ, incomeStms := getFilterIncome(incomeFilter)
+	incomeFilterQ = shiftPlaceholders(incomeFilterQ, len(stms))
+	stms = append(stms, incomeStms...)
+
+	// the interval is one of the known units, it is safe in the query
+	minQ, maxQ := fmt.Sprintf("$%d", len(stms)+1), fmt.Sprintf("$%d", len(stms)+2)
+	stms = append(stms, minDate, maxDate)
+
+	// every currency gets a row in every bucket, a bucket with no currency at
+	// all comes with a NULL one
+	q := `WITH flows AS (
+			SELECT e.date, e.currency, 0 AS income, e.amount AS expense
+			FROM expenses e
+			JOIN products p ON e.product_id = p.id AND NOT p.deleted
+			WHERE NOT e.deleted` + expenseFilterQ + `
+			UNION ALL
+			SELECT date, currency, amount, 0
+			FROM incomes
+			WHERE NOT deleted` + incomeFilterQ + `
+		), buckets AS (
+			SELECT generate_series(DATE_TRUNC('` + interval + `', ` + minQ + `::DATE),
+				DATE_TRUNC('` + interval + `', ` + maxQ + `::DATE), '1 ` + interval + `'::INTERVAL)::DATE AS bucket
+		), currencies AS (
+			SELECT DISTINCT currency FROM flows
+		)
+		SELECT b.bucket, cur.currency, COALESCE(SUM(f.income), 0), COALESCE(SUM(f.expense), 0)
+		FROM buckets b
+		LEFT JOIN currencies cur ON true
+		LEFT JOIN flows f ON DATE_TRUNC('` + interval + `', f.date)::DATE = b.bucket AND f.currency = cur.currency
+		GROUP BY b.bucket, cur.currency ORDER BY b.bucket, cur.currency`
+
+	log.Println(q)
+
+	rows, err := api.Db.Query(q, stms...)
+	if err != nil {
+		return report, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var start time.Time
+		var currency sql.NullString
+		var income, expense float64
+
+		if err := rows.Scan(&start, &currency, &income, &expense); err != nil {
+			return report, err
+		}
+
+		bucket := start.Format(dateFormat)
+		if n := len(report.Buckets); n == 0 || report.Buckets[n-1].Start != bucket {
+			report.Buckets = append(report.Buckets, models.CashflowBucket{
+				Start:  bucket,
+				Totals: map[string]models.CashflowTotals{},
+			})
+		}
+
+		if currency.Valid {
+			report.Buckets[len(report.Buckets)-1].Totals[currency.String] = models.CashflowTotals{
+				Income:  roundAmount(income),
+				Expense: roundAmount(expense),
+				Net:     roundAmount(income - expense),
+			}
+		}
+	}
+
+	return report, rows.Err()
+}
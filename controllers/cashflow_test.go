@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetCashflowReport(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	for _, tc := range []struct {
+		query   string
+		message string
+	}{
+		{"?interval=quarter&min_date=2021-01-01&max_date=2021-03-31", "invalid-interval(day|week|month|year)"},
+		{"?max_date=2021-03-31", "invalid-min-date"},
+		{"?min_date=2021-01-01&max_date=2021-3-31", "invalid-max-date"},
+		{"?min_date=2021-03-01&max_date=2021-01-31", "invalid-date-range"},
+		{"?interval=day&min_date=2018-01-01&max_date=2021-01-01", "too-many-buckets(max 1000)"},
+	} {
+		// invalid query (400)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		req, _ := http.NewRequest("GET", tc.query, nil)
+		c.Request = req
+		c.Request.Header.Set("payload", payload)
+		api.GetCashflowReport(c)
+
+		err = json.NewDecoder(w.Body).Decode(&genericResp)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tc.message, genericResp.Message)
+	}
+
+	minDate := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxDate := time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+	label := []string{"bucket", "currency", "income", "expense"}
+
+	// err select (500)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("WITH flows AS.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "?min_date=2021-01-01&max_date=2021-03-31", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetCashflowReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// 200, the income filter placeholders follow the expense ones
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery(`WITH flows AS.*e\.user_id = \$1 AND p\.category_id = \$2 AND e\.date >= \$3 AND e\.date <= \$4`+
+		`.*user_id = \$5 AND date >= \$6 AND date <= \$7.*DATE_TRUNC\('month', \$8::DATE\).*DATE_TRUNC\('month', \$9::DATE\), '1 month'::INTERVAL`).
+		WithArgs(mockUserID, mockID, minDate, maxDate, mockUserID, minDate, maxDate, minDate, maxDate).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(minDate, "IDR", 5000000, 75000.5).
+			AddRow(minDate, "USD", 0, 10).
+			AddRow(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), "IDR", 0, 0).
+			AddRow(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), "USD", 0, 0).
+			AddRow(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), "IDR", 100, 250).
+			AddRow(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), "USD", 0, 0))
+
+	req, _ = http.NewRequest("GET", "?min_date=2021-01-01&max_date=2021-03-31&category_id="+mockID, nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetCashflowReport(c)
+
+	var report models.CashflowReport
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "month", report.Interval)
+	assert.Equal(t, 3, len(report.Buckets))
+	assert.Equal(t, "2021-01-01", report.Buckets[0].Start)
+	assert.Equal(t, models.CashflowTotals{Income: 5000000, Expense: 75000.5, Net: 4924999.5}, report.Buckets[0].Totals["IDR"])
+	assert.Equal(t, models.CashflowTotals{Expense: 10, Net: -10}, report.Buckets[0].Totals["USD"])
+	assert.Equal(t, models.CashflowTotals{}, report.Buckets[1].Totals["IDR"])
+	assert.Equal(t, models.CashflowTotals{Income: 100, Expense: 250, Net: -150}, report.Buckets[2].Totals["IDR"])
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	// 200 without any flow, the buckets are still there
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	weekEnd := time.Date(2021, 1, 14, 0, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery(`WITH flows AS.*name ILIKE \$5.*DATE_TRUNC\('week', \$8::DATE\)`).
+		WithArgs(mockUserID, minDate, weekEnd, mockUserID, "%salary%", minDate, weekEnd, minDate, weekEnd).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC), nil, 0, 0).
+			AddRow(time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), nil, 0, 0).
+			AddRow(time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC), nil, 0, 0))
+
+	req, _ = http.NewRequest("GET", "?interval=WEEK&min_date=2021-01-01&max_date=2021-01-14&name=salary", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetCashflowReport(c)
+
+	report = models.CashflowReport{}
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, len(report.Buckets))
+	assert.Equal(t, "2020-12-28", report.Buckets[0].Start)
+	assert.Equal(t, 0, len(report.Buckets[2].Totals))
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
+
+func TestCashflowBuckets(t *testing.T) {
+	minDate := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxDate := time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 90, cashflowBuckets("day", minDate, maxDate))
+	assert.Equal(t, 14, cashflowBuckets("week", minDate, maxDate))
+	assert.Equal(t, 3, cashflowBuckets("month", minDate, maxDate))
+	assert.Equal(t, 1, cashflowBuckets("year", minDate, maxDate))
+	assert.Equal(t, " AND user_id = $4 AND x = ANY($5)", shiftPlaceholders(" AND user_id = $1 AND x = ANY($2)", 3))
+}
@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/dustin/go-humanize"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/gofrs/uuid"
@@ -23,8 +24,9 @@ import (
 )
 
 var (
-	dateFormat = "2006-01-02"
-	s1         = `
+	dateFormat   = "2006-01-02"
+	periodFormat = "2006-01"
+	s1           = `
 	{
 		"border": [
 			{
@@ -129,6 +131,63 @@ func (api *API) GetTotal(query string, statement []interface{}) (total int32, er
 	return
 }
 
+// getTotalsByCurrency expects q to select the currency and its total, grouped by currency
+func (api *API) getTotalsByCurrency(q string, stms []interface{}) (totals map[string]float64, err error) {
+	rows, err := api.Db.Query(q, stms...)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	defer rows.Close()
+
+	totals = map[string]float64{}
+	for rows.Next() {
+		var currency sql.NullString
+		var total sql.NullFloat64
+
+		if err = rows.Scan(&currency, &total); err != nil {
+			log.Println(err)
+			return
+		}
+
+		totals[currency.String] = total.Float64
+	}
+
+	return
+}
+
+// currencyDisplay is the symbol of the currency, or its code when it is not
+// in the registry, and the decimals of its minor unit
+func currencyDisplay(currency string, currencies map[string]models.Currency) (symbol string, minorUnit int) {
+	symbol, minorUnit = currency, 2
+	if registered, ok := currencies[currency]; ok {
+		minorUnit = registered.MinorUnit
+		if registered.Symbol != "" {
+			symbol = registered.Symbol
+		}
+	}
+
+	return
+}
+
+// formatAmount humanizes an amount the way the workbook formats it, like
+// Rp 1,000,000.00 or ¥ 1,000
+func formatAmount(currency string, amount float64, currencies map[string]models.Currency) string {
+	symbol, minorUnit := currencyDisplay(currency, currencies)
+
+	return fmt.Sprintf("%s %s", symbol, humanize.FormatFloat("#,###."+strings.Repeat("#", minorUnit), amount))
+}
+
+// formatConvertedAmount shows "-" when no exchange rate was found
+func formatConvertedAmount(currency string, amount *float64, currencies map[string]models.Currency) string {
+	if amount == nil {
+		return "-"
+	}
+
+	return formatAmount(currency, *amount, currencies)
+}
+
 func (api *API) BatchDeletes(c *gin.Context, table string) {
 	u := ParsePayload(c)
 	var req models.BatchDeleteRequest
@@ -147,6 +206,7 @@ func (api *API) BatchDeletes(c *gin.Context, table string) {
 
 	needCheckCategories := table == "categories"
 	needCheckProducts := table == "products"
+	needCheckAccounts := table == "accounts"
 
 	var errInvalid []models.RowError
 
@@ -176,7 +236,25 @@ func (api *API) BatchDeletes(c *gin.Context, table string) {
 
 		if needCheckProducts {
 			var exists bool
-			if err := api.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM expenses WHERE product_id = $1 AND NOT deleted)", id).Scan(&exists); err != nil {
+			if err := api.Db.QueryRow(`SELECT EXISTS(SELECT 1 FROM expenses WHERE product_id = $1 AND NOT deleted)
+				OR EXISTS(SELECT 1 FROM expense_splits s JOIN expenses e ON s.expense_id = e.id WHERE s.product_id = $1 AND NOT e.deleted)`, id).Scan(&exists); err != nil {
+				sendError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			if exists {
+				errInvalid = append(errInvalid, models.RowError{
+					Row:     i,
+					Message: "conflict-id",
+				})
+			}
+		}
+
+		if needCheckAccounts {
+			var exists bool
+			if err := api.Db.QueryRow(`SELECT EXISTS(SELECT 1 FROM expenses WHERE account_id = $1 AND NOT deleted)
+				OR EXISTS(SELECT 1 FROM incomes WHERE account_id = $1 AND NOT deleted)
+				OR EXISTS(SELECT 1 FROM transfers WHERE $1 IN (from_account_id, to_account_id) AND NOT deleted)`, id).Scan(&exists); err != nil {
 				sendError(c, http.StatusInternalServerError, err.Error())
 				return
 			}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (api *API) GetCurrencies(c *gin.Context) {
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var currencyList models.CurrencyList
+	for _, currency := range currencies {
+		currencyList.Currencies = append(currencyList.Currencies, currency)
+	}
+
+	// keep the response stable, maps are unordered
+	sort.Slice(currencyList.Currencies, func(i, j int) bool {
+		return currencyList.Currencies[i].Code < currencyList.Currencies[j].Code
+	})
+
+	c.JSON(http.StatusOK, currencyList)
+}
+
+// only admin
+func (api *API) UpsertCurrencies(c *gin.Context) {
+	u := ParsePayload(c)
+	if u.Role != string(models.Admin) {
+		sendError(c, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	var payload models.UpsertCurrencyRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currencies := payload.Data
+	if len(currencies) == 0 {
+		sendError(c, http.StatusBadRequest, "missing-currencies")
+		return
+	}
+
+	var errCurrencies []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	for i, currency := range currencies {
+		if err := validateCurrency(&currency); err != nil {
+			errCurrencies = append(errCurrencies, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO currencies
+		(code, name, minor_unit, symbol, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(code) DO UPDATE SET
+		name = $2, minor_unit = $3, symbol = $4, updated_at = CURRENT_TIMESTAMP
+		`, currency.Code, currency.Name, currency.MinorUnit, currency.Symbol); err != nil {
+			log.Println(err)
+			errCurrencies = append(errCurrencies, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+	}
+
+	code := http.StatusInternalServerError
+	obj := gin.H{"message": "error", "details": errCurrencies}
+
+	if len(errCurrencies) == 0 {
+		if err := tx.Commit(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		code = http.StatusOK
+		obj = gin.H{"message": "success", "total": len(currencies)}
+	}
+
+	c.JSON(code, obj)
+}
+
+func (api *API) getCurrencies() (currencies map[string]models.Currency, err error) {
+	rows, err := api.Db.Query(`SELECT code, name, minor_unit, symbol, created_at, updated_at FROM currencies`)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	defer rows.Close()
+
+	currencies = map[string]models.Currency{}
+	for rows.Next() {
+		var currency models.Currency
+		err = rows.Scan(&currency.Code, &currency.Name, &currency.MinorUnit, &currency.Symbol, &currency.CreatedAt, &currency.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		currencies[currency.Code] = currency
+	}
+
+	return
+}
+
+func validateCurrency(currency *models.Currency) error {
+	currency.Code = strings.ToUpper(currency.Code)
+	if !isCurrencyCode(currency.Code) {
+		return errors.New("invalid-code(iso-4217)")
+	}
+
+	if currency.Name == "" {
+		return errors.New("missing-name")
+	}
+
+	if currency.Symbol == "" {
+		return errors.New("missing-symbol")
+	}
+
+	// amounts are stored with 2 decimals
+	if currency.MinorUnit < 0 || currency.MinorUnit > 2 {
+		return errors.New("minor-unit-must-be-between-0-and-2")
+	}
+
+	return nil
+}
+
+// validateAmountCurrency normalizes the currency code and checks it against the
+// registry, including the number of decimals allowed by its minor unit.
+func validateAmountCurrency(currency *string, amount float64, currencies map[string]models.Currency) error {
+	*currency = strings.ToUpper(*currency)
+
+	registered, ok := currencies[*currency]
+	if !ok {
+		return errors.New("unsupported-currency")
+	}
+
+	scaled := amount * math.Pow10(registered.MinorUnit)
+	if math.Abs(scaled-math.Round(scaled)) > 1e-6 {
+		return errors.New("amount-exceeds-currency-minor-unit")
+	}
+
+	return nil
+}
+
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
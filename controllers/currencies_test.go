@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetCurrencies(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// err select (500)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// err scan (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("IDR"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 1 destination arguments in Scan, not 6", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetCurrencies(c)
+
+	var resp models.CurrencyList
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, len(resp.Currencies))
+	assert.Equal(t, "IDR", resp.Currencies[0].Code)
+	assert.Equal(t, "JPY", resp.Currencies[1].Code)
+	assert.Equal(t, 0, resp.Currencies[1].MinorUnit)
+	assert.Equal(t, "USD", resp.Currencies[2].Code)
+}
+
+func TestUpsertCurrencies(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	adminPayload := "{\"user\":{\"id\":\"63eb226a-d612-412b-b8d4-a3e17b7d2228\", \"role\":\"ADMIN\"}}"
+
+	// customer (403)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\"63eb226a-d612-412b-b8d4-a3e17b7d2228\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "forbidden", genericResp.Message)
+
+	// nil request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("POST", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// bad request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.UpsertCurrencyRequest{})
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-currencies", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertCurrencyRequest{Data: []models.Currency{
+		{},
+	}})
+
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// currencies validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	currencies := models.UpsertCurrencyRequest{Data: []models.Currency{
+		{},
+		{Code: "eur"},
+		{Code: "eur", Name: "Euro"},
+		{Code: "eur", Name: "Euro", Symbol: "€", MinorUnit: 3},
+		{Code: "eur", Name: "Euro", Symbol: "€", MinorUnit: 2},
+	}}
+	payload = parsePayload(currencies)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO currencies.*").
+		WithArgs("EUR", "Euro", 2, "€").WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 5, len(respErrors.Details))
+	assert.Equal(t, "invalid-code(iso-4217)", respErrors.Details[0].Message)
+	assert.Equal(t, "missing-name", respErrors.Details[1].Message)
+	assert.Equal(t, "missing-symbol", respErrors.Details[2].Message)
+	assert.Equal(t, "minor-unit-must-be-between-0-and-2", respErrors.Details[3].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[4].Message)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	currencies = models.UpsertCurrencyRequest{Data: []models.Currency{
+		{Code: "EUR", Name: "Euro", Symbol: "€", MinorUnit: 2},
+		{Code: "SGD", Name: "Singapore Dollar", Symbol: "S$", MinorUnit: 2},
+	}}
+	payload = parsePayload(currencies)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO currencies.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO currencies.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO currencies.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO currencies.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload = parsePayload(currencies)
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertCurrencies(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 2, respSuccess.Total)
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (api *API) GetExchangeRates(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	order := c.Query("order")
+	orderBy := c.Query("order_by")
+
+	filter := models.ExchangeRateFilter{
+		ExchangeRate: models.ExchangeRate{
+			FromCurrency: strings.ToUpper(c.Query("from_currency")),
+			ToCurrency:   strings.ToUpper(c.Query("to_currency")),
+			Date:         c.Query("date"),
+		},
+		MinDate: c.Query("min_date"),
+		MaxDate: c.Query("max_date"),
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	if strings.ToUpper(order) != "ASC" && strings.ToUpper(order) != "DESC" {
+		order = "DESC"
+	}
+
+	mapOrderBy := map[string]string{
+		"date":          "date",
+		"from_currency": "from_currency",
+		"to_currency":   "to_currency",
+		"rate":          "rate",
+		"created_at":    "created_at",
+		"updated_at":    "updated_at",
+	}
+
+	if val, ok := mapOrderBy[orderBy]; ok {
+		orderBy = val
+	} else {
+		orderBy = "date"
+	}
+
+	countQ := `SELECT COUNT(1) FROM exchange_rates
+		WHERE true`
+	selectQ := `SELECT
+			date, from_currency, to_currency,
+			rate, created_at, updated_at
+		FROM exchange_rates
+		WHERE true`
+
+	var exchangeRateList models.ExchangeRateList
+	var exchangeRates []models.ExchangeRate
+	var err error
+
+	filterQ, stms := getFilterExchangeRate(filter)
+
+	selectQ = selectQ + filterQ
+	countQ = countQ + filterQ
+
+	offset := (page - 1) * limit
+	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
+	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+
+	log.Println(selectQ + orderVal + pagination)
+
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var exchangeRate models.ExchangeRate
+		var date sql.NullTime
+
+		err = rows.Scan(&date, &exchangeRate.FromCurrency, &exchangeRate.ToCurrency,
+			&exchangeRate.Rate, &exchangeRate.CreatedAt, &exchangeRate.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if date.Valid {
+			exchangeRate.Date = date.Time.Format(dateFormat)
+		}
+
+		exchangeRates = append(exchangeRates, exchangeRate)
+	}
+
+	exchangeRateList.Total, err = api.GetTotal(countQ, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	exchangeRateList.ExchangeRates = exchangeRates
+	exchangeRateList.Limit = limit
+	exchangeRateList.Page = page
+
+	c.JSON(http.StatusOK, exchangeRateList)
+}
+
+// only admin
+func (api *API) UpsertExchangeRates(c *gin.Context) {
+	u := ParsePayload(c)
+	if u.Role != string(models.Admin) {
+		sendError(c, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	var payload models.UpsertExchangeRateRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exchangeRates := payload.Data
+	if len(exchangeRates) == 0 {
+		sendError(c, http.StatusBadRequest, "missing-exchange-rates")
+		return
+	}
+
+	var errExchangeRates []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	for i, exchangeRate := range exchangeRates {
+		if err := validateExchangeRate(&exchangeRate); err != nil {
+			errExchangeRates = append(errExchangeRates, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO exchange_rates
+		(date, from_currency, to_currency, rate, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(date, from_currency, to_currency) DO UPDATE SET
+		rate = $4, updated_at = CURRENT_TIMESTAMP
+		`, exchangeRate.Date, exchangeRate.FromCurrency, exchangeRate.ToCurrency, exchangeRate.Rate); err != nil {
+			log.Println(err)
+			errExchangeRates = append(errExchangeRates, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+	}
+
+	code := http.StatusInternalServerError
+	obj := gin.H{"message": "error", "details": errExchangeRates}
+
+	if len(errExchangeRates) == 0 {
+		if err := tx.Commit(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		code = http.StatusOK
+		obj = gin.H{"message": "success", "total": len(exchangeRates)}
+	}
+
+	c.JSON(code, obj)
+}
+
+func getFilterExchangeRate(filter models.ExchangeRateFilter) (filterQ string, stms []interface{}) {
+	if isCurrencyCode(filter.FromCurrency) {
+		filterQ += fmt.Sprintf(" AND from_currency = $%d", len(stms)+1)
+		stms = append(stms, filter.FromCurrency)
+	}
+
+	if isCurrencyCode(filter.ToCurrency) {
+		filterQ += fmt.Sprintf(" AND to_currency = $%d", len(stms)+1)
+		stms = append(stms, filter.ToCurrency)
+	}
+
+	if date, err := time.Parse(dateFormat, filter.Date); err == nil {
+		filterQ += fmt.Sprintf(" AND date = $%d", len(stms)+1)
+		stms = append(stms, date)
+	}
+
+	if date, err := time.Parse(dateFormat, filter.MinDate); err == nil {
+		filterQ += fmt.Sprintf(" AND date >= $%d", len(stms)+1)
+		stms = append(stms, date)
+	}
+
+	if date, err := time.Parse(dateFormat, filter.MaxDate); err == nil {
+		filterQ += fmt.Sprintf(" AND date <= $%d", len(stms)+1)
+		stms = append(stms, date)
+	}
+
+	return
+}
+
+func validateExchangeRate(exchangeRate *models.ExchangeRate) error {
+	if exchangeRate.Date == "" {
+		return errors.New("missing-date")
+	}
+
+	if _, err := time.Parse(dateFormat, exchangeRate.Date); err != nil {
+		return errors.New("invalid-date(yyyy-mm-dd)")
+	}
+
+	exchangeRate.FromCurrency = strings.ToUpper(exchangeRate.FromCurrency)
+	exchangeRate.ToCurrency = strings.ToUpper(exchangeRate.ToCurrency)
+
+	if !isCurrencyCode(exchangeRate.FromCurrency) {
+		return errors.New("invalid-from-currency")
+	}
+
+	if !isCurrencyCode(exchangeRate.ToCurrency) {
+		return errors.New("invalid-to-currency")
+	}
+
+	if exchangeRate.FromCurrency == exchangeRate.ToCurrency {
+		return errors.New("from-and-to-currency-shall-be-different")
+	}
+
+	if exchangeRate.Rate <= 0 {
+		return errors.New("rate-shall-be-positive")
+	}
+
+	return nil
+}
+
+// parseBaseCurrency reads the optional base_currency query, an empty string
+// means no conversion was requested
+func parseBaseCurrency(c *gin.Context) (string, error) {
+	base := strings.ToUpper(c.Query("base_currency"))
+	if base != "" && !isCurrencyCode(base) {
+		return "", errors.New("invalid-base-currency")
+	}
+
+	return base, nil
+}
+
+// rateJoinQ joins fx.rate, the latest rate on or before the transaction date
+// converting alias.currency into target. The inverse of the opposite pair is
+// used when only that one is known.
+func rateJoinQ(alias, target string) string {
+	return fmt.Sprintf(`
+		LEFT JOIN LATERAL (
+			SELECT CASE WHEN x.from_currency = %[1]s.currency THEN x.rate ELSE 1 / x.rate END AS rate
+			FROM exchange_rates x
+			WHERE x.date <= %[1]s.date AND (
+				(x.from_currency = %[1]s.currency AND x.to_currency = %[2]s) OR
+				(x.from_currency = %[2]s AND x.to_currency = %[1]s.currency))
+			ORDER BY x.date DESC
+			LIMIT 1
+		) fx ON %[1]s.currency <> %[2]s`, alias, target)
+}
+
+// convertedQ is the amount converted into target, NULL when no rate is known.
+// It needs rateJoinQ in the same query.
+func convertedQ(alias, amount, target string) string {
+	return fmt.Sprintf("CASE WHEN %[1]s.currency = %[3]s THEN %[2]s ELSE %[2]s * fx.rate END", alias, amount, target)
+}
+
+// missingRateQ counts the rows convertedQ could not convert
+func missingRateQ(alias, target string) string {
+	return fmt.Sprintf("COUNT(1) FILTER (WHERE %[1]s.currency <> %[2]s AND fx.rate IS NULL)", alias, target)
+}
+
+// roundAmount rounds to the 2 decimals amounts are stored with
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
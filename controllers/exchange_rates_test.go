@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetExchangeRates(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// err select (500)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM exchange_rates.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// scan error (500)
+	label := []string{"date", "from_currency", "to_currency", "rate", "created_at", "updated_at"}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM exchange_rates.*").
+		WillReturnRows(sqlmock.NewRows(label[4:]).AddRow(time.Now(), time.Now()))
+
+	req, _ = http.NewRequest("GET", "?order_by=rate", nil)
+	c.Request = req
+	api.GetExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 2 destination arguments in Scan, not 6", genericResp.Message)
+
+	// err count (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM exchange_rates.*").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(time.Now(), "USD", "IDR", 14250.5, time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-count", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM exchange_rates.*").WithArgs("USD", "IDR", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "USD", "IDR", 14250.5, time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	q := url.Values{}
+	q.Add("from_currency", "usd")
+	q.Add("to_currency", "IDR")
+	q.Add("date", "2022-01-01")
+	q.Add("min_date", "2022-01-01")
+	q.Add("max_date", "2022-12-31")
+
+	req, _ = http.NewRequest("GET", "", nil)
+	req.URL.RawQuery = q.Encode()
+	c.Request = req
+	api.GetExchangeRates(c)
+
+	var resp models.ExchangeRateList
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, int(resp.Total))
+	assert.Equal(t, 1, len(resp.ExchangeRates))
+	assert.Equal(t, "2022-01-01", resp.ExchangeRates[0].Date)
+	assert.Equal(t, 14250.5, resp.ExchangeRates[0].Rate)
+}
+
+func TestUpsertExchangeRates(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	adminPayload := "{\"user\":{\"id\":\"63eb226a-d612-412b-b8d4-a3e17b7d2228\", \"role\":\"ADMIN\"}}"
+
+	// customer (403)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\"63eb226a-d612-412b-b8d4-a3e17b7d2228\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "forbidden", genericResp.Message)
+
+	// nil request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("POST", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// bad request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.UpsertExchangeRateRequest{})
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-exchange-rates", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertExchangeRateRequest{Data: []models.ExchangeRate{
+		{},
+	}})
+
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// exchange rates validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	exchangeRates := models.UpsertExchangeRateRequest{Data: []models.ExchangeRate{
+		{},
+		{Date: "err"},
+		{Date: "2022-01-01", FromCurrency: "euro"},
+		{Date: "2022-01-01", FromCurrency: "usd", ToCurrency: "euro"},
+		{Date: "2022-01-01", FromCurrency: "usd", ToCurrency: "USD"},
+		{Date: "2022-01-01", FromCurrency: "usd", ToCurrency: "idr"},
+		{Date: "2022-01-01", FromCurrency: "usd", ToCurrency: "idr", Rate: 14250.5},
+	}}
+	payload = parsePayload(exchangeRates)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO exchange_rates.*").
+		WithArgs("2022-01-01", "USD", "IDR", 14250.5).WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 7, len(respErrors.Details))
+	assert.Equal(t, "missing-date", respErrors.Details[0].Message)
+	assert.Equal(t, "invalid-date(yyyy-mm-dd)", respErrors.Details[1].Message)
+	assert.Equal(t, "invalid-from-currency", respErrors.Details[2].Message)
+	assert.Equal(t, "invalid-to-currency", respErrors.Details[3].Message)
+	assert.Equal(t, "from-and-to-currency-shall-be-different", respErrors.Details[4].Message)
+	assert.Equal(t, "rate-shall-be-positive", respErrors.Details[5].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[6].Message)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	exchangeRates = models.UpsertExchangeRateRequest{Data: []models.ExchangeRate{
+		{Date: "2022-01-01", FromCurrency: "USD", ToCurrency: "IDR", Rate: 14250.5},
+		{Date: "2022-01-01", FromCurrency: "EUR", ToCurrency: "IDR", Rate: 16100},
+	}}
+	payload = parsePayload(exchangeRates)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO exchange_rates.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO exchange_rates.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO exchange_rates.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO exchange_rates.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload = parsePayload(exchangeRates)
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", adminPayload)
+	api.UpsertExchangeRates(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 2, respSuccess.Total)
+}
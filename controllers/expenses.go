@@ -12,50 +12,93 @@ import (
 	"time"
 
 	"github.com/360EntSecGroup-Skylar/excelize/v2"
-	"github.com/dustin/go-humanize"
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
 )
 
+// expenseLinesQ joins as l the split lines of the expense e, or the expense
+// itself when it is not split
+var expenseLinesQ = `
+		JOIN LATERAL (
+			SELECT s.product_id, s.amount FROM expense_splits s WHERE s.expense_id = e.id
+			UNION ALL
+			SELECT e.product_id, e.amount WHERE NOT EXISTS (SELECT 1 FROM expense_splits s WHERE s.expense_id = e.id)
+		) l ON true`
+
+// GetExpensesReport groups by the category of the split lines
 func (api *API) GetExpensesReport(c *gin.Context) {
 	u := ParsePayload(c)
+	filter := expenseReportFilter(c, u)
+
+	baseCurrency, err := parseBaseCurrency(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	baseCurrency, err = api.defaultBaseCurrency(u.Id, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	report, err := api.expensesReport(filter, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// expenseReportFilter is the filter the expense reports take
+func expenseReportFilter(c *gin.Context, u models.RedisPayload) models.ExpenseFilter {
 	filter := models.ExpenseFilter{
 		Expense: models.Expense{
 			UserId:     c.Query("user_id"),
 			CategoryId: c.Query("category_id"),
+			ProductId:  c.Query("product_id"),
 			Currency:   c.Query("currency"),
 		},
 		MinDate: c.Query("min_date"),
 		MaxDate: c.Query("max_date"),
 	}
 
+	filter.Tags, filter.TagsMatch = parseTagsQuery(c)
+
 	if u.Role == string(models.Customer) {
 		filter.UserId = u.Id
 	}
 
-	totalQ := `SELECT SUM(amount) FROM expenses e
-		JOIN products p ON e.product_id = p.id AND NOT p.deleted
+	return filter
+}
+
+// expensesReport totals the expenses matching filter per currency and category,
+// converted into baseCurrency too when it is set
+func (api *API) expensesReport(filter models.ExpenseFilter, baseCurrency string) (report models.ExpenseReport, err error) {
+	totalQ := `SELECT e.currency, SUM(l.amount) FROM expenses e` + expenseLinesQ + `
+		JOIN products p ON l.product_id = p.id AND NOT p.deleted
 		JOIN categories c ON p.category_id = c.id
 		WHERE NOT e.deleted`
 
-	selectQ := `SELECT e.currency, c.id, c.name, SUM(amount)
-		FROM expenses e
-		JOIN products p ON e.product_id = p.id AND NOT p.deleted
+	selectQ := `SELECT e.currency, c.id, c.name, SUM(l.amount)
+		FROM expenses e` + expenseLinesQ + `
+		JOIN products p ON l.product_id = p.id AND NOT p.deleted
 		JOIN categories c ON p.category_id = c.id
 		WHERE NOT e.deleted`
 
-	filterQ, stms := getFilterExpense(filter)
+	filterQ, stms := getFilterExpenseLines(filter)
 
 	selectQ = selectQ + filterQ
-	totalQ = totalQ + filterQ
+	totalQ = totalQ + filterQ + " GROUP BY e.currency"
 
-	var report models.ExpenseReport
-	var err error
+	report.Reports = map[string][]models.CategoryTotalReport{}
 
-	report.TotalIdr, report.TotalUsd, err = api.getTotalIdrUsd(filter.Currency, totalQ, stms)
+	report.Totals, err = api.getTotalsByCurrency(totalQ, stms)
 	if err != nil {
-		log.Println(err)
-		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -66,8 +109,6 @@ func (api *API) GetExpensesReport(c *gin.Context) {
 
 	rows, err := api.Db.Query(selectQ, stms...)
 	if err != nil {
-		log.Println(err)
-		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -78,24 +119,59 @@ func (api *API) GetExpensesReport(c *gin.Context) {
 		var categoryReport models.CategoryTotalReport
 		var currency string
 
-		if err := rows.Scan(&currency, &categoryReport.Id, &categoryReport.Name, &total); err != nil {
-			log.Println(err)
-			sendError(c, http.StatusInternalServerError, err.Error())
+		if err = rows.Scan(&currency, &categoryReport.Id, &categoryReport.Name, &total); err != nil {
 			return
 		}
 
 		categoryReport.Total = total.Float64
+		report.Reports[currency] = append(report.Reports[currency], categoryReport)
+	}
 
-		if currency == "IDR" {
-			report.ReportsIdr = append(report.ReportsIdr, categoryReport)
-		}
+	if baseCurrency != "" {
+		report.Converted, err = api.getConvertedExpenseReport(filterQ, stms, baseCurrency)
+	}
+
+	return
+}
+
+func (api *API) getConvertedExpenseReport(filterQ string, stms []interface{}, baseCurrency string) (*models.ConvertedReport, error) {
+	target := fmt.Sprintf("$%d", len(stms)+1)
+	args := append(append([]interface{}{}, stms...), baseCurrency)
+
+	q := `SELECT c.id, c.name, SUM(` + convertedQ("e", "l.amount", target) + `), ` + missingRateQ("e", target) + `
+		FROM expenses e` + expenseLinesQ + `
+		JOIN products p ON l.product_id = p.id AND NOT p.deleted
+		JOIN categories c ON p.category_id = c.id` + rateJoinQ("e", target) + `
+		WHERE NOT e.deleted` + filterQ + ` GROUP BY c.id, c.name`
+
+	rows, err := api.Db.Query(q, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
 
-		if currency == "USD" {
-			report.ReportsUsd = append(report.ReportsUsd, categoryReport)
+	defer rows.Close()
+
+	converted := &models.ConvertedReport{BaseCurrency: baseCurrency}
+	for rows.Next() {
+		var total sql.NullFloat64
+		var missing int
+		var categoryReport models.CategoryTotalReport
+
+		if err := rows.Scan(&categoryReport.Id, &categoryReport.Name, &total, &missing); err != nil {
+			log.Println(err)
+			return nil, err
 		}
+
+		categoryReport.Total = roundAmount(total.Float64)
+		converted.Reports = append(converted.Reports, categoryReport)
+		converted.Total += total.Float64
+		converted.MissingRates += missing
 	}
 
-	c.JSON(http.StatusOK, report)
+	converted.Total = roundAmount(converted.Total)
+
+	return converted, nil
 }
 
 func (api *API) GetExpenses(c *gin.Context) {
@@ -110,6 +186,7 @@ func (api *API) GetExpenses(c *gin.Context) {
 	maxAmount, _ := strconv.ParseFloat(c.Query("max_amount"), 64)
 
 	asExcel, _ := strconv.ParseBool(c.Query("export_as_excel"))
+	asCSV := strings.ToLower(c.Query("export")) == "csv"
 
 	filter := models.ExpenseFilter{
 		Expense: models.Expense{
@@ -117,6 +194,7 @@ func (api *API) GetExpenses(c *gin.Context) {
 			CategoryId:  c.Query("category_id"),
 			ProductId:   c.Query("product_id"),
 			ProductName: c.Query("product_name"),
+			AccountId:   c.Query("account_id"),
 			Currency:    c.Query("currency"),
 			Amount:      amount,
 			Date:        c.Query("date"),
@@ -127,6 +205,8 @@ func (api *API) GetExpenses(c *gin.Context) {
 		MaxAmount: maxAmount,
 	}
 
+	filter.Tags, filter.TagsMatch = parseTagsQuery(c)
+
 	if u.Role == string(models.Customer) {
 		filter.UserId = u.Id
 	}
@@ -152,6 +232,7 @@ func (api *API) GetExpenses(c *gin.Context) {
 		"currency":      "e.currency",
 		"amount":        "e.amount",
 		"user_id":       "e.user_id",
+		"account_id":    "e.account_id",
 		"created_at":    "e.created_at",
 		"updated_at":    "e.updated_at",
 	}
@@ -162,35 +243,45 @@ func (api *API) GetExpenses(c *gin.Context) {
 		orderBy = "e.updated_at"
 	}
 
-	countQ := `SELECT COUNT(1) FROM expenses e
-		JOIN products p ON e.product_id = p.id AND NOT p.deleted
-		JOIN categories c ON p.category_id = c.id
-		WHERE NOT e.deleted`
-	selectQ := `SELECT
-			e.id, p.category_id, c.name, c.description, p.id,
-			p.name, p.description, e.date, e.currency, e.amount,
-			e.user_id, e.created_at, e.updated_at
-		FROM expenses e
-		JOIN products p ON e.product_id = p.id AND NOT p.deleted
-		JOIN categories c ON p.category_id = c.id
+	baseCurrency, err := parseBaseCurrency(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// exports follow the user's preference, the json list converts on request only
+	if asExcel || asCSV {
+		baseCurrency, err = api.defaultBaseCurrency(u.Id, baseCurrency)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	countQ := `SELECT COUNT(1)` + expensesFromQ + `
 		WHERE NOT e.deleted`
 
 	var expenseList models.ExpenseList
 	var expenses []models.Expense
-	var err error
 
 	filterQ, stms := getFilterExpense(filter)
-
-	selectQ = selectQ + filterQ
+	selectQ, selectStms := expensesSelectQ(filterQ, stms, baseCurrency)
 	countQ = countQ + filterQ
 
 	offset := (page - 1) * limit
 	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
 	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
 
+	// exports are the whole filtered list, not a page of it
+	if asExcel || asCSV {
+		api.exportExpenses(c, selectQ+orderVal, selectStms, baseCurrency, asCSV)
+		return
+	}
+
 	log.Println(selectQ + orderVal + pagination)
 
-	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, selectStms...)
 	if err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
@@ -200,46 +291,16 @@ func (api *API) GetExpenses(c *gin.Context) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var expense models.Expense
-
-		var categoryId, categoryName, categoryDescription, productId,
-			productName, productDescription, currency, userId sql.NullString
-
-		var amount sql.NullFloat64
-
-		var date sql.NullTime
-
-		err = rows.Scan(&expense.Id, &categoryId, &categoryName, &categoryDescription, &productId,
-			&productName, &productDescription, &date, &currency, &amount,
-			&userId, &expense.CreatedAt, &expense.UpdatedAt)
+		expense, err := scanExpense(rows, baseCurrency != "")
 		if err != nil {
 			log.Println(err)
 			sendError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		expense.CategoryId = categoryId.String
-		expense.CategoryName = categoryName.String
-		expense.CategoryDescription = categoryDescription.String
-		expense.ProductId = productId.String
-		expense.ProductName = productName.String
-		expense.ProductDescription = productDescription.String
-		expense.Currency = currency.String
-		expense.Amount = amount.Float64
-		expense.UserId = userId.String
-
-		if date.Valid {
-			expense.Date = date.Time.Format(dateFormat)
-		}
-
 		expenses = append(expenses, expense)
 	}
 
-	if asExcel {
-		handleExcelExpenses(c, expenses)
-		return
-	}
-
 	expenseList.Total, err = api.GetTotal(countQ, stms)
 	if err != nil {
 		log.Println(err)
@@ -247,6 +308,11 @@ func (api *API) GetExpenses(c *gin.Context) {
 		return
 	}
 
+	if err := api.setExpenseSplits(expenses); err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	expenseList.Expenses = expenses
 	expenseList.Limit = limit
 	expenseList.Page = page
@@ -254,6 +320,130 @@ func (api *API) GetExpenses(c *gin.Context) {
 	c.JSON(http.StatusOK, expenseList)
 }
 
+var expensesFromQ = `
+		FROM expenses e
+		JOIN products p ON e.product_id = p.id AND NOT p.deleted
+		JOIN categories c ON p.category_id = c.id`
+
+// expensesSelectQ selects the columns scanExpense reads of the expenses
+// matching filterQ, their converted amount last when baseCurrency is set
+func expensesSelectQ(filterQ string, stms []interface{}, baseCurrency string) (string, []interface{}) {
+	selectQ := `SELECT
+			e.id, p.category_id, c.name, c.description, p.id,
+			p.name, p.description, e.date, e.currency, e.amount,
+			e.user_id, e.created_at, e.updated_at, e.account_id,
+			` + tagNamesQ("expenses", "e.id")
+
+	if baseCurrency != "" {
+		target := fmt.Sprintf("$%d", len(stms)+1)
+		selectQ += ", " + convertedQ("e", "e.amount", target) + expensesFromQ + rateJoinQ("e", target)
+		stms = append(append([]interface{}{}, stms...), baseCurrency)
+	} else {
+		selectQ += expensesFromQ
+	}
+
+	return selectQ + `
+		WHERE NOT e.deleted` + filterQ, stms
+}
+
+// exportExpenses walks the whole filtered list through a cursor into the
+// excel or the csv export
+func (api *API) exportExpenses(c *gin.Context, q string, stms []interface{}, baseCurrency string, asCSV bool) {
+	// the excel export shows the amounts in the format of their currency
+	var currencies map[string]models.Currency
+	if !asCSV {
+		var err error
+		if currencies, err = api.getCurrencies(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	cur, err := api.openExportCursor(q, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer cur.Close()
+
+	if !asCSV {
+		handleExcelExpenses(c, cur, baseCurrency, currencies)
+		return
+	}
+
+	header := []string{"id", "date", "category_id", "category_name", "product_id", "product_name",
+		"currency", "amount", "account_id", "tags", "user_id"}
+	if baseCurrency != "" {
+		header = append(header, "base_currency", "converted_amount")
+	}
+
+	streamCSV(c, "expenses", header, cur, func() ([]string, error) {
+		expense, err := scanExpense(cur, baseCurrency != "")
+		if err != nil {
+			return nil, err
+		}
+
+		record := []string{expense.Id, expense.Date, expense.CategoryId, expense.CategoryName,
+			expense.ProductId, expense.ProductName, expense.Currency, csvAmount(&expense.Amount),
+			expense.AccountId, strings.Join(expense.Tags, ";"), expense.UserId}
+		if baseCurrency != "" {
+			record = append(record, baseCurrency, csvAmount(expense.ConvertedAmount))
+		}
+
+		return record, nil
+	})
+}
+
+// scanExpense reads a row of the GetExpenses list, converted tells whether
+// it ends with the converted amount
+func scanExpense(rows rowScanner, converted bool) (expense models.Expense, err error) {
+	var categoryId, categoryName, categoryDescription, productId,
+		productName, productDescription, currency, userId, accountId sql.NullString
+
+	var amount, convertedAmount sql.NullFloat64
+
+	var date sql.NullTime
+	var tags pq.StringArray
+
+	dest := []interface{}{&expense.Id, &categoryId, &categoryName, &categoryDescription, &productId,
+		&productName, &productDescription, &date, &currency, &amount,
+		&userId, &expense.CreatedAt, &expense.UpdatedAt, &accountId, &tags}
+
+	if converted {
+		dest = append(dest, &convertedAmount)
+	}
+
+	if err = rows.Scan(dest...); err != nil {
+		return
+	}
+
+	expense.CategoryId = categoryId.String
+	expense.CategoryName = categoryName.String
+	expense.CategoryDescription = categoryDescription.String
+	expense.ProductId = productId.String
+	expense.ProductName = productName.String
+	expense.ProductDescription = productDescription.String
+	expense.Currency = currency.String
+	expense.Amount = amount.Float64
+	expense.UserId = userId.String
+	expense.AccountId = accountId.String
+	expense.Tags = []string(tags)
+
+	if date.Valid {
+		expense.Date = date.Time.Format(dateFormat)
+	}
+
+	if convertedAmount.Valid {
+		converted := roundAmount(convertedAmount.Float64)
+		expense.ConvertedAmount = &converted
+	}
+
+	return
+}
+
 func (api *API) UpsertExpenses(c *gin.Context) {
 	u := ParsePayload(c)
 	var payload models.UpsertExpenseRequest
@@ -270,6 +460,13 @@ func (api *API) UpsertExpenses(c *gin.Context) {
 		return
 	}
 
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	var errExpenses []models.RowError
 	tx, err := api.Db.Begin()
 	if err != nil {
@@ -285,6 +482,8 @@ func (api *API) UpsertExpenses(c *gin.Context) {
 		customer = true
 	}
 
+	rules := newCategoriser()
+	matches := []models.RuleMatch{}
 	for i, expense := range expenses {
 		if customer {
 			expense.UserId = u.Id
@@ -294,22 +493,24 @@ func (api *API) UpsertExpenses(c *gin.Context) {
 			expense.Id = uuid.Must(uuid.NewV4()).String()
 		}
 
-		if err := validateExpense(&expense); err != nil {
+		if err := rules.categorise(tx, &expense); err != nil {
 			errExpenses = append(errExpenses, models.RowError{Row: i + 1, Message: err.Error()})
 			continue
 		}
 
-		if _, err := tx.Exec(`
-		INSERT INTO expenses
-		(id, product_id, date, user_id, created_at, updated_at, currency, amount)
-		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $5, $6)
-		ON CONFLICT(id) DO UPDATE SET
-		product_id = $2, date = $3, user_id = $4, updated_at = CURRENT_TIMESTAMP, deleted = false, currency = $5, amount = $6
-		`, expense.Id, expense.ProductId, expense.Date, expense.UserId, expense.Currency, expense.Amount); err != nil {
-			log.Println(err)
+		if err := validateExpense(&expense, currencies); err != nil {
 			errExpenses = append(errExpenses, models.RowError{Row: i + 1, Message: err.Error()})
 			continue
 		}
+
+		if err := upsertExpense(tx, expense); err != nil {
+			errExpenses = append(errExpenses, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if expense.RuleId != "" {
+			matches = append(matches, models.RuleMatch{Row: i + 1, RuleId: expense.RuleId})
+		}
 	}
 
 	code := http.StatusInternalServerError
@@ -323,13 +524,114 @@ func (api *API) UpsertExpenses(c *gin.Context) {
 		}
 
 		code = http.StatusOK
-		obj = gin.H{"message": "success", "total": len(expenses)}
+		obj = gin.H{"message": "success", "total": len(expenses), "matches": matches}
 	}
 
 	c.JSON(code, obj)
 }
 
-func getFilterExpense(filter models.ExpenseFilter) (filterQ string, stms []interface{}) {
+// upsertExpense saves a validated expense and replaces its split lines, an
+// expense without lines has none left. The tags are replaced when given.
+func upsertExpense(tx *sql.Tx, expense models.Expense) error {
+	if expense.AccountId != "" {
+		exists, err := accountExists(tx, expense.AccountId, expense.UserId)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return errors.New("account-not-found")
+		}
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO expenses
+		(id, product_id, date, user_id, created_at, updated_at, currency, amount, account_id)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $5, $6, NULLIF($7, '')::UUID)
+		ON CONFLICT(id) DO UPDATE SET
+		product_id = $2, date = $3, user_id = $4, updated_at = CURRENT_TIMESTAMP, deleted = false, currency = $5, amount = $6,
+		account_id = NULLIF($7, '')::UUID
+		`, expense.Id, expense.ProductId, expense.Date, expense.UserId, expense.Currency, expense.Amount, expense.AccountId); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM expense_splits WHERE expense_id = $1", expense.Id); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	for i, split := range expense.Splits {
+		if _, err := tx.Exec(`
+		INSERT INTO expense_splits (expense_id, product_id, amount, position)
+		VALUES ($1, $2, $3, $4)
+		`, expense.Id, split.ProductId, split.Amount, i+1); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+
+	return setTags(tx, "expenses", expense.Id, expense.UserId, expense.Tags)
+}
+
+// setExpenseSplits loads the split lines of the expenses
+func (api *API) setExpenseSplits(expenses []models.Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(expenses))
+	for i, expense := range expenses {
+		ids[i] = expense.Id
+	}
+
+	rows, err := api.Db.Query(`SELECT s.expense_id, s.product_id, p.name, p.category_id, c.name, s.amount
+		FROM expense_splits s
+		JOIN products p ON s.product_id = p.id
+		JOIN categories c ON p.category_id = c.id
+		WHERE s.expense_id = ANY($1)
+		ORDER BY s.position`, pq.Array(ids))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	defer rows.Close()
+
+	splits := map[string][]models.ExpenseSplit{}
+	for rows.Next() {
+		var expenseId string
+		var productName, categoryName sql.NullString
+		var split models.ExpenseSplit
+
+		if err := rows.Scan(&expenseId, &split.ProductId, &productName, &split.CategoryId, &categoryName, &split.Amount); err != nil {
+			log.Println(err)
+			return err
+		}
+
+		split.ProductName = productName.String
+		split.CategoryName = categoryName.String
+		splits[expenseId] = append(splits[expenseId], split)
+	}
+
+	for i := range expenses {
+		expenses[i].Splits = splits[expenses[i].Id]
+	}
+
+	return nil
+}
+
+func getFilterExpense(filter models.ExpenseFilter) (string, []interface{}) {
+	return filterExpense(filter, "e.product_id")
+}
+
+// getFilterExpenseLines filters the lines l of the reports, the product_id of a
+// split expense is the one of its lines
+func getFilterExpenseLines(filter models.ExpenseFilter) (string, []interface{}) {
+	return filterExpense(filter, "l.product_id")
+}
+
+func filterExpense(filter models.ExpenseFilter, productColumn string) (filterQ string, stms []interface{}) {
 	if _, err := uuid.FromString(filter.UserId); err == nil {
 		filterQ = fmt.Sprintf(" AND e.user_id = $%d", len(stms)+1)
 		stms = append(stms, filter.UserId)
@@ -341,16 +643,21 @@ func getFilterExpense(filter models.ExpenseFilter) (filterQ string, stms []inter
 	}
 
 	if _, err := uuid.FromString(filter.ProductId); err == nil {
-		filterQ += fmt.Sprintf(" AND e.product_id = $%d", len(stms)+1)
+		filterQ += fmt.Sprintf(" AND %s = $%d", productColumn, len(stms)+1)
 		stms = append(stms, filter.ProductId)
 	}
 
+	if _, err := uuid.FromString(filter.AccountId); err == nil {
+		filterQ += fmt.Sprintf(" AND e.account_id = $%d", len(stms)+1)
+		stms = append(stms, filter.AccountId)
+	}
+
 	if filter.ProductName != "" {
 		filterQ += fmt.Sprintf(" AND p.name ILIKE $%d", len(stms)+1)
 		stms = append(stms, "%"+filter.ProductName+"%")
 	}
 
-	if filter.Currency == "IDR" || filter.Currency == "USD" {
+	if isCurrencyCode(filter.Currency) {
 		filterQ += fmt.Sprintf(" AND e.currency = $%d", len(stms)+1)
 		stms = append(stms, filter.Currency)
 	}
@@ -385,10 +692,20 @@ func getFilterExpense(filter models.ExpenseFilter) (filterQ string, stms []inter
 		stms = append(stms, filter.MaxAmount)
 	}
 
+	if len(filter.Tags) > 0 {
+		tagsQ, tags := tagsFilterQ("expenses", "e.id", filter.Tags, filter.TagsMatch, len(stms)+1)
+		filterQ += tagsQ
+		stms = append(stms, tags)
+	}
+
 	return
 }
 
-func validateExpense(expense *models.Expense) error {
+func validateExpense(expense *models.Expense, currencies map[string]models.Currency) error {
+	// a split expense is filed under the product of its first line
+	if expense.ProductId == "" && len(expense.Splits) > 0 {
+		expense.ProductId = expense.Splits[0].ProductId
+	}
 
 	if expense.ProductId == "" {
 		return errors.New("missing-product-id")
@@ -414,6 +731,10 @@ func validateExpense(expense *models.Expense) error {
 		return errors.New("invalid-product-id")
 	}
 
+	if _, err := uuid.FromString(expense.AccountId); expense.AccountId != "" && err != nil {
+		return errors.New("invalid-account-id")
+	}
+
 	date, err := time.Parse(dateFormat, expense.Date)
 	if err != nil {
 		return errors.New("invalid-date(yyyy-mm-dd)")
@@ -423,10 +744,45 @@ func validateExpense(expense *models.Expense) error {
 		return errors.New("date-shall-be-a-past-date")
 	}
 
-	// currently only allow USD and IDR
-	expense.Currency = strings.ToUpper(expense.Currency)
-	if expense.Currency != "USD" && expense.Currency != "IDR" {
-		return errors.New("only-usd-or-idr-currency-are-allowed")
+	if err := validateAmountCurrency(&expense.Currency, expense.Amount, currencies); err != nil {
+		return err
+	}
+
+	if expense.Tags, err = normalizeTags(expense.Tags); err != nil {
+		return err
+	}
+
+	return validateExpenseSplits(*expense, currencies)
+}
+
+func validateExpenseSplits(expense models.Expense, currencies map[string]models.Currency) error {
+	if len(expense.Splits) == 0 {
+		return nil
+	}
+
+	var sum float64
+	for _, split := range expense.Splits {
+		if _, err := uuid.FromString(split.ProductId); err != nil {
+			return errors.New("invalid-split-product-id")
+		}
+
+		if split.Amount == 0 {
+			return errors.New("missing-split-amount")
+		}
+
+		if split.Amount < 0 {
+			return errors.New("split-amount-shall-be-positive")
+		}
+
+		if err := validateAmountCurrency(&expense.Currency, split.Amount, currencies); err != nil {
+			return err
+		}
+
+		sum += split.Amount
+	}
+
+	if roundAmount(sum) != roundAmount(expense.Amount) {
+		return errors.New("splits-sum-mismatch")
 	}
 
 	return nil
@@ -436,8 +792,14 @@ func (api *API) DeleteExpenses(c *gin.Context) {
 	api.BatchDeletes(c, "expenses")
 }
 
-func handleExcelExpenses(c *gin.Context, expenses []models.Expense) {
-	if len(expenses) == 0 {
+func handleExcelExpenses(c *gin.Context, cur *exportCursor, baseCurrency string, currencies map[string]models.Currency) {
+	if !cur.Next() {
+		if err := cur.Err(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
 		sendError(c, http.StatusNotFound, "expenses-not-found")
 		return
 	}
@@ -449,7 +811,7 @@ func handleExcelExpenses(c *gin.Context, expenses []models.Expense) {
 	// delete default sheet
 	f.DeleteSheet("Sheet1")
 
-	err := f.SetColWidth(sheet, "A", "F", 50)
+	err := f.SetColWidth(sheet, "A", "H", 50)
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -473,21 +835,32 @@ func handleExcelExpenses(c *gin.Context, expenses []models.Expense) {
 		return
 	}
 
-	if err = streamWriter.SetRow("A1", []interface{}{
+	header := []interface{}{
 		excelize.Cell{StyleID: headerStyle, Value: "Category"},
 		excelize.Cell{StyleID: headerStyle, Value: "Product Name"},
 		excelize.Cell{StyleID: headerStyle, Value: "Product Description"},
 		excelize.Cell{StyleID: headerStyle, Value: "Currency"},
 		excelize.Cell{StyleID: headerStyle, Value: "Amount"},
-		excelize.Cell{StyleID: headerStyle, Value: "Date"}}); err != nil {
+		excelize.Cell{StyleID: headerStyle, Value: "Date"}}
+
+	if baseCurrency != "" {
+		header = append(header, excelize.Cell{StyleID: headerStyle, Value: "Amount (" + baseCurrency + ")"})
+	}
+
+	// the id lets an edited sheet be imported back
+	header = append(header, excelize.Cell{StyleID: headerStyle, Value: "ID"})
+
+	if err = streamWriter.SetRow("A1", header); err != nil {
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	for n, expense := range expenses {
-		amountFormatted := fmt.Sprintf("$%s", humanize.Commaf(expense.Amount))
-		if expense.Currency == "IDR" {
-			amountFormatted = strings.ReplaceAll(fmt.Sprintf("Rp %s", humanize.Commaf(expense.Amount)), ",", ".")
+	for n := 0; ; n++ {
+		expense, err := scanExpense(cur, baseCurrency != "")
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
 		}
 
 		row := make([]interface{}, 6)
@@ -495,14 +868,30 @@ func handleExcelExpenses(c *gin.Context, expenses []models.Expense) {
 		row[1] = excelize.Cell{StyleID: dataStyle, Value: expense.ProductName}
 		row[2] = excelize.Cell{StyleID: dataStyle, Value: expense.ProductDescription}
 		row[3] = excelize.Cell{StyleID: dataStyle, Value: expense.Currency}
-		row[4] = excelize.Cell{StyleID: dataStyle, Value: amountFormatted}
+		row[4] = excelize.Cell{StyleID: dataStyle, Value: formatAmount(expense.Currency, expense.Amount, currencies)}
 		row[5] = excelize.Cell{StyleID: dataStyle, Value: expense.Date}
 
+		if baseCurrency != "" {
+			row = append(row, excelize.Cell{StyleID: dataStyle, Value: formatConvertedAmount(baseCurrency, expense.ConvertedAmount, currencies)})
+		}
+
+		row = append(row, excelize.Cell{StyleID: dataStyle, Value: expense.Id})
+
 		cell, _ := excelize.CoordinatesToCellName(1, n+2)
 		if err = streamWriter.SetRow(cell, row); err != nil {
 			sendError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
+
+		if !cur.Next() {
+			break
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	if err := streamWriter.Flush(); err != nil {
@@ -522,47 +911,3 @@ func handleExcelExpenses(c *gin.Context, expenses []models.Expense) {
 	}
 
 }
-
-func (api *API) getTotalIdrUsd(currency, q string, stms []interface{}) (totalIdr, totalUsd float64, err error) {
-	var sqlIdr, sqlUsd sql.NullFloat64
-
-	if currency == "IDR" {
-		err = api.Db.QueryRow(q, stms...).Scan(&sqlIdr)
-		if err != nil {
-			log.Println(err)
-		}
-		totalIdr = sqlIdr.Float64
-		return
-	}
-
-	if currency == "USD" {
-		err = api.Db.QueryRow(q, stms...).Scan(&sqlUsd)
-		if err != nil {
-			log.Println(err)
-		}
-		totalUsd = sqlUsd.Float64
-		return
-	}
-
-	// get both
-	q += fmt.Sprintf(" AND e.currency = $%d", len(stms)+1)
-	stms = append(stms, "IDR")
-
-	err = api.Db.QueryRow(q, stms...).Scan(&sqlIdr)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	stms[len(stms)-1] = "USD"
-	err = api.Db.QueryRow(q, stms...).Scan(&sqlUsd)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	totalIdr = sqlIdr.Float64
-	totalUsd = sqlUsd.Float64
-
-	return
-}
@@ -27,12 +27,13 @@ func TestGetExpensesReport(t *testing.T) {
 
 	// err select sum (500)
 	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
 	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnError(errors.New("err-select-sum-idr"))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WillReturnError(errors.New("err-select-sum"))
 
 	req, _ := http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=all&min_date=2020-01-01&max_date=2020-02-02", nil)
 	c.Request = req
@@ -41,27 +42,32 @@ func TestGetExpensesReport(t *testing.T) {
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "err-select-sum-idr", genericResp.Message)
+	assert.Equal(t, "err-select-sum", genericResp.Message)
 
+	// err scan sum (500)
+	totalLabel := []string{"currency", "sum"}
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnError(errors.New("err-select-sum-idr"))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").
+		WithArgs("3e80f025-ff3c-4b25-a7bc-883a3c432236", "EUR", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(totalLabel[1:]).AddRow(1000))
 
-	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=IDR&min_date=2020-01-01&max_date=2020-02-02", nil)
+	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=EUR&min_date=2020-01-01&max_date=2020-02-02", nil)
 	c.Request = req
 	api.GetExpensesReport(c)
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "err-select-sum-idr", genericResp.Message)
+	assert.Equal(t, "sql: expected 1 destination arguments in Scan, not 2", genericResp.Message)
 
+	// err select report (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnError(errors.New("err-select-sum-usd"))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WillReturnRows(sqlmock.NewRows(totalLabel).AddRow("IDR", 1000))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").WillReturnError(errors.New("err-select-report"))
 
 	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=all&min_date=2020-01-01&max_date=2020-02-02", nil)
 	c.Request = req
@@ -70,85 +76,164 @@ func TestGetExpensesReport(t *testing.T) {
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "err-select-sum-usd", genericResp.Message)
+	assert.Equal(t, "err-select-report", genericResp.Message)
 
+	// err scan report (500)
+	label := []string{"currency", "category_id", "category_name", "amount"}
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnError(errors.New("err-select-sum-usd"))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WillReturnRows(sqlmock.NewRows(totalLabel).AddRow("IDR", 1000))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").WillReturnRows(sqlmock.NewRows(label[1:]).AddRow(mockID, "test", 1234))
 
-	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=USD&min_date=2020-01-01&max_date=2020-02-02", nil)
+	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=all&min_date=2020-01-01&max_date=2020-02-02", nil)
 	c.Request = req
 	api.GetExpensesReport(c)
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "err-select-sum-usd", genericResp.Message)
+	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 4", genericResp.Message)
 
-	// err select report (500)
+	// err select base currency (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
-	dbMock.ExpectQuery("SELECT e.currency.*").WillReturnError(errors.New("err-select-report"))
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).WillReturnError(errors.New("err-select-base-currency"))
 
-	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=all&min_date=2020-01-01&max_date=2020-02-02", nil)
+	req, _ = http.NewRequest("GET", "", nil)
 	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
 	api.GetExpensesReport(c)
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "err-select-report", genericResp.Message)
+	assert.Equal(t, "err-select-base-currency", genericResp.Message)
 
-	// err scan report (500)
-	label := []string{"currency", "category_id", "category_name", "amount"}
+	// (200)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
-	dbMock.ExpectQuery("SELECT e.currency.*").WillReturnRows(sqlmock.NewRows(label[1:]).AddRow(mockID, "test", 1234))
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").
+		WillReturnRows(sqlmock.NewRows(totalLabel).
+			AddRow("IDR", 20000).
+			AddRow("USD", 35).
+			AddRow("JPY", 1200))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow("IDR", mockID, "test", 5000).
+			AddRow("IDR", mockID, "test", 15000).
+			AddRow("USD", mockID, "test", 15).
+			AddRow("USD", mockID, "test", 20).
+			AddRow("JPY", mockID, "test", 1200))
 
 	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=all&min_date=2020-01-01&max_date=2020-02-02", nil)
 	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpensesReport(c)
+
+	var report models.ExpenseReport
+
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(20000), report.Totals["IDR"])
+	assert.Equal(t, float64(35), report.Totals["USD"])
+	assert.Equal(t, float64(1200), report.Totals["JPY"])
+	assert.Equal(t, 2, len(report.Reports["IDR"]))
+	assert.Equal(t, 2, len(report.Reports["USD"]))
+	assert.Equal(t, 1, len(report.Reports["JPY"]))
+	assert.Equal(t, true, report.Converted == nil)
+
+	// invalid base currency (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("GET", "?base_currency=rupiah", nil)
+	c.Request = req
 	api.GetExpensesReport(c)
 
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 4", genericResp.Message)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-base-currency", genericResp.Message)
 
-	// (200)
+	// err select converted (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(20000))
-	dbMock.ExpectQuery("SELECT SUM.*").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(35))
-	dbMock.ExpectQuery("SELECT e.currency.*").
-		WillReturnRows(sqlmock.NewRows(label).
-			AddRow("IDR", mockID, "test", 5000).
-			AddRow("IDR", mockID, "test", 15000).
-			AddRow("USD", mockID, "test", 15).
-			AddRow("USD", mockID, "test", 20))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WillReturnRows(sqlmock.NewRows(totalLabel).AddRow("IDR", 20000))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").WillReturnRows(sqlmock.NewRows(label).AddRow("IDR", mockID, "test", 20000))
+	dbMock.ExpectQuery("SELECT c.id, c.name.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "USD").WillReturnError(errors.New("err-select-converted"))
 
-	req, _ = http.NewRequest("GET", "?category_id=3e80f025-ff3c-4b25-a7bc-883a3c432236&currency=all&min_date=2020-01-01&max_date=2020-02-02", nil)
+	req, _ = http.NewRequest("GET", "?base_currency=usd", nil)
 	c.Request = req
 	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
 	api.GetExpensesReport(c)
 
-	var report models.ExpenseReport
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-converted", genericResp.Message)
+
+	// (200) converted
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
 
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").
+		WillReturnRows(sqlmock.NewRows(totalLabel).
+			AddRow("IDR", 20000).
+			AddRow("USD", 35))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow("IDR", mockID, "test", 20000).
+			AddRow("USD", mockID, "test", 35))
+	dbMock.ExpectQuery("SELECT c.id, c.name.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "sum", "missing"}).
+			AddRow(mockID, "test", 36.333, 1).
+			AddRow(mockID2, "test 2", 10, 0))
+
+	req, _ = http.NewRequest("GET", "?base_currency=USD", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpensesReport(c)
+
+	report = models.ExpenseReport{}
 	err = json.NewDecoder(w.Body).Decode(&report)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, float64(20000), report.TotalIdr)
-	assert.Equal(t, float64(35), report.TotalUsd)
-	assert.Equal(t, 2, len(report.ReportsIdr))
-	assert.Equal(t, 2, len(report.ReportsUsd))
+	assert.Equal(t, float64(35), report.Totals["USD"])
+	assert.Equal(t, "USD", report.Converted.BaseCurrency)
+	assert.Equal(t, 46.33, report.Converted.Total)
+	assert.Equal(t, 1, report.Converted.MissingRates)
+	assert.Equal(t, 2, len(report.Converted.Reports))
+	assert.Equal(t, 36.33, report.Converted.Reports[0].Total)
+
+	// (200) converted into the user's base currency
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("IDR"))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WillReturnRows(sqlmock.NewRows(totalLabel).AddRow("IDR", 20000))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").WillReturnRows(sqlmock.NewRows(label).AddRow("IDR", mockID, "test", 20000))
+	dbMock.ExpectQuery("SELECT c.id, c.name.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "IDR").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "sum", "missing"}).AddRow(mockID, "test", 20000, 0))
 
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpensesReport(c)
+
+	report = models.ExpenseReport{}
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "IDR", report.Converted.BaseCurrency)
+	assert.Equal(t, float64(20000), report.Converted.Total)
 }
 
 func TestGetExpenses(t *testing.T) {
@@ -162,6 +247,7 @@ func TestGetExpenses(t *testing.T) {
 
 	// err select (500)
 	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
 	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -195,10 +281,12 @@ func TestGetExpenses(t *testing.T) {
 		"user_id",
 		"created_at",
 		"updated_at",
+		"account_id",
+		"tags",
 	}
 
 	dbMock.ExpectQuery("SELECT e.id.*").
-		WillReturnRows(sqlmock.NewRows(label[10:]).AddRow(mockUserID, time.Now(), time.Now()))
+		WillReturnRows(sqlmock.NewRows(label[10:13]).AddRow(mockUserID, time.Now(), time.Now()))
 
 	req, _ = http.NewRequest("GET", "?order_by=id", nil)
 	c.Request = req
@@ -207,7 +295,7 @@ func TestGetExpenses(t *testing.T) {
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 13", genericResp.Message)
+	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 15", genericResp.Message)
 
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
@@ -216,7 +304,7 @@ func TestGetExpenses(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows(label).
 			AddRow(mockID, mockID, "dummy", "dummy", mockID,
 				"dummy", "dummy", time.Now(), "IDR", 25555,
-				mockUserID, time.Now(), time.Now()))
+				mockUserID, time.Now(), time.Now(), nil, nil))
 	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
 
 	req, _ = http.NewRequest("GET", "", nil)
@@ -229,6 +317,28 @@ func TestGetExpenses(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "err-count", genericResp.Message)
 
+	// err splits (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT e.id.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockID, "dummy", "dummy", mockID,
+				"dummy", "dummy", time.Now(), "IDR", 25555,
+				mockUserID, time.Now(), time.Now(), nil, nil))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	dbMock.ExpectQuery("SELECT s.expense_id.*FROM expense_splits.*").WithArgs(sqlmock.AnyArg()).WillReturnError(errors.New("err-splits"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-splits", genericResp.Message)
+
 	// 200
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
@@ -237,11 +347,16 @@ func TestGetExpenses(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows(label).
 			AddRow(mockID, mockID, "dummy", "dummy", mockID,
 				"dummy", "dummy", time.Now(), "IDR", 25555,
-				mockUserID, time.Now(), time.Now()))
+				mockUserID, time.Now(), time.Now(), mockID, "{food,travel}"))
 	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	dbMock.ExpectQuery("SELECT s.expense_id.*FROM expense_splits.*").
+		WillReturnRows(sqlmock.NewRows([]string{"expense_id", "product_id", "product_name", "category_id", "category_name", "amount"}).
+			AddRow(mockID, mockID, "dummy", mockID, "dummy", 20000).
+			AddRow(mockID, mockID2, "other", mockID2, "other", 5555))
 
 	q := url.Values{}
 	q.Add("category_id", mockID)
+	q.Add("account_id", mockID)
 	q.Add("product_id", mockID)
 	q.Add("product_name", "dummy")
 	q.Add("currency", "IDR")
@@ -251,6 +366,8 @@ func TestGetExpenses(t *testing.T) {
 	q.Add("max_date", "2050-01-01")
 	q.Add("min_amount", "2555")
 	q.Add("max_amount", "5555")
+	q.Add("tags", "Food, travel,")
+	q.Add("tags_match", "all")
 
 	req, _ = http.NewRequest("GET", "", nil)
 	req.URL.RawQuery = q.Encode()
@@ -266,14 +383,86 @@ func TestGetExpenses(t *testing.T) {
 	assert.Equal(t, 1, len(resp.Expenses))
 	assert.Equal(t, mockID, resp.Expenses[0].Id)
 	assert.Equal(t, mockUserID, resp.Expenses[0].UserId)
+	assert.Equal(t, mockID, resp.Expenses[0].AccountId)
+	assert.Equal(t, 2, len(resp.Expenses[0].Splits))
+	assert.Equal(t, "other", resp.Expenses[0].Splits[1].CategoryName)
+	assert.DeepEqual(t, []string{"food", "travel"}, resp.Expenses[0].Tags)
+	assert.Equal(t, true, resp.Expenses[0].ConvertedAmount == nil)
+
+	// invalid base currency (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("GET", "?base_currency=rupiah", nil)
+	c.Request = req
+	api.GetExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-base-currency", genericResp.Message)
+
+	// 200 converted
+	convertedLabel := append(append([]string{}, label...), "converted_amount")
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT e.id.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "USD").
+		WillReturnRows(sqlmock.NewRows(convertedLabel).
+			AddRow(mockID, mockID, "dummy", "dummy", mockID,
+				"dummy", "dummy", time.Now(), "IDR", 25555,
+				mockUserID, time.Now(), time.Now(), nil, nil, 1.7927).
+			AddRow(mockID2, mockID, "dummy", "dummy", mockID,
+				"dummy", "dummy", time.Now(), "EUR", 10,
+				mockUserID, time.Now(), time.Now(), nil, nil, nil))
+	dbMock.ExpectQuery("SELECT COUNT.*").WithArgs(mockUserID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	dbMock.ExpectQuery("SELECT s.expense_id.*FROM expense_splits.*").
+		WillReturnRows(sqlmock.NewRows([]string{"expense_id", "product_id", "product_name", "category_id", "category_name", "amount"}))
+
+	req, _ = http.NewRequest("GET", "?base_currency=usd", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpenses(c)
+
+	resp = models.ExpenseList{}
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, len(resp.Expenses))
+	assert.Equal(t, 1.79, *resp.Expenses[0].ConvertedAmount)
+	assert.Equal(t, true, resp.Expenses[1].ConvertedAmount == nil)
 
 	// as excel
+	// err declare cursor (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DECLARE export_cursor.*SELECT e.id.*").WithArgs(mockUserID).
+		WillReturnError(errors.New("err-declare"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-declare", genericResp.Message)
+
 	// expenses not found (404)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT e.id.*").WithArgs(mockUserID).
-		WillReturnRows(sqlmock.NewRows(label))
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	expectExportCursor(dbMock, "SELECT e.id.*", sqlmock.NewRows(label), mockUserID)
 
 	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
 	c.Request = req
@@ -285,16 +474,23 @@ func TestGetExpenses(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.Equal(t, "expenses-not-found", genericResp.Message)
 
-	// 200
+	// 200 in the user's base currency, the whole list without pagination
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT e.id.*").
-		WillReturnRows(sqlmock.NewRows(label).
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("USD"))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	expectExportCursor(dbMock, "SELECT e.id.*LEFT JOIN LATERAL.*ORDER BY e.updated_at DESC$",
+		sqlmock.NewRows(convertedLabel).
 			AddRow(mockID, mockID, "dummy", "dummy", mockID,
 				"dummy", "dummy", time.Now(), "IDR", 25555,
-				mockUserID, time.Now(), time.Now()))
-	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
+				mockUserID, time.Now(), time.Now(), nil, nil, 1.79).
+			AddRow(mockID2, mockID, "dummy", "dummy", mockID,
+				"dummy", "dummy", time.Now(), "EUR", 10,
+				mockUserID, time.Now(), time.Now(), nil, nil, nil),
+		mockUserID, "USD")
+	req, _ = http.NewRequest("GET", "?export_as_excel=true&page=2", nil)
 	c.Request = req
 	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
 	api.GetExpenses(c)
@@ -306,6 +502,62 @@ func TestGetExpenses(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "attachment;filename=\""+fileName+"\"", w.Header()["Content-Disposition"][0])
 
+	// as csv
+	// 200, the whole list without pagination in raw amounts
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	date := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	expectExportCursor(dbMock, "SELECT e.id.*ORDER BY e.updated_at DESC$",
+		sqlmock.NewRows(label).
+			AddRow(mockID, mockID, "Food", "dummy", mockID,
+				"Coffee", "dummy", date, "IDR", 25555.5,
+				mockUserID, time.Now(), time.Now(), mockID2, "{work,travel}").
+			AddRow(mockID2, mockID, "Food", "dummy", mockID,
+				"Tea", "dummy", date, "IDR", 1000000,
+				mockUserID, time.Now(), time.Now(), nil, nil),
+		mockUserID)
+
+	req, _ = http.NewRequest("GET", "?export=csv&page=3", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpenses(c)
+
+	fileName = fmt.Sprintf("report_expenses_%s.csv", time.Now().In(loc).Format("20060102_150405"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment;filename=\""+fileName+"\"", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id,date,category_id,category_name,product_id,product_name,currency,amount,account_id,tags,user_id\n"+
+		mockID+",2021-03-04,"+mockID+",Food,"+mockID+",Coffee,IDR,25555.5,"+mockID2+",work;travel,"+mockUserID+"\n"+
+		mockID2+",2021-03-04,"+mockID+",Food,"+mockID+",Tea,IDR,1000000,,,"+mockUserID+"\n", w.Body.String())
+
+	// 200 with the converted amounts
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	expectExportCursor(dbMock, "SELECT e.id.*LEFT JOIN LATERAL.*",
+		sqlmock.NewRows(convertedLabel).
+			AddRow(mockID, mockID, "Food", "dummy", mockID,
+				"Coffee", "dummy", date, "IDR", 25555,
+				mockUserID, time.Now(), time.Now(), nil, nil, 1.7927).
+			AddRow(mockID2, mockID, "Food", "dummy", mockID,
+				"Tea", "dummy", date, "EUR", 10,
+				mockUserID, time.Now(), time.Now(), nil, nil, nil),
+		mockUserID, "USD")
+
+	req, _ = http.NewRequest("GET", "?export=CSV&base_currency=usd", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetExpenses(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,date,category_id,category_name,product_id,product_name,currency,amount,account_id,tags,user_id,base_currency,converted_amount\n"+
+		mockID+",2021-03-04,"+mockID+",Food,"+mockID+",Coffee,IDR,25555,,,"+mockUserID+",USD,1.79\n"+
+		mockID2+",2021-03-04,"+mockID+",Food,"+mockID+",Tea,EUR,10,,,"+mockUserID+",USD,\n", w.Body.String())
+
 }
 
 func TestUpsertExpenses(t *testing.T) {
@@ -342,6 +594,24 @@ func TestUpsertExpenses(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, "missing-expenses", genericResp.Message)
 
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertExpenseRequest{Data: []models.Expense{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-select-currencies"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-currencies", genericResp.Message)
+
 	// err begin (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
@@ -349,6 +619,7 @@ func TestUpsertExpenses(t *testing.T) {
 		{},
 	}})
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
 
 	req, _ = http.NewRequest("POST", "", payload)
@@ -381,14 +652,33 @@ func TestUpsertExpenses(t *testing.T) {
 		{Id: mockID, ProductId: mockID, Date: "Y", Currency: "asd", Amount: 5555, UserId: mockUserID},
 		{Id: mockID, ProductId: mockID, Date: dateFuture.Format("2006-01-02"), Currency: "asd", Amount: 5555, UserId: mockUserID},
 		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "asd", Amount: 5555, UserId: mockUserID},
+		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "jpy", Amount: 55.55, UserId: mockUserID},
+		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, AccountId: "err"},
+		{Id: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, Splits: []models.ExpenseSplit{
+			{ProductId: mockID, Amount: 5000}, {ProductId: "err", Amount: 555}}},
+		{Id: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, Splits: []models.ExpenseSplit{
+			{ProductId: mockID, Amount: 5000}, {ProductId: mockID2}}},
+		{Id: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, Splits: []models.ExpenseSplit{
+			{ProductId: mockID, Amount: 5600}, {ProductId: mockID2, Amount: -45}}},
+		{Id: mockID, Date: "2000-01-01", Currency: "JPY", Amount: 5555, UserId: mockUserID, Splits: []models.ExpenseSplit{
+			{ProductId: mockID, Amount: 5000}, {ProductId: mockID2, Amount: 555.5}}},
+		{Id: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, Splits: []models.ExpenseSplit{
+			{ProductId: mockID, Amount: 5000}, {ProductId: mockID2, Amount: 555.01}}},
+		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, Tags: []string{"food", " "}},
+		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, AccountId: mockID2},
+		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, AccountId: mockID},
 		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID},
 	}}
 	dataOK := expenses.Data[len(expenses.Data)-1]
 	payload = parsePayload(expenses)
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID2, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnError(fmt.Errorf("err-account"))
 	dbMock.ExpectExec("INSERT INTO expenses.*").
-		WithArgs(dataOK.Id, dataOK.ProductId, dataOK.Date, dataOK.UserId, dataOK.Currency, dataOK.Amount).WillReturnError(fmt.Errorf("err-insert"))
+		WithArgs(dataOK.Id, dataOK.ProductId, dataOK.Date, dataOK.UserId, dataOK.Currency, dataOK.Amount, dataOK.AccountId).WillReturnError(fmt.Errorf("err-insert"))
 	dbMock.ExpectRollback()
 
 	req, _ = http.NewRequest("POST", "", payload)
@@ -400,7 +690,7 @@ func TestUpsertExpenses(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "error", respErrors.Message)
-	assert.Equal(t, 10, len(respErrors.Details))
+	assert.Equal(t, 20, len(respErrors.Details))
 	assert.Equal(t, "missing-product-id", respErrors.Details[0].Message)
 	assert.Equal(t, "missing-date", respErrors.Details[1].Message)
 	assert.Equal(t, "missing-currency", respErrors.Details[2].Message)
@@ -409,23 +699,50 @@ func TestUpsertExpenses(t *testing.T) {
 	assert.Equal(t, "invalid-product-id", respErrors.Details[5].Message)
 	assert.Equal(t, "invalid-date(yyyy-mm-dd)", respErrors.Details[6].Message)
 	assert.Equal(t, "date-shall-be-a-past-date", respErrors.Details[7].Message)
-	assert.Equal(t, "only-usd-or-idr-currency-are-allowed", respErrors.Details[8].Message)
-	assert.Equal(t, "err-insert", respErrors.Details[9].Message)
+	assert.Equal(t, "unsupported-currency", respErrors.Details[8].Message)
+	assert.Equal(t, "amount-exceeds-currency-minor-unit", respErrors.Details[9].Message)
+	assert.Equal(t, "invalid-account-id", respErrors.Details[10].Message)
+	assert.Equal(t, "invalid-split-product-id", respErrors.Details[11].Message)
+	assert.Equal(t, "missing-split-amount", respErrors.Details[12].Message)
+	assert.Equal(t, "split-amount-shall-be-positive", respErrors.Details[13].Message)
+	assert.Equal(t, "amount-exceeds-currency-minor-unit", respErrors.Details[14].Message)
+	assert.Equal(t, "splits-sum-mismatch", respErrors.Details[15].Message)
+	assert.Equal(t, "invalid-tag", respErrors.Details[16].Message)
+	assert.Equal(t, "account-not-found", respErrors.Details[17].Message)
+	assert.Equal(t, "err-account", respErrors.Details[18].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[19].Message)
 
 	// err commit (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 	expenses = models.UpsertExpenseRequest{Data: []models.Expense{
-		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID},
-		{Id: mockID2, ProductId: mockID, Date: "2000-01-01", Currency: "IDR", Amount: 5555, UserId: mockUserID},
-		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "IDR", Amount: 5555, UserId: mockUserID},
+		{Id: mockID, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5555, UserId: mockUserID, Tags: []string{"Food", " food", "Travel"}},
+		{Id: mockID2, ProductId: mockID, Date: "2000-01-01", Currency: "IDR", Amount: 5555, UserId: mockUserID, AccountId: mockID2},
+		{Id: mockID, Date: "2000-01-01", Currency: "IDR", Amount: 5555, UserId: mockUserID, Splits: []models.ExpenseSplit{
+			{ProductId: mockID, Amount: 5000}, {ProductId: mockID2, Amount: 555}}},
 	}}
 	payload = parsePayload(expenses)
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin()
 	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
-	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
-	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM expense_tags.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "food").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO expense_tags.*").WithArgs(mockID, mockID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "travel").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID2))
+	dbMock.ExpectExec("INSERT INTO expense_tags.*").WithArgs(mockID, mockID2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID2, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(mockID2, mockID, "2000-01-01", mockUserID, "IDR", 5555.0, mockID2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WithArgs(mockID2).WillReturnResult(sqlmock.NewResult(0, 0))
+	// split expense filed under the product of its first line
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(mockID, mockID, "2000-01-01", mockUserID, "IDR", 5555.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectExec("INSERT INTO expense_splits.*").WithArgs(mockID, mockID, 5000.0, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO expense_splits.*").WithArgs(mockID, mockID2, 555.0, 2).WillReturnResult(sqlmock.NewResult(0, 1))
 	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
 
 	req, _ = http.NewRequest("POST", "", payload)
@@ -447,10 +764,26 @@ func TestUpsertExpenses(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin()
 	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
-	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
-	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM expense_tags.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "food").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO expense_tags.*").WithArgs(mockID, mockID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "travel").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID2))
+	dbMock.ExpectExec("INSERT INTO expense_tags.*").WithArgs(mockID, mockID2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID2, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(mockID2, mockID, "2000-01-01", mockUserID, "IDR", 5555.0, mockID2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WithArgs(mockID2).WillReturnResult(sqlmock.NewResult(0, 0))
+	// split expense filed under the product of its first line
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(mockID, mockID, "2000-01-01", mockUserID, "IDR", 5555.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectExec("INSERT INTO expense_splits.*").WithArgs(mockID, mockID, 5000.0, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO expense_splits.*").WithArgs(mockID, mockID2, 555.0, 2).WillReturnResult(sqlmock.NewResult(0, 1))
 	dbMock.ExpectCommit()
 
 	payload = parsePayload(expenses)
@@ -464,6 +797,46 @@ func TestUpsertExpenses(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "success", respSuccess.Message)
 	assert.Equal(t, 3, respSuccess.Total)
+
+	// product from the rules (200)
+	respMatches := struct {
+		Message string             `json:"message"`
+		Matches []models.RuleMatch `json:"matches"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	expenses = models.UpsertExpenseRequest{Data: []models.Expense{
+		{Id: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5, Payee: "GRAB* RIDE", RuleId: mockID},
+		{Id: mockID2, ProductId: mockID, Date: "2000-01-01", Currency: "USD", Amount: 5, Payee: "Grab ride"},
+	}}
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT r.id, r.product_id.*FROM categorisation_rules.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "payee_contains", "payee_regex", "min_amount", "max_amount", "currency"}).
+			AddRow(mockID, mockID, "grab", "", 10, nil, "").
+			AddRow(mockID2, mockID2, "grab", "", nil, nil, "USD"))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(mockID, mockID2, "2000-01-01", mockUserID, "USD", 5.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(mockID2, mockID, "2000-01-01", mockUserID, "USD", 5.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+
+	payload = parsePayload(expenses)
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respMatches)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, len(respMatches.Matches))
+	assert.Equal(t, 1, respMatches.Matches[0].Row)
+	assert.Equal(t, mockID2, respMatches.Matches[0].RuleId)
 }
 
 func TestDeleteExpenses(t *testing.T) {
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportBatchRows is how many rows an export fetches from its cursor at once,
+// the csv exports are flushed to the client after each batch too
+const exportBatchRows = 500
+
+// rowScanner is what the scan helpers read a row from, the list's rows or an
+// export cursor
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// exportCursor walks the whole result of an export query through a server
+// side cursor, so only a batch of rows is held at any time whatever the size
+// of the export
+type exportCursor struct {
+	tx   *sql.Tx
+	rows *sql.Rows
+	n    int
+	err  error
+}
+
+// openExportCursor declares the cursor for q in a transaction of its own and
+// fetches the first batch, Close must be called once done
+func (api *API) openExportCursor(q string, stms []interface{}) (*exportCursor, error) {
+	log.Println(q)
+
+	tx, err := api.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DECLARE export_cursor NO SCROLL CURSOR FOR "+q, stms...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	cur := &exportCursor{tx: tx}
+	if err = cur.fetch(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return cur, nil
+}
+
+func (cur *exportCursor) fetch() error {
+	if cur.rows != nil {
+		cur.rows.Close()
+	}
+
+	cur.n = 0
+	cur.rows, cur.err = cur.tx.Query(fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportBatchRows))
+
+	return cur.err
+}
+
+// Next moves to the next row, fetching the next batch once the current one
+// is used up. A short batch means the cursor is at its end.
+func (cur *exportCursor) Next() bool {
+	if cur.err != nil {
+		return false
+	}
+
+	if !cur.rows.Next() {
+		if cur.err = cur.rows.Err(); cur.err != nil || cur.n < exportBatchRows {
+			return false
+		}
+
+		if cur.fetch() != nil || !cur.rows.Next() {
+			if cur.err == nil {
+				cur.err = cur.rows.Err()
+			}
+			return false
+		}
+	}
+
+	cur.n++
+
+	return true
+}
+
+func (cur *exportCursor) Scan(dest ...interface{}) error {
+	return cur.rows.Scan(dest...)
+}
+
+// batchDone tells whether the row Next moved to ends a batch
+func (cur *exportCursor) batchDone() bool {
+	return cur.n == exportBatchRows
+}
+
+func (cur *exportCursor) Err() error {
+	return cur.err
+}
+
+// Close ends the transaction, the export only reads so it is rolled back
+func (cur *exportCursor) Close() {
+	if cur.rows != nil {
+		cur.rows.Close()
+	}
+
+	cur.tx.Rollback()
+}
+
+// streamCSV sends the header and then a record per row of the cursor as a
+// csv file, flushing after each batch so the export is never held in memory.
+// Once the header is out an error can only cut the file short.
+func streamCSV(c *gin.Context, name string, header []string, cur *exportCursor, record func() ([]string, error)) {
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	fileName := fmt.Sprintf("report_%s_%s.csv", name, time.Now().In(loc).Format("20060102_150405"))
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment;filename=\""+fileName+"\"")
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write(header); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for cur.Next() {
+		values, err := record()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		if err := writer.Write(values); err != nil {
+			log.Println(err)
+			return
+		}
+
+		if cur.batchDone() {
+			writer.Flush()
+			c.Writer.Flush()
+		}
+	}
+
+	writer.Flush()
+
+	if err := cur.Err(); err != nil {
+		log.Println(err)
+	}
+}
+
+// csvAmount writes the amounts as raw numbers, no amount is an empty field
+func csvAmount(amount *float64) string {
+	if amount == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(*amount, 'f', -1, 64)
+}
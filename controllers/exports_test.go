@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestStreamCSV(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	record := func(cur *exportCursor) func() ([]string, error) {
+		return func() ([]string, error) {
+			var id string
+			err := cur.Scan(&id)
+			return []string{id}, err
+		}
+	}
+
+	// a full batch fetches the next one until a short batch
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	batch := sqlmock.NewRows([]string{"id"})
+	for i := 0; i < exportBatchRows; i++ {
+		batch.AddRow(fmt.Sprint(i))
+	}
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DECLARE export_cursor NO SCROLL CURSOR FOR SELECT id FROM t").WithArgs("a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("FETCH FORWARD 500 FROM export_cursor").WillReturnRows(batch)
+	dbMock.ExpectQuery("FETCH FORWARD 500 FROM export_cursor").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("last"))
+	dbMock.ExpectRollback()
+
+	cur, err := api.openExportCursor("SELECT id FROM t", []interface{}{"a"})
+	assert.Equal(t, nil, err)
+
+	streamCSV(c, "t", []string{"id"}, cur, record(cur))
+	cur.Close()
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, exportBatchRows+2, len(lines))
+	assert.Equal(t, "499", lines[exportBatchRows])
+	assert.Equal(t, "last", lines[exportBatchRows+1])
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	// a failing fetch cuts the file short
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	batch = sqlmock.NewRows([]string{"id"})
+	for i := 0; i < exportBatchRows; i++ {
+		batch.AddRow(fmt.Sprint(i))
+	}
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DECLARE export_cursor.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("FETCH FORWARD.*").WillReturnRows(batch)
+	dbMock.ExpectQuery("FETCH FORWARD.*").WillReturnError(errors.New("err-fetch"))
+	dbMock.ExpectRollback()
+
+	cur, err = api.openExportCursor("SELECT id FROM t", nil)
+	assert.Equal(t, nil, err)
+
+	streamCSV(c, "t", []string{"id"}, cur, record(cur))
+	cur.Close()
+
+	lines = strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	assert.Equal(t, exportBatchRows+1, len(lines))
+	assert.Equal(t, "err-fetch", cur.Err().Error())
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,658 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+// importDateReplacer turns a date format like dd/mm/yyyy into a time layout
+var importDateReplacer = strings.NewReplacer("yyyy", "2006", "yy", "06", "mm", "01", "dd", "02")
+
+// the headers of the excel exports, keyed by field
+var (
+	expenseExcelColumns = map[string]string{
+		"id": "ID", "category": "Category", "product_name": "Product Name",
+		"currency": "Currency", "amount": "Amount", "date": "Date"}
+	incomeExcelColumns = map[string]string{
+		"id": "ID", "name": "Name", "description": "Description",
+		"currency": "Currency", "amount": "Amount", "date": "Date"}
+	productExcelColumns = map[string]string{
+		"id": "ID", "category": "Category", "name": "Name", "description": "Description"}
+)
+
+// ImportExpenses upserts the expenses of a csv file, with dry_run=true the
+// parsed rows are returned and nothing is saved
+func (api *API) ImportExpenses(c *gin.Context) {
+	u := ParsePayload(c)
+	mapping, rows, err := readImport(c,
+		[]string{"id", "user_id", "date", "amount", "currency", "product_id", "account_id", "tags", "payee"}, "date", "amount")
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rules := newCategoriser()
+	api.importRows(c, len(rows), func(tx *sql.Tx, i int) (interface{}, error) {
+		var err error
+		row := rows[i]
+		expense := models.Expense{
+			Id:        row["id"],
+			UserId:    row["user_id"],
+			Currency:  row["currency"],
+			ProductId: row["product_id"],
+			AccountId: row["account_id"],
+			Tags:      parseImportTags(row["tags"]),
+			Payee:     row["payee"],
+		}
+
+		if expense.Currency == "" {
+			expense.Currency = mapping.Currency
+		}
+
+		if expense.AccountId == "" {
+			expense.AccountId = mapping.AccountId
+		}
+
+		if expense.Date, err = parseImportDate(row["date"], mapping.DateFormat); err != nil {
+			return nil, err
+		}
+
+		if expense.Amount, err = parseImportAmount(row["amount"], mapping.DecimalSeparator); err != nil {
+			return nil, err
+		}
+
+		if u.Role == string(models.Customer) {
+			expense.UserId = u.Id
+		}
+
+		// the rules come before the product of the mapping
+		if err := rules.categorise(tx, &expense); err != nil {
+			return nil, err
+		}
+
+		if expense.ProductId == "" {
+			expense.ProductId = mapping.ProductId
+		}
+
+		if _, err := uuid.FromString(expense.Id); err != nil {
+			expense.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateExpense(&expense, currencies); err != nil {
+			return nil, err
+		}
+
+		return expense, upsertExpense(tx, expense)
+	})
+}
+
+// ImportIncomes upserts the incomes of a csv file, with dry_run=true the
+// parsed rows are returned and nothing is saved
+func (api *API) ImportIncomes(c *gin.Context) {
+	u := ParsePayload(c)
+	mapping, rows, err := readImport(c,
+		[]string{"id", "user_id", "name", "description", "date", "amount", "currency", "account_id", "tags"}, "date", "amount")
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	api.importRows(c, len(rows), func(tx *sql.Tx, i int) (interface{}, error) {
+		var err error
+		row := rows[i]
+		income := models.Income{
+			Id:          row["id"],
+			UserId:      row["user_id"],
+			Name:        row["name"],
+			Description: row["description"],
+			Currency:    row["currency"],
+			AccountId:   row["account_id"],
+			Tags:        parseImportTags(row["tags"]),
+		}
+
+		if income.Currency == "" {
+			income.Currency = mapping.Currency
+		}
+
+		if income.AccountId == "" {
+			income.AccountId = mapping.AccountId
+		}
+
+		if income.Date, err = parseImportDate(row["date"], mapping.DateFormat); err != nil {
+			return nil, err
+		}
+
+		if income.Amount, err = parseImportAmount(row["amount"], mapping.DecimalSeparator); err != nil {
+			return nil, err
+		}
+
+		if u.Role == string(models.Customer) {
+			income.UserId = u.Id
+		}
+
+		if _, err := uuid.FromString(income.Id); err != nil {
+			income.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateIncome(&income, currencies); err != nil {
+			return nil, err
+		}
+
+		return income, upsertIncome(tx, income)
+	})
+}
+
+// ImportExcelExpenses reads back a sheet of the expenses export. The sheets
+// carry no owner, the rows are imported for the caller.
+func (api *API) ImportExcelExpenses(c *gin.Context) {
+	u := ParsePayload(c)
+	rows, err := readExcelImport(c, expenseExcelColumns, "category", "product_name", "currency", "amount", "date")
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	api.importRows(c, len(rows), func(tx *sql.Tx, i int) (interface{}, error) {
+		var err error
+		row := rows[i]
+		expense := models.Expense{
+			Id:           row["id"],
+			UserId:       u.Id,
+			CategoryName: row["category"],
+			ProductName:  row["product_name"],
+			Currency:     strings.ToUpper(row["currency"]),
+			Date:         row["date"],
+		}
+
+		if expense.Amount, err = parseExportAmount(expense.Currency, row["amount"], currencies); err != nil {
+			return nil, err
+		}
+
+		expense.ProductId, err = productIdByName(tx, expense.UserId, expense.CategoryName, expense.ProductName)
+		if err == sql.ErrNoRows {
+			return nil, errors.New("product-not-found")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := uuid.FromString(expense.Id); err != nil {
+			expense.Id = uuid.Must(uuid.NewV4()).String()
+		} else if expense.AccountId, err = savedAccountId(tx, "expenses", expense.Id, expense.UserId); err != nil {
+			return nil, err
+		} else if expense.Splits, err = savedSplits(tx, expense); err != nil {
+			return nil, err
+		}
+
+		if err := validateExpense(&expense, currencies); err != nil {
+			return nil, err
+		}
+
+		return expense, upsertExpense(tx, expense)
+	})
+}
+
+// ImportExcelIncomes reads back a sheet of the incomes export, the rows are
+// imported for the caller
+func (api *API) ImportExcelIncomes(c *gin.Context) {
+	u := ParsePayload(c)
+	rows, err := readExcelImport(c, incomeExcelColumns, "name", "currency", "amount", "date")
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	api.importRows(c, len(rows), func(tx *sql.Tx, i int) (interface{}, error) {
+		var err error
+		row := rows[i]
+		income := models.Income{
+			Id:          row["id"],
+			UserId:      u.Id,
+			Name:        row["name"],
+			Description: row["description"],
+			Currency:    strings.ToUpper(row["currency"]),
+			Date:        row["date"],
+		}
+
+		if income.Amount, err = parseExportAmount(income.Currency, row["amount"], currencies); err != nil {
+			return nil, err
+		}
+
+		if _, err := uuid.FromString(income.Id); err != nil {
+			income.Id = uuid.Must(uuid.NewV4()).String()
+		} else if income.AccountId, err = savedAccountId(tx, "incomes", income.Id, income.UserId); err != nil {
+			return nil, err
+		}
+
+		if err := validateIncome(&income, currencies); err != nil {
+			return nil, err
+		}
+
+		return income, upsertIncome(tx, income)
+	})
+}
+
+// ImportExcelProducts reads back a sheet of the products export, the rows
+// are imported for the caller
+func (api *API) ImportExcelProducts(c *gin.Context) {
+	u := ParsePayload(c)
+	rows, err := readExcelImport(c, productExcelColumns, "category", "name")
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	api.importRows(c, len(rows), func(tx *sql.Tx, i int) (interface{}, error) {
+		var err error
+		row := rows[i]
+		product := models.Product{
+			Id:           row["id"],
+			UserId:       u.Id,
+			CategoryName: row["category"],
+			Name:         row["name"],
+			Description:  row["description"],
+		}
+
+		product.CategoryId, err = categoryIdByName(tx, product.UserId, product.CategoryName)
+		if err == sql.ErrNoRows {
+			return nil, errors.New("category-not-found")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := uuid.FromString(product.Id); err != nil {
+			product.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateProduct(product); err != nil {
+			return nil, err
+		}
+
+		return product, upsertProduct(tx, product)
+	})
+}
+
+// importRows saves the n rows in one transaction, save returns the saved row
+// or nil for a skipped one. With dry_run=true the saved rows are returned and
+// the transaction rolled back.
+func (api *API) importRows(c *gin.Context, n int, save func(tx *sql.Tx, i int) (interface{}, error)) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	var errRows []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	skipped := 0
+	matches := []models.RuleMatch{}
+	saved := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		data, err := save(tx, i)
+		if err != nil {
+			errRows = append(errRows, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if data == nil {
+			skipped++
+			continue
+		}
+
+		if expense, ok := data.(models.Expense); ok && expense.RuleId != "" {
+			matches = append(matches, models.RuleMatch{Row: i + 1, RuleId: expense.RuleId})
+		}
+
+		saved = append(saved, data)
+	}
+
+	if len(errRows) > 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "error", "details": errRows})
+		return
+	}
+
+	// the rows went through the database checks, the deferred rollback drops them
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"message": "success", "total": len(saved), "skipped": skipped, "matches": matches, "data": saved})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "total": len(saved), "skipped": skipped, "matches": matches})
+}
+
+// readImport reads the csv file and the mapping form fields of a multipart
+// request. The file needs a header row, the records are keyed by field and
+// numbered from the first row after the header.
+func readImport(c *gin.Context, fields []string, required ...string) (models.ImportMapping, []map[string]string, error) {
+	var mapping models.ImportMapping
+	if m := c.PostForm("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			return mapping, nil, errors.New("invalid-mapping")
+		}
+	}
+
+	if mapping.DateFormat == "" {
+		mapping.DateFormat = "yyyy-mm-dd"
+	}
+
+	if mapping.DecimalSeparator == "" {
+		mapping.DecimalSeparator = "."
+	}
+
+	if mapping.Delimiter == "" {
+		mapping.Delimiter = ","
+	}
+
+	if mapping.DecimalSeparator != "." && mapping.DecimalSeparator != "," {
+		return mapping, nil, errors.New("invalid-decimal-separator(.|,)")
+	}
+
+	delimiter := []rune(mapping.Delimiter)
+	if len(delimiter) != 1 {
+		return mapping, nil, errors.New("invalid-delimiter")
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return mapping, nil, errors.New("missing-file")
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return mapping, nil, err
+	}
+
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = delimiter[0]
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return mapping, nil, errors.New("invalid-csv")
+	}
+
+	columns := map[string]string{}
+	for _, field := range fields {
+		columns[field] = field
+		if mapped, ok := mapping.Columns[field]; ok {
+			columns[field] = mapped
+		}
+	}
+
+	rows, err := mapRecords(records, columns, required...)
+
+	return mapping, rows, err
+}
+
+// readExcelImport reads the first sheet of the xlsx file of a multipart
+// request, columns maps the fields to the headers of the sheet
+func readExcelImport(c *gin.Context, columns map[string]string, required ...string) ([]map[string]string, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New("missing-file")
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	f, err := excelize.OpenReader(file)
+	if err != nil {
+		return nil, errors.New("invalid-excel")
+	}
+
+	records, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		return nil, errors.New("invalid-excel")
+	}
+
+	return mapRecords(records, columns, required...)
+}
+
+// mapRecords keys the records after the header row by field, columns maps
+// the fields to their header
+func mapRecords(records [][]string, columns map[string]string, required ...string) ([]map[string]string, error) {
+	if len(records) < 2 {
+		return nil, errors.New("empty-file")
+	}
+
+	names := map[string]int{}
+	for i, name := range records[0] {
+		names[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	indexes := map[string]int{}
+	for field, name := range columns {
+		if i, ok := names[strings.ToLower(strings.TrimSpace(name))]; ok {
+			indexes[field] = i
+		}
+	}
+
+	for _, field := range required {
+		if _, ok := indexes[field]; !ok {
+			return nil, errors.New("missing-column(" + columns[field] + ")")
+		}
+	}
+
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for field, i := range indexes {
+			if i < len(record) {
+				row[field] = strings.TrimSpace(record[i])
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func parseImportDate(value, format string) (string, error) {
+	date, err := time.Parse(importDateReplacer.Replace(format), value)
+	if err != nil {
+		return "", errors.New("invalid-date(" + format + ")")
+	}
+
+	return date.Format(dateFormat), nil
+}
+
+// parseImportAmount drops the thousands separators, the other one of . and ,
+func parseImportAmount(value, decimalSeparator string) (float64, error) {
+	thousands := ","
+	if decimalSeparator == "," {
+		thousands = "."
+	}
+
+	value = strings.NewReplacer(" ", "", thousands, "").Replace(value)
+	value = strings.Replace(value, decimalSeparator, ".", 1)
+
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.New("invalid-amount")
+	}
+
+	return amount, nil
+}
+
+// parseExportAmount reads back the amounts of formatAmount, like
+// Rp 1,000,000.00 or $ 1,234.50. The older exports grouped the rupiah
+// thousands with dots, like Rp 1.000.000, so without a comma a last group not
+// of three digits is the decimal part.
+func parseExportAmount(currency, value string, currencies map[string]models.Currency) (float64, error) {
+	symbol, _ := currencyDisplay(currency, currencies)
+
+	value = strings.TrimSpace(value)
+	for _, prefix := range []string{symbol, "Rp", "$", currency} {
+		value = strings.TrimSpace(strings.TrimPrefix(value, prefix))
+	}
+
+	if currency == "IDR" && !strings.Contains(value, ",") {
+		groups := strings.Split(value, ".")
+		decimals := ""
+		if n := len(groups); n > 1 && len(groups[n-1]) != 3 {
+			decimals = "." + groups[n-1]
+			groups = groups[:n-1]
+		}
+
+		value = strings.Join(groups, "") + decimals
+	} else {
+		value = strings.ReplaceAll(value, ",", "")
+	}
+
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.New("invalid-amount")
+	}
+
+	return amount, nil
+}
+
+// parseImportTags splits the ; separated tags, no tags leaves the saved ones
+func parseImportTags(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ";")
+}
+
+// productIdByName finds the product of the user by its name and the name of
+// its category, case insensitive
+func productIdByName(tx *sql.Tx, userId, category, product string) (string, error) {
+	var id string
+	err := tx.QueryRow(`SELECT p.id FROM products p
+		JOIN categories c ON p.category_id = c.id AND NOT c.deleted
+		WHERE NOT p.deleted AND p.user_id = $1 AND LOWER(p.name) = LOWER($2) AND LOWER(c.name) = LOWER($3)
+		ORDER BY p.created_at LIMIT 1`, userId, product, category).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+
+	return id, err
+}
+
+// savedAccountId is the account of a saved row of table, the sheets do not
+// carry the accounts
+func savedAccountId(tx *sql.Tx, table, id, userId string) (string, error) {
+	var accountId sql.NullString
+	err := tx.QueryRow(fmt.Sprintf("SELECT account_id FROM %s WHERE id = $1 AND user_id = $2", table), id, userId).Scan(&accountId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	return accountId.String, err
+}
+
+// savedSplits are the split lines of a saved expense as long as its row of the
+// sheet, which only has the product and the amount, leaves them untouched
+func savedSplits(tx *sql.Tx, expense models.Expense) ([]models.ExpenseSplit, error) {
+	rows, err := tx.Query(`SELECT s.product_id, s.amount
+		FROM expense_splits s
+		JOIN expenses e ON s.expense_id = e.id
+		WHERE s.expense_id = $1 AND e.user_id = $2 AND e.product_id = $3
+		AND (SELECT SUM(amount) FROM expense_splits WHERE expense_id = $1) = $4
+		ORDER BY s.position`, expense.Id, expense.UserId, expense.ProductId, expense.Amount)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var splits []models.ExpenseSplit
+	for rows.Next() {
+		var split models.ExpenseSplit
+		if err := rows.Scan(&split.ProductId, &split.Amount); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		splits = append(splits, split)
+	}
+
+	return splits, rows.Err()
+}
+
+// categoryIdByName finds the category of the user by its name, case insensitive
+func categoryIdByName(tx *sql.Tx, userId, category string) (string, error) {
+	var id string
+	err := tx.QueryRow(`SELECT id FROM categories
+		WHERE NOT deleted AND user_id = $1 AND LOWER(name) = LOWER($2)
+		ORDER BY created_at LIMIT 1`, userId, category).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+
+	return id, err
+}
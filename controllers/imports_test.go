@@ -0,0 +1,825 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestImportExpenses(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// missing file (400)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	payload, contentType := filePayload("", nil)
+	req, _ := http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-file", genericResp.Message)
+
+	// invalid mapping (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	payload, contentType = filePayload("date,amount\n2021-12-31,10", map[string]string{"mapping": "{"})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-mapping", genericResp.Message)
+
+	// invalid decimal separator (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	payload, contentType = filePayload("date,amount\n2021-12-31,10", map[string]string{"mapping": `{"decimal_separator":"'"}`})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-decimal-separator(.|,)", genericResp.Message)
+
+	// missing column (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	payload, contentType = filePayload("when,amount\n2021-12-31,10", nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-column(date)", genericResp.Message)
+
+	// empty file (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	payload, contentType = filePayload("date,amount\n", nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "empty-file", genericResp.Message)
+
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-select-currencies"))
+
+	payload, contentType = filePayload("date,amount\n2021-12-31,10", nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-currencies", genericResp.Message)
+
+	// rows validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	mapping := `{"columns":{"date":"Posting Date","amount":"Amount","payee":"Reference"},"delimiter":";","date_format":"dd/mm/yyyy",` +
+		`"decimal_separator":",","currency":"idr","product_id":"` + mockID + `"}`
+	file := "\ufeffPosting Date;Reference;Amount\n" +
+		"2021-12-31;x;10\n" +
+		"31/12/2021;x;abc\n" +
+		"31/12/2021;x;10,555\n" +
+		"31/12/2021;x;1.234,50\n" +
+		"31/12/2021;Coffee Shop;5\n"
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	// the rules are loaded once, the mapping product is for the rows no rule matches
+	dbMock.ExpectQuery("SELECT r.id, r.product_id.*FROM categorisation_rules.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "payee_contains", "payee_regex", "min_amount", "max_amount", "currency"}).
+			AddRow(mockID2, mockID2, "shop", "", nil, nil, ""))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(sqlmock.AnyArg(), mockID, "2021-12-31", mockUserID, "IDR", 1234.5, "").
+		WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(sqlmock.AnyArg(), mockID2, "2021-12-31", mockUserID, "IDR", 5.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(file, map[string]string{"mapping": mapping})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 4, len(respErrors.Details))
+	assert.Equal(t, "invalid-date(dd/mm/yyyy)", respErrors.Details[0].Message)
+	assert.Equal(t, "invalid-amount", respErrors.Details[1].Message)
+	assert.Equal(t, "amount-exceeds-currency-minor-unit", respErrors.Details[2].Message)
+	assert.Equal(t, 4, respErrors.Details[3].Row)
+	assert.Equal(t, "err-insert", respErrors.Details[3].Message)
+
+	// dry run (200)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	file = "date,amount,currency,product_id,tags\n2021-12-31,\"1,234.50\",usd," + mockID + ",Food;Travel\n"
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(sqlmock.AnyArg(), mockID, "2021-12-31", mockUserID, "USD", 1234.5, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM expense_tags.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "food").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO expense_tags.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "travel").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO expense_tags.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "?dry_run=true", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExpenses(c)
+
+	respPreview := struct {
+		Message string           `json:"message"`
+		Total   int              `json:"total"`
+		Data    []models.Expense `json:"data"`
+	}{}
+
+	err = json.NewDecoder(w.Body).Decode(&respPreview)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, respPreview.Total)
+	assert.Equal(t, "2021-12-31", respPreview.Data[0].Date)
+	assert.Equal(t, 1234.5, respPreview.Data[0].Amount)
+	assert.DeepEqual(t, []string{"food", "travel"}, respPreview.Data[0].Tags)
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	file = "date,amount,currency,product_id\n2021-12-31,10,usd," + mockID + "\n"
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
+
+func TestImportIncomes(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// invalid csv (400)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	payload, contentType := filePayload("date,amount\n2021-12-31,\"10", nil)
+	req, _ := http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-csv", genericResp.Message)
+
+	// invalid delimiter (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	payload, contentType = filePayload("date,amount\n2021-12-31,10", map[string]string{"mapping": `{"delimiter":";;"}`})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-delimiter", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	payload, contentType = filePayload("date,amount\n2021-12-31,10", nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// rows validation & account failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	mapping := `{"columns":{"name":"Payer","description":"Memo"},"currency":"USD","account_id":"` + mockID + `"}`
+	file := "Payer,Memo,date,amount\n" +
+		"ACME,,2021-12-31,10\n" +
+		"ACME,salary,2021-12-31\n" +
+		"ACME,salary,2021-12-31,10\n"
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(file, map[string]string{"mapping": mapping})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, 3, len(respErrors.Details))
+	assert.Equal(t, "missing-description", respErrors.Details[0].Message)
+	assert.Equal(t, "invalid-amount", respErrors.Details[1].Message)
+	assert.Equal(t, "account-not-found", respErrors.Details[2].Message)
+
+	// dry run (200)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	file = "name,description,date,amount,currency\nACME,salary,2021-12-31,10,idr\n"
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO incomes.*").WithArgs(sqlmock.AnyArg(), "ACME", "salary", "2021-12-31", mockUserID, "IDR", 10.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "?dry_run=1", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportIncomes(c)
+
+	respPreview := struct {
+		Message string          `json:"message"`
+		Total   int             `json:"total"`
+		Data    []models.Income `json:"data"`
+	}{}
+
+	err = json.NewDecoder(w.Body).Decode(&respPreview)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, respPreview.Total)
+	assert.Equal(t, "ACME", respPreview.Data[0].Name)
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("INSERT INTO incomes.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
+
+// excelFile writes the rows on the first sheet of a new xlsx file
+func excelFile(rows [][]interface{}) string {
+	f := excelize.NewFile()
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		f.SetSheetRow("Sheet1", cell, &row)
+	}
+
+	buffer, _ := f.WriteToBuffer()
+	return buffer.String()
+}
+
+func TestImportExcelExpenses(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// invalid excel (400)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	payload, contentType := filePayload("date,amount\n2021-12-31,10", nil)
+	req, _ := http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExcelExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-excel", genericResp.Message)
+
+	// missing column (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	payload, contentType = filePayload(excelFile([][]interface{}{
+		{"Category", "Product Name", "Currency", "Date"},
+		{"Food", "Coffee", "IDR", "2021-12-31"},
+	}), nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExcelExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-column(Amount)", genericResp.Message)
+
+	// err select currencies (500)
+	header := []interface{}{"Category", "Product Name", "Product Description", "Currency", "Amount", "Date", "ID"}
+	file := excelFile([][]interface{}{header, {"Food", "Coffee", "", "IDR", "Rp 10.000", "2021-12-31", ""}})
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-select-currencies"))
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExcelExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-currencies", genericResp.Message)
+
+	// errors rows (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WithArgs(mockUserID, "Tea", "Food").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WillReturnError(fmt.Errorf("err-select-product"))
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectQuery("SELECT account_id FROM expenses.*").WithArgs(mockID, mockUserID).WillReturnError(fmt.Errorf("err-select-account"))
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(excelFile([][]interface{}{header,
+		{"Food", "Coffee", "", "IDR", "Rp ten", "2021-12-31", ""},
+		{"Food", "Tea", "", "IDR", "Rp 10.000", "2021-12-31", ""},
+		{"Food", "Coffee", "", "IDR", "Rp 10.000", "2021-12-31", ""},
+		{"Food", "Coffee", "", "IDR", "Rp 10.000", "2021-12-31", mockID},
+		{"Food", "Coffee", "", "EUR", "EUR 10", "2021-12-31", ""},
+	}), nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 5, len(respErrors.Details))
+	assert.Equal(t, "invalid-amount", respErrors.Details[0].Message)
+	assert.Equal(t, "product-not-found", respErrors.Details[1].Message)
+	assert.Equal(t, "err-select-product", respErrors.Details[2].Message)
+	assert.Equal(t, "err-select-account", respErrors.Details[3].Message)
+	assert.Equal(t, "unsupported-currency", respErrors.Details[4].Message)
+
+	// dry run (200)
+	respDryRun := struct {
+		Message string           `json:"message"`
+		Total   int              `json:"total"`
+		Data    []models.Expense `json:"data"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WithArgs(mockUserID, "Coffee", "Food").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	// the account of the saved expense is kept
+	dbMock.ExpectQuery("SELECT account_id FROM expenses.*").WithArgs(mockID, mockUserID).WillReturnRows(sqlmock.NewRows([]string{"account_id"}).AddRow(mockID2))
+	// and so are its split lines, the product and the amount did not change
+	dbMock.ExpectQuery("SELECT s.product_id, s.amount.*e.product_id = \\$3.*").WithArgs(mockID, mockUserID, mockID, 1234567.5).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "amount"}).AddRow(mockID, 1000000.0).AddRow(mockID2, 234567.5))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID2, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(mockID, mockID, "2021-12-31", mockUserID, "IDR", 1234567.5, mockID2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectExec("INSERT INTO expense_splits.*").WithArgs(mockID, mockID, 1000000.0, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO expense_splits.*").WithArgs(mockID, mockID2, 234567.5, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WithArgs(mockUserID, "coffee", "food").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(sqlmock.AnyArg(), mockID, "2021-12-30", mockUserID, "USD", 1234.5, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(excelFile([][]interface{}{header,
+		{"Food", "Coffee", "", "IDR", "Rp 1.234.567.5", "2021-12-31", mockID},
+		{"food", "coffee", "", "USD", "$ 1,234.50", "2021-12-30", ""},
+	}), nil)
+	req, _ = http.NewRequest("POST", "?dry_run=true", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respDryRun)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, respDryRun.Total)
+	assert.Equal(t, mockID2, respDryRun.Data[0].AccountId)
+	assert.Equal(t, 1234.5, respDryRun.Data[1].Amount)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT p.id FROM products.*").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO expenses.*").WithArgs(sqlmock.AnyArg(), mockID, "2021-12-31", mockUserID, "IDR", 10000.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+
+	payload, contentType = filePayload(file, nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelExpenses(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
+
+func TestImportExcelIncomes(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// missing column (400)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	payload, contentType := filePayload(excelFile([][]interface{}{
+		{"Description", "Currency", "Amount", "Date"},
+		{"monthly", "IDR", "Rp 10.000", "2021-12-31"},
+	}), nil)
+	req, _ := http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExcelIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-column(Name)", genericResp.Message)
+
+	// errors rows (500)
+	header := []interface{}{"Name", "Description", "Currency", "Amount", "Date", "ID"}
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT account_id FROM incomes.*").WithArgs(mockID, mockUserID).WillReturnError(fmt.Errorf("err-select-account"))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(excelFile([][]interface{}{header,
+		{"Salary", "monthly", "USD", "$ten", "2021-12-31", ""},
+		{"Salary", "monthly", "USD", "$10", "2021-12-31", mockID},
+		{"Salary", "monthly", "USD", "$10", "31/12/2021", ""},
+	}), nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, 3, len(respErrors.Details))
+	assert.Equal(t, "invalid-amount", respErrors.Details[0].Message)
+	assert.Equal(t, "err-select-account", respErrors.Details[1].Message)
+	assert.Equal(t, "invalid-date(yyyy-mm-dd)", respErrors.Details[2].Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	// the income is not saved yet, it gets no account
+	dbMock.ExpectQuery("SELECT account_id FROM incomes.*").WithArgs(mockID, mockUserID).WillReturnRows(sqlmock.NewRows([]string{"account_id"}))
+	dbMock.ExpectExec("INSERT INTO incomes.*").WithArgs(mockID, "Salary", "monthly", "2021-12-31", mockUserID, "IDR", 1000000.0, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload, contentType = filePayload(excelFile([][]interface{}{header,
+		{"Salary", "monthly", "IDR", "Rp 1.000.000", "2021-12-31", mockID},
+	}), nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
+
+func TestImportExcelProducts(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// empty file (400)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	header := []interface{}{"Category", "Name", "Description", "Created At", "Updated At", "ID"}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	payload, contentType := filePayload(excelFile([][]interface{}{header}), nil)
+	req, _ := http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	api.ImportExcelProducts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "empty-file", genericResp.Message)
+
+	// errors rows (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT id FROM categories.*").WithArgs(mockUserID, "Drinks").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbMock.ExpectQuery("SELECT id FROM categories.*").WillReturnError(fmt.Errorf("err-select-category"))
+	dbMock.ExpectQuery("SELECT id FROM categories.*").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectQuery("SELECT id FROM categories.*").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO products.*").WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(excelFile([][]interface{}{header,
+		{"Drinks", "Coffee", "arabica", "", "", ""},
+		{"Food", "Coffee", "arabica", "", "", ""},
+		{"Food", "Coffee", "", "", "", ""},
+		{"Food", "Coffee", "arabica", "", "", ""},
+	}), nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelProducts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, 4, len(respErrors.Details))
+	assert.Equal(t, "category-not-found", respErrors.Details[0].Message)
+	assert.Equal(t, "err-select-category", respErrors.Details[1].Message)
+	assert.Equal(t, "missing-description", respErrors.Details[2].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[3].Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT id FROM categories.*").WithArgs(mockUserID, "Food").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO products.*").WithArgs(mockID, "Coffee", "arabica", mockUserID, mockID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload, contentType = filePayload(excelFile([][]interface{}{header,
+		{"Food", "Coffee", "arabica", "2021-12-31 10:00:00", "2021-12-31 10:00:00", mockID},
+	}), nil)
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.ImportExcelProducts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
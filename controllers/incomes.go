@@ -12,9 +12,9 @@ import (
 	"time"
 
 	"github.com/360EntSecGroup-Skylar/excelize/v2"
-	"github.com/dustin/go-humanize"
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
 )
 
 func (api *API) GetIncomesReport(c *gin.Context) {
@@ -27,48 +27,76 @@ func (api *API) GetIncomesReport(c *gin.Context) {
 		MaxDate: c.Query("max_date"),
 	}
 
+	filter.Tags, filter.TagsMatch = parseTagsQuery(c)
+
 	if u.Role == string(models.Customer) {
 		filter.UserId = u.Id
 	}
 
+	baseCurrency, err := parseBaseCurrency(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	baseCurrency, err = api.defaultBaseCurrency(u.Id, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	report, err := api.incomesReport(filter, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// incomesReport totals the incomes matching filter per currency, converted
+// into baseCurrency too when it is set
+func (api *API) incomesReport(filter models.IncomeFilter, baseCurrency string) (report models.IncomeReport, err error) {
 	totalQ := `SELECT currency, SUM(amount) FROM incomes e WHERE NOT deleted`
 	filterQ, stms := getFilterIncome(filter)
 
-	groupBy := `GROUP BY currency`
+	groupBy := ` GROUP BY currency`
 
 	totalQ = totalQ + filterQ + groupBy
 
-	var report models.IncomeReport
-
-	rows, err := api.Db.Query(totalQ, stms...)
+	report.Totals, err = api.getTotalsByCurrency(totalQ, stms)
 	if err != nil {
-		log.Println(err)
-		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	defer rows.Close()
+	if baseCurrency != "" {
+		report.Converted, err = api.getConvertedIncomeReport(filterQ, stms, baseCurrency)
+	}
 
-	for rows.Next() {
-		var currency sql.NullString
-		var total sql.NullFloat64
+	return
+}
 
-		if err := rows.Scan(&currency, &total); err != nil {
-			log.Println(err)
-			sendError(c, http.StatusInternalServerError, err.Error())
-			return
-		}
+func (api *API) getConvertedIncomeReport(filterQ string, stms []interface{}, baseCurrency string) (*models.ConvertedReport, error) {
+	target := fmt.Sprintf("$%d", len(stms)+1)
+	args := append(append([]interface{}{}, stms...), baseCurrency)
 
-		if currency.String == "IDR" {
-			report.TotalIdr = total.Float64
-		}
+	q := `SELECT SUM(` + convertedQ("e", "e.amount", target) + `), ` + missingRateQ("e", target) + `
+		FROM incomes e` + rateJoinQ("e", target) + `
+		WHERE NOT deleted` + filterQ
 
-		if currency.String == "USD" {
-			report.TotalUsd = total.Float64
-		}
+	var total sql.NullFloat64
+	converted := &models.ConvertedReport{BaseCurrency: baseCurrency}
+
+	if err := api.Db.QueryRow(q, args...).Scan(&total, &converted.MissingRates); err != nil {
+		log.Println(err)
+		return nil, err
 	}
 
-	c.JSON(http.StatusOK, report)
+	converted.Total = roundAmount(total.Float64)
+
+	return converted, nil
 }
 
 func (api *API) GetIncomes(c *gin.Context) {
@@ -83,12 +111,14 @@ func (api *API) GetIncomes(c *gin.Context) {
 	maxAmount, _ := strconv.ParseFloat(c.Query("max_amount"), 64)
 
 	asExcel, _ := strconv.ParseBool(c.Query("export_as_excel"))
+	asCSV := strings.ToLower(c.Query("export")) == "csv"
 
 	filter := models.IncomeFilter{
 		Income: models.Income{
 			Name:        c.Query("name"),
 			Description: c.Query("description"),
 			UserId:      c.Query("user_id"),
+			AccountId:   c.Query("account_id"),
 			Currency:    c.Query("currency"),
 			Amount:      amount,
 			Date:        c.Query("date"),
@@ -99,6 +129,8 @@ func (api *API) GetIncomes(c *gin.Context) {
 		MaxAmount: maxAmount,
 	}
 
+	filter.Tags, filter.TagsMatch = parseTagsQuery(c)
+
 	if u.Role == string(models.Customer) {
 		filter.UserId = u.Id
 	}
@@ -120,6 +152,7 @@ func (api *API) GetIncomes(c *gin.Context) {
 		"name":        "name",
 		"description": "description",
 		"user_id":     "user_id",
+		"account_id":  "account_id",
 		"date":        "date",
 		"currency":    "currency",
 		"amount":      "amount",
@@ -133,31 +166,45 @@ func (api *API) GetIncomes(c *gin.Context) {
 		orderBy = "updated_at"
 	}
 
+	baseCurrency, err := parseBaseCurrency(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// exports follow the user's preference, the json list converts on request only
+	if asExcel || asCSV {
+		baseCurrency, err = api.defaultBaseCurrency(u.Id, baseCurrency)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	countQ := `SELECT COUNT(1) FROM incomes
 		WHERE NOT deleted`
-	selectQ := `SELECT
-			id, name, description,
-			user_id, date, currency,
-			amount, created_at, updated_at
-		FROM incomes
-		WHERE NOT deleted`
 
 	var incomeList models.IncomeList
 	var incomes []models.Income
-	var err error
 
 	filterQ, stms := getFilterIncome(filter)
-
-	selectQ = selectQ + filterQ
+	selectQ, selectStms := incomesSelectQ(filterQ, stms, baseCurrency)
 	countQ = countQ + filterQ
 
 	offset := (page - 1) * limit
 	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
 	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
 
+	// exports are the whole filtered list, not a page of it
+	if asExcel || asCSV {
+		api.exportIncomes(c, selectQ+orderVal, selectStms, baseCurrency, asCSV)
+		return
+	}
+
 	log.Println(selectQ + orderVal + pagination)
 
-	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, selectStms...)
 	if err != nil {
 		log.Println(err)
 		sendError(c, http.StatusInternalServerError, err.Error())
@@ -167,39 +214,16 @@ func (api *API) GetIncomes(c *gin.Context) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var income models.Income
-		var name, description, userId, currency sql.NullString
-
-		var amount sql.NullFloat64
-
-		var date sql.NullTime
-
-		err = rows.Scan(&income.Id, &name, &description, &userId, &date, &currency, &amount, &income.CreatedAt, &income.UpdatedAt)
+		income, err := scanIncome(rows, baseCurrency != "")
 		if err != nil {
 			log.Println(err)
 			sendError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		income.Name = name.String
-		income.Description = description.String
-		income.UserId = userId.String
-
-		if date.Valid {
-			income.Date = date.Time.Format(dateFormat)
-		}
-
-		income.Currency = currency.String
-		income.Amount = amount.Float64
-
 		incomes = append(incomes, income)
 	}
 
-	if asExcel {
-		handleExcelIncomes(c, incomes)
-		return
-	}
-
 	incomeList.Total, err = api.GetTotal(countQ, stms)
 	if err != nil {
 		log.Println(err)
@@ -214,6 +238,119 @@ func (api *API) GetIncomes(c *gin.Context) {
 	c.JSON(http.StatusOK, incomeList)
 }
 
+// incomesSelectQ selects the columns scanIncome reads of the incomes
+// matching filterQ, their converted amount last when baseCurrency is set
+func incomesSelectQ(filterQ string, stms []interface{}, baseCurrency string) (string, []interface{}) {
+	selectQ := `SELECT
+			id, name, description,
+			user_id, date, currency,
+			amount, created_at, updated_at, account_id,
+			` + tagNamesQ("incomes", "incomes.id")
+
+	if baseCurrency != "" {
+		target := fmt.Sprintf("$%d", len(stms)+1)
+		selectQ += ", " + convertedQ("incomes", "amount", target) + `
+		FROM incomes` + rateJoinQ("incomes", target)
+		stms = append(append([]interface{}{}, stms...), baseCurrency)
+	} else {
+		selectQ += `
+		FROM incomes`
+	}
+
+	return selectQ + `
+		WHERE NOT deleted` + filterQ, stms
+}
+
+// exportIncomes walks the whole filtered list through a cursor into the
+// excel or the csv export
+func (api *API) exportIncomes(c *gin.Context, q string, stms []interface{}, baseCurrency string, asCSV bool) {
+	// the excel export shows the amounts in the format of their currency
+	var currencies map[string]models.Currency
+	if !asCSV {
+		var err error
+		if currencies, err = api.getCurrencies(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	cur, err := api.openExportCursor(q, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer cur.Close()
+
+	if !asCSV {
+		handleExcelIncomes(c, cur, baseCurrency, currencies)
+		return
+	}
+
+	header := []string{"id", "date", "name", "description", "currency", "amount", "account_id", "tags", "user_id"}
+	if baseCurrency != "" {
+		header = append(header, "base_currency", "converted_amount")
+	}
+
+	streamCSV(c, "incomes", header, cur, func() ([]string, error) {
+		income, err := scanIncome(cur, baseCurrency != "")
+		if err != nil {
+			return nil, err
+		}
+
+		record := []string{income.Id, income.Date, income.Name, income.Description, income.Currency,
+			csvAmount(&income.Amount), income.AccountId, strings.Join(income.Tags, ";"), income.UserId}
+		if baseCurrency != "" {
+			record = append(record, baseCurrency, csvAmount(income.ConvertedAmount))
+		}
+
+		return record, nil
+	})
+}
+
+// scanIncome reads a row of the GetIncomes list, converted tells whether
+// it ends with the converted amount
+func scanIncome(rows rowScanner, converted bool) (income models.Income, err error) {
+	var name, description, userId, currency, accountId sql.NullString
+
+	var amount, convertedAmount sql.NullFloat64
+
+	var date sql.NullTime
+	var tags pq.StringArray
+
+	dest := []interface{}{&income.Id, &name, &description, &userId, &date, &currency, &amount, &income.CreatedAt, &income.UpdatedAt, &accountId, &tags}
+
+	if converted {
+		dest = append(dest, &convertedAmount)
+	}
+
+	if err = rows.Scan(dest...); err != nil {
+		return
+	}
+
+	income.Name = name.String
+	income.Description = description.String
+	income.UserId = userId.String
+	income.AccountId = accountId.String
+	income.Tags = []string(tags)
+
+	if date.Valid {
+		income.Date = date.Time.Format(dateFormat)
+	}
+
+	income.Currency = currency.String
+	income.Amount = amount.Float64
+
+	if convertedAmount.Valid {
+		converted := roundAmount(convertedAmount.Float64)
+		income.ConvertedAmount = &converted
+	}
+
+	return
+}
+
 func (api *API) UpsertIncomes(c *gin.Context) {
 	u := ParsePayload(c)
 	var payload models.UpsertIncomeRequest
@@ -230,6 +367,13 @@ func (api *API) UpsertIncomes(c *gin.Context) {
 		return
 	}
 
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	var errIncomes []models.RowError
 	tx, err := api.Db.Begin()
 	if err != nil {
@@ -254,19 +398,12 @@ func (api *API) UpsertIncomes(c *gin.Context) {
 			income.Id = uuid.Must(uuid.NewV4()).String()
 		}
 
-		if err := validateIncome(&income); err != nil {
+		if err := validateIncome(&income, currencies); err != nil {
 			errIncomes = append(errIncomes, models.RowError{Row: i + 1, Message: err.Error()})
 			continue
 		}
 
-		if _, err := tx.Exec(`
-		INSERT INTO incomes
-		(id, name, description, date, user_id, currency, amount, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		ON CONFLICT(id) DO UPDATE SET
-		name = $2, description = $3, date = $4, user_id = $5, currency = $6, amount= $7, updated_at = CURRENT_TIMESTAMP, deleted = false
-		`, income.Id, income.Name, income.Description, income.Date, income.UserId, income.Currency, income.Amount); err != nil {
-			log.Println(err)
+		if err := upsertIncome(tx, income); err != nil {
 			errIncomes = append(errIncomes, models.RowError{Row: i + 1, Message: err.Error()})
 			continue
 		}
@@ -289,12 +426,46 @@ func (api *API) UpsertIncomes(c *gin.Context) {
 	c.JSON(code, obj)
 }
 
+// upsertIncome saves a validated income and replaces its tags when given
+func upsertIncome(tx *sql.Tx, income models.Income) error {
+	if income.AccountId != "" {
+		exists, err := accountExists(tx, income.AccountId, income.UserId)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return errors.New("account-not-found")
+		}
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO incomes
+		(id, name, description, date, user_id, currency, amount, created_at, updated_at, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, NULLIF($8, '')::UUID)
+		ON CONFLICT(id) DO UPDATE SET
+		name = $2, description = $3, date = $4, user_id = $5, currency = $6, amount= $7, updated_at = CURRENT_TIMESTAMP, deleted = false,
+		account_id = NULLIF($8, '')::UUID
+		`, income.Id, income.Name, income.Description, income.Date, income.UserId, income.Currency, income.Amount, income.AccountId); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return setTags(tx, "incomes", income.Id, income.UserId, income.Tags)
+}
+
 func (api *API) DeleteIncomes(c *gin.Context) {
 	api.BatchDeletes(c, "incomes")
 }
 
-func handleExcelIncomes(c *gin.Context, incomes []models.Income) {
-	if len(incomes) == 0 {
+func handleExcelIncomes(c *gin.Context, cur *exportCursor, baseCurrency string, currencies map[string]models.Currency) {
+	if !cur.Next() {
+		if err := cur.Err(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
 		sendError(c, http.StatusNotFound, "incomes-not-found")
 		return
 	}
@@ -306,7 +477,7 @@ func handleExcelIncomes(c *gin.Context, incomes []models.Income) {
 	// delete default sheet
 	f.DeleteSheet("Sheet1")
 
-	err := f.SetColWidth(sheet, "A", "F", 50)
+	err := f.SetColWidth(sheet, "A", "G", 50)
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -330,34 +501,61 @@ func handleExcelIncomes(c *gin.Context, incomes []models.Income) {
 		return
 	}
 
-	if err = streamWriter.SetRow("A1", []interface{}{
+	header := []interface{}{
 		excelize.Cell{StyleID: headerStyle, Value: "Name"},
 		excelize.Cell{StyleID: headerStyle, Value: "Description"},
 		excelize.Cell{StyleID: headerStyle, Value: "Currency"},
 		excelize.Cell{StyleID: headerStyle, Value: "Amount"},
-		excelize.Cell{StyleID: headerStyle, Value: "Date"}}); err != nil {
+		excelize.Cell{StyleID: headerStyle, Value: "Date"}}
+
+	if baseCurrency != "" {
+		header = append(header, excelize.Cell{StyleID: headerStyle, Value: "Amount (" + baseCurrency + ")"})
+	}
+
+	// the id lets an edited sheet be imported back
+	header = append(header, excelize.Cell{StyleID: headerStyle, Value: "ID"})
+
+	if err = streamWriter.SetRow("A1", header); err != nil {
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	for n, income := range incomes {
-		amountFormatted := fmt.Sprintf("$%s", humanize.Commaf(income.Amount))
-		if income.Currency == "IDR" {
-			amountFormatted = strings.ReplaceAll(fmt.Sprintf("Rp %s", humanize.Commaf(income.Amount)), ",", ".")
+	for n := 0; ; n++ {
+		income, err := scanIncome(cur, baseCurrency != "")
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
 		}
 
 		row := make([]interface{}, 5)
 		row[0] = excelize.Cell{StyleID: dataStyle, Value: income.Name}
 		row[1] = excelize.Cell{StyleID: dataStyle, Value: income.Description}
 		row[2] = excelize.Cell{StyleID: dataStyle, Value: income.Currency}
-		row[3] = excelize.Cell{StyleID: dataStyle, Value: amountFormatted}
+		row[3] = excelize.Cell{StyleID: dataStyle, Value: formatAmount(income.Currency, income.Amount, currencies)}
 		row[4] = excelize.Cell{StyleID: dataStyle, Value: income.Date}
 
+		if baseCurrency != "" {
+			row = append(row, excelize.Cell{StyleID: dataStyle, Value: formatConvertedAmount(baseCurrency, income.ConvertedAmount, currencies)})
+		}
+
+		row = append(row, excelize.Cell{StyleID: dataStyle, Value: income.Id})
+
 		cell, _ := excelize.CoordinatesToCellName(1, n+2)
 		if err = streamWriter.SetRow(cell, row); err != nil {
 			sendError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
+
+		if !cur.Next() {
+			break
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	if err := streamWriter.Flush(); err != nil {
@@ -384,6 +582,11 @@ func getFilterIncome(filter models.IncomeFilter) (filterQ string, stms []interfa
 		stms = append(stms, filter.UserId)
 	}
 
+	if _, err := uuid.FromString(filter.AccountId); err == nil {
+		filterQ += fmt.Sprintf(" AND account_id = $%d", len(stms)+1)
+		stms = append(stms, filter.AccountId)
+	}
+
 	if filter.Name != "" {
 		filterQ += fmt.Sprintf(" AND name ILIKE $%d", len(stms)+1)
 		stms = append(stms, "%"+filter.Name+"%")
@@ -394,7 +597,7 @@ func getFilterIncome(filter models.IncomeFilter) (filterQ string, stms []interfa
 		stms = append(stms, "%"+filter.Description+"%")
 	}
 
-	if filter.Currency == "IDR" || filter.Currency == "USD" {
+	if isCurrencyCode(filter.Currency) {
 		filterQ += fmt.Sprintf(" AND currency = $%d", len(stms)+1)
 		stms = append(stms, filter.Currency)
 	}
@@ -429,10 +632,16 @@ func getFilterIncome(filter models.IncomeFilter) (filterQ string, stms []interfa
 		stms = append(stms, filter.MaxAmount)
 	}
 
+	if len(filter.Tags) > 0 {
+		tagsQ, tags := tagsFilterQ("incomes", "id", filter.Tags, filter.TagsMatch, len(stms)+1)
+		filterQ += tagsQ
+		stms = append(stms, tags)
+	}
+
 	return
 }
 
-func validateIncome(income *models.Income) error {
+func validateIncome(income *models.Income, currencies map[string]models.Currency) error {
 
 	if income.Name == "" {
 		return errors.New("missing-name")
@@ -458,6 +667,10 @@ func validateIncome(income *models.Income) error {
 		return errors.New("invalid-user-id")
 	}
 
+	if _, err := uuid.FromString(income.AccountId); income.AccountId != "" && err != nil {
+		return errors.New("invalid-account-id")
+	}
+
 	date, err := time.Parse(dateFormat, income.Date)
 	if err != nil {
 		return errors.New("invalid-date(yyyy-mm-dd)")
@@ -467,11 +680,11 @@ func validateIncome(income *models.Income) error {
 		return errors.New("date-shall-be-a-past-date")
 	}
 
-	// currently only allow USD and IDR
-	income.Currency = strings.ToUpper(income.Currency)
-	if income.Currency != "USD" && income.Currency != "IDR" {
-		return errors.New("only-usd-or-idr-currency-are-allowed")
+	if err := validateAmountCurrency(&income.Currency, income.Amount, currencies); err != nil {
+		return err
 	}
 
-	return nil
+	income.Tags, err = normalizeTags(income.Tags)
+
+	return err
 }
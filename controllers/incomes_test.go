@@ -58,10 +58,28 @@ func TestGetIncomesReporters(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "sql: expected 1 destination arguments in Scan, not 2", genericResp.Message)
 
+	// err select base currency (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).WillReturnError(errors.New("err-select-base-currency"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetIncomesReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-base-currency", genericResp.Message)
+
 	// (200)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
 	dbMock.ExpectQuery("SELECT currency.*").
 		WillReturnRows(sqlmock.NewRows(label).
 			AddRow("IDR", 5000).
@@ -77,8 +95,84 @@ func TestGetIncomesReporters(t *testing.T) {
 	err = json.NewDecoder(w.Body).Decode(&report)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, float64(5000), report.TotalIdr)
-	assert.Equal(t, float64(20), report.TotalUsd)
+	assert.Equal(t, float64(5000), report.Totals["IDR"])
+	assert.Equal(t, float64(20), report.Totals["USD"])
+	assert.Equal(t, true, report.Converted == nil)
+
+	// invalid base currency (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("GET", "?base_currency=rupiah", nil)
+	c.Request = req
+	api.GetIncomesReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-base-currency", genericResp.Message)
+
+	// err select converted (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT currency.*").WillReturnRows(sqlmock.NewRows(label).AddRow("IDR", 5000))
+	dbMock.ExpectQuery("SELECT SUM.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "IDR").WillReturnError(errors.New("err-select-converted"))
+
+	req, _ = http.NewRequest("GET", "?base_currency=IDR", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetIncomesReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-converted", genericResp.Message)
+
+	// (200) converted
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT currency.*").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow("IDR", 5000).
+			AddRow("USD", 20))
+	dbMock.ExpectQuery("SELECT SUM.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "IDR").
+		WillReturnRows(sqlmock.NewRows([]string{"sum", "missing"}).AddRow(305000.004, 0))
+
+	req, _ = http.NewRequest("GET", "?base_currency=IDR", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetIncomesReport(c)
+
+	report = models.IncomeReport{}
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "IDR", report.Converted.BaseCurrency)
+	assert.Equal(t, float64(305000), report.Converted.Total)
+	assert.Equal(t, 0, report.Converted.MissingRates)
+	// (200) converted into the user's base currency
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("USD"))
+	dbMock.ExpectQuery("SELECT currency.*").WillReturnRows(sqlmock.NewRows(label).AddRow("USD", 20))
+	dbMock.ExpectQuery("SELECT SUM.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"sum", "missing"}).AddRow(20, 0))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetIncomesReport(c)
+
+	report = models.IncomeReport{}
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "USD", report.Converted.BaseCurrency)
+	assert.Equal(t, float64(20), report.Converted.Total)
 }
 
 func TestGetIncomes(t *testing.T) {
@@ -121,10 +215,12 @@ func TestGetIncomes(t *testing.T) {
 		"amount",
 		"created_at",
 		"updated_at",
+		"account_id",
+		"tags",
 	}
 
 	dbMock.ExpectQuery("SELECT id.*").
-		WillReturnRows(sqlmock.NewRows(label[6:]).AddRow(100, time.Now(), time.Now()))
+		WillReturnRows(sqlmock.NewRows(label[6:9]).AddRow(100, time.Now(), time.Now()))
 
 	req, _ = http.NewRequest("GET", "?order_by=id", nil)
 	c.Request = req
@@ -133,7 +229,7 @@ func TestGetIncomes(t *testing.T) {
 	err = json.NewDecoder(w.Body).Decode(&genericResp)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 9", genericResp.Message)
+	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 11", genericResp.Message)
 
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
@@ -142,7 +238,7 @@ func TestGetIncomes(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows(label).
 			AddRow(mockID, "name", "desc",
 				mockUserID, time.Now(), "USD",
-				5001, time.Now(), time.Now()))
+				5001, time.Now(), time.Now(), nil, nil))
 	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
 
 	req, _ = http.NewRequest("GET", "", nil)
@@ -163,11 +259,12 @@ func TestGetIncomes(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows(label).
 			AddRow(mockID, "name", "desc",
 				mockUserID, time.Now(), "USD",
-				5001, time.Now(), time.Now()))
+				5001, time.Now(), time.Now(), mockID, "{salary}"))
 	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 
 	q := url.Values{}
 	q.Add("name", "dummy")
+	q.Add("account_id", mockID)
 	q.Add("description", "dummy")
 	q.Add("currency", "IDR")
 	q.Add("amount", "2555")
@@ -176,6 +273,7 @@ func TestGetIncomes(t *testing.T) {
 	q.Add("max_date", "2050-01-01")
 	q.Add("min_amount", "2555")
 	q.Add("max_amount", "5555")
+	q.Add("tags", "salary,bonus")
 
 	req, _ = http.NewRequest("GET", "", nil)
 	req.URL.RawQuery = q.Encode()
@@ -191,14 +289,60 @@ func TestGetIncomes(t *testing.T) {
 	assert.Equal(t, 1, len(resp.Incomes))
 	assert.Equal(t, mockID, resp.Incomes[0].Id)
 	assert.Equal(t, mockUserID, resp.Incomes[0].UserId)
+	assert.Equal(t, mockID, resp.Incomes[0].AccountId)
+	assert.DeepEqual(t, []string{"salary"}, resp.Incomes[0].Tags)
+	assert.Equal(t, true, resp.Incomes[0].ConvertedAmount == nil)
+
+	// invalid base currency (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("GET", "?base_currency=rupiah", nil)
+	c.Request = req
+	api.GetIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-base-currency", genericResp.Message)
+
+	// 200 converted
+	convertedLabel := append(append([]string{}, label...), "converted_amount")
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT id.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "IDR").
+		WillReturnRows(sqlmock.NewRows(convertedLabel).
+			AddRow(mockID, "name", "desc",
+				mockUserID, time.Now(), "USD",
+				10, time.Now(), time.Now(), nil, nil, 142505.004).
+			AddRow(mockID, "name", "desc",
+				mockUserID, time.Now(), "EUR",
+				10, time.Now(), time.Now(), nil, nil, nil))
+	dbMock.ExpectQuery("SELECT COUNT.*").WithArgs(mockUserID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	req, _ = http.NewRequest("GET", "?base_currency=idr", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetIncomes(c)
+
+	resp = models.IncomeList{}
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, len(resp.Incomes))
+	assert.Equal(t, 142505.0, *resp.Incomes[0].ConvertedAmount)
+	assert.Equal(t, true, resp.Incomes[1].ConvertedAmount == nil)
 
 	// as excel
 	// incomes not found (404)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT id.*").WithArgs(mockUserID).
-		WillReturnRows(sqlmock.NewRows(label))
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	expectExportCursor(dbMock, "SELECT id.*", sqlmock.NewRows(label), mockUserID)
 
 	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
 	c.Request = req
@@ -210,16 +354,23 @@ func TestGetIncomes(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.Equal(t, "incomes-not-found", genericResp.Message)
 
-	// 200
+	// 200 in the user's base currency, the whole list without pagination
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT id.*").
-		WillReturnRows(sqlmock.NewRows(label).
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("USD"))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	expectExportCursor(dbMock, "SELECT id.*LEFT JOIN LATERAL.*ORDER BY updated_at DESC$",
+		sqlmock.NewRows(convertedLabel).
 			AddRow(mockID, "name", "desc",
 				mockUserID, time.Now(), "IDR",
-				5001, time.Now(), time.Now()))
-	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
+				5001, time.Now(), time.Now(), nil, nil, 0.35).
+			AddRow(mockID, "name", "desc",
+				mockUserID, time.Now(), "EUR",
+				10, time.Now(), time.Now(), nil, nil, nil),
+		mockUserID, "USD")
+	req, _ = http.NewRequest("GET", "?export_as_excel=true&limit=1", nil)
 	c.Request = req
 	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
 	api.GetIncomes(c)
@@ -231,6 +382,38 @@ func TestGetIncomes(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "attachment;filename=\""+fileName+"\"", w.Header()["Content-Disposition"][0])
 
+	// as csv
+	// 200, the whole list in the user's base currency
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	date := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow("USD"))
+	expectExportCursor(dbMock, "SELECT id.*LEFT JOIN LATERAL.*ORDER BY updated_at DESC$",
+		sqlmock.NewRows(convertedLabel).
+			AddRow(mockID, "Salary", "March, net",
+				mockUserID, date, "IDR",
+				5001.25, time.Now(), time.Now(), mockID, "{work}", 0.35).
+			AddRow(mockID, "Bonus", "",
+				mockUserID, date, "EUR",
+				10, time.Now(), time.Now(), nil, nil, nil),
+		mockUserID, "USD")
+
+	req, _ = http.NewRequest("GET", "?export=csv&limit=1", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetIncomes(c)
+
+	fileName = fmt.Sprintf("report_incomes_%s.csv", time.Now().In(loc).Format("20060102_150405"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment;filename=\""+fileName+"\"", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id,date,name,description,currency,amount,account_id,tags,user_id,base_currency,converted_amount\n"+
+		mockID+",2021-03-04,Salary,\"March, net\",IDR,5001.25,"+mockID+",work,"+mockUserID+",USD,0.35\n"+
+		mockID+",2021-03-04,Bonus,,EUR,10,,,"+mockUserID+",USD,\n", w.Body.String())
+
 }
 
 func TestUpsertIncomes(t *testing.T) {
@@ -267,6 +450,24 @@ func TestUpsertIncomes(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, "missing-incomes", genericResp.Message)
 
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertIncomeRequest{Data: []models.Income{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-select-currencies"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertIncomes(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-currencies", genericResp.Message)
+
 	// err begin (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
@@ -274,6 +475,7 @@ func TestUpsertIncomes(t *testing.T) {
 		{},
 	}})
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
 
 	req, _ = http.NewRequest("POST", "", payload)
@@ -306,14 +508,23 @@ func TestUpsertIncomes(t *testing.T) {
 		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "err", Currency: "err", Amount: 555, UserId: mockUserID},
 		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: dateFuture.Format("2006-01-02"), Currency: "err", Amount: 555, UserId: mockUserID},
 		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "err", Amount: 555, UserId: mockUserID},
+		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "jpy", Amount: 555.5, UserId: mockUserID},
+		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID, AccountId: "err"},
+		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID, Tags: []string{"a,b"}},
+		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID, AccountId: mockID2},
+		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID, AccountId: mockID},
 		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID},
 	}}
 	dataOK := incomes.Data[len(incomes.Data)-1]
 	payload = parsePayload(incomes)
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID2, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnError(fmt.Errorf("err-account"))
 	dbMock.ExpectExec("INSERT INTO incomes.*").
-		WithArgs(dataOK.Id, dataOK.Name, dataOK.Description, dataOK.Date, dataOK.UserId, dataOK.Currency, dataOK.Amount).WillReturnError(fmt.Errorf("err-insert"))
+		WithArgs(dataOK.Id, dataOK.Name, dataOK.Description, dataOK.Date, dataOK.UserId, dataOK.Currency, dataOK.Amount, dataOK.AccountId).WillReturnError(fmt.Errorf("err-insert"))
 	dbMock.ExpectRollback()
 
 	req, _ = http.NewRequest("POST", "", payload)
@@ -325,7 +536,7 @@ func TestUpsertIncomes(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "error", respErrors.Message)
-	assert.Equal(t, 10, len(respErrors.Details))
+	assert.Equal(t, 15, len(respErrors.Details))
 	assert.Equal(t, "missing-name", respErrors.Details[0].Message)
 	assert.Equal(t, "missing-description", respErrors.Details[1].Message)
 	assert.Equal(t, "missing-date", respErrors.Details[2].Message)
@@ -334,22 +545,34 @@ func TestUpsertIncomes(t *testing.T) {
 	assert.Equal(t, "invalid-user-id", respErrors.Details[5].Message)
 	assert.Equal(t, "invalid-date(yyyy-mm-dd)", respErrors.Details[6].Message)
 	assert.Equal(t, "date-shall-be-a-past-date", respErrors.Details[7].Message)
-	assert.Equal(t, "only-usd-or-idr-currency-are-allowed", respErrors.Details[8].Message)
-	assert.Equal(t, "err-insert", respErrors.Details[9].Message)
+	assert.Equal(t, "unsupported-currency", respErrors.Details[8].Message)
+	assert.Equal(t, "amount-exceeds-currency-minor-unit", respErrors.Details[9].Message)
+	assert.Equal(t, "invalid-account-id", respErrors.Details[10].Message)
+	assert.Equal(t, "invalid-tag", respErrors.Details[11].Message)
+	assert.Equal(t, "account-not-found", respErrors.Details[12].Message)
+	assert.Equal(t, "err-account", respErrors.Details[13].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[14].Message)
 
 	// err commit (500)
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 	incomes = models.UpsertIncomeRequest{Data: []models.Income{
-		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID},
-		{Id: mockID2, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID},
+		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID, Tags: []string{"Salary"}},
+		{Id: mockID2, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID, AccountId: mockID2},
 		{Id: mockID, Name: "income 1", Description: "income desc 1", Date: "2000-01-02", Currency: "USD", Amount: 555, UserId: mockUserID},
 	}}
 	payload = parsePayload(incomes)
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin()
 	dbMock.ExpectExec("INSERT INTO incomes.*").WillReturnResult(sqlmock.NewResult(0, 1))
-	dbMock.ExpectExec("INSERT INTO incomes.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM income_tags.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "salary").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO income_tags.*").WithArgs(mockID, mockID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID2, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO incomes.*").WithArgs(mockID2, "income 1", "income desc 1", "2000-01-02", mockUserID, "USD", 555.0, mockID2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	dbMock.ExpectExec("INSERT INTO incomes.*").WillReturnResult(sqlmock.NewResult(0, 1))
 	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
 
@@ -372,9 +595,16 @@ func TestUpsertIncomes(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
 	dbMock.ExpectBegin()
 	dbMock.ExpectExec("INSERT INTO incomes.*").WillReturnResult(sqlmock.NewResult(0, 1))
-	dbMock.ExpectExec("INSERT INTO incomes.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM income_tags.*").WithArgs(mockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("INSERT INTO tags.*").WithArgs(mockUserID, "salary").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectExec("INSERT INTO income_tags.*").WithArgs(mockID, mockID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID2, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO incomes.*").WithArgs(mockID2, "income 1", "income desc 1", "2000-01-02", mockUserID, "USD", 555.0, mockID2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	dbMock.ExpectExec("INSERT INTO incomes.*").WillReturnResult(sqlmock.NewResult(0, 1))
 	dbMock.ExpectCommit()
 
@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"budgetingapi/pdf"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+// the statement page layout, in points from the top left corner
+const (
+	statementLeft   = 40.0
+	statementRight  = pdf.PageWidth - 40
+	statementBottom = pdf.PageHeight - 50
+	statementLine   = 16.0
+)
+
+// statementRow is a transaction of the statement table, expenses are negative
+type statementRow struct {
+	date        string
+	description string
+	category    string
+	currency    string
+	amount      float64
+}
+
+// GetStatementReport sends the printable statement of a month: the income
+// totals, the expense totals per category and every transaction of the month
+func (api *API) GetStatementReport(c *gin.Context) {
+	u := ParsePayload(c)
+
+	month, err := time.Parse(periodFormat, c.Query("month"))
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-month(yyyy-mm)")
+		return
+	}
+
+	userId := c.Query("user_id")
+	if u.Role == string(models.Customer) {
+		userId = u.Id
+	}
+
+	if _, err := uuid.FromString(userId); err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-user-id")
+		return
+	}
+
+	var name string
+	if err := api.Db.QueryRow("SELECT name FROM users WHERE id = $1 AND NOT deleted", userId).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			sendError(c, http.StatusNotFound, "user-not-found")
+			return
+		}
+
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	baseCurrency, err := parseBaseCurrency(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	baseCurrency, err = api.defaultBaseCurrency(userId, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	minDate := month.Format(dateFormat)
+	maxDate := month.AddDate(0, 1, -1).Format(dateFormat)
+
+	incomeFilter := models.IncomeFilter{
+		Income:  models.Income{UserId: userId},
+		MinDate: minDate,
+		MaxDate: maxDate,
+	}
+
+	expenseFilter := models.ExpenseFilter{
+		Expense: models.Expense{UserId: userId},
+		MinDate: minDate,
+		MaxDate: maxDate,
+	}
+
+	incomes, err := api.incomesReport(incomeFilter, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	expenses, err := api.expensesReport(expenseFilter, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := api.statementRows(expenseFilter, incomeFilter)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	now := time.Now().In(loc)
+
+	doc := pdf.New()
+	y := writeStatementHeader(doc, name, month, now)
+	y = writeStatementTotals(doc, y, incomes, expenses, currencies)
+	writeStatementRows(doc, y, rows, currencies)
+
+	fileName := fmt.Sprintf("report_statement_%s.pdf", now.Format("20060102_150405"))
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", "attachment;filename=\""+fileName+"\"")
+
+	if err := doc.Write(c.Writer); err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+}
+
+// statementRows merges the expenses and the incomes of the month by date
+func (api *API) statementRows(expenseFilter models.ExpenseFilter, incomeFilter models.IncomeFilter) (statement []statementRow, err error) {
+	filterQ, stms := getFilterExpense(expenseFilter)
+	q, args := expensesSelectQ(filterQ, stms, "")
+
+	rows, err := api.Db.Query(q+" ORDER BY e.date, e.created_at", args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		expense, err := scanExpense(rows, false)
+		if err != nil {
+			return nil, err
+		}
+
+		statement = append(statement, statementRow{expense.Date, expense.ProductName, expense.CategoryName, expense.Currency, -expense.Amount})
+	}
+
+	filterQ, stms = getFilterIncome(incomeFilter)
+	q, args = incomesSelectQ(filterQ, stms, "")
+
+	incomeRows, err := api.Db.Query(q+" ORDER BY date, created_at", args...)
+	if err != nil {
+		return
+	}
+
+	defer incomeRows.Close()
+
+	for incomeRows.Next() {
+		income, err := scanIncome(incomeRows, false)
+		if err != nil {
+			return nil, err
+		}
+
+		statement = append(statement, statementRow{income.Date, income.Name, "Income", income.Currency, income.Amount})
+	}
+
+	// the dates are yyyy-mm-dd so they sort as strings
+	sort.SliceStable(statement, func(i, j int) bool { return statement[i].date < statement[j].date })
+
+	return statement, nil
+}
+
+func writeStatementHeader(doc *pdf.Document, name string, month, now time.Time) float64 {
+	doc.AddPage()
+
+	doc.SetFont(pdf.HelveticaBold, 18)
+	doc.Text(statementLeft, 60, "Monthly Statement")
+
+	doc.SetFont(pdf.Helvetica, 11)
+	doc.Text(statementLeft, 82, name)
+	doc.TextRight(statementRight, 82, month.Format("January 2006"))
+
+	doc.SetFont(pdf.Helvetica, 8)
+	doc.TextRight(statementRight, 60, "Generated "+now.Format("2006-01-02 15:04:05")+" (Asia/Jakarta)")
+
+	doc.Line(statementLeft, 92, statementRight, 92)
+
+	return 92 + 2*statementLine
+}
+
+// statementSection writes a section title, a new page is started when the
+// title and a first line would not fit
+func statementSection(doc *pdf.Document, y float64, title string) float64 {
+	if y+2*statementLine > statementBottom {
+		doc.AddPage()
+		y = 60
+	}
+
+	doc.SetFont(pdf.HelveticaBold, 12)
+	doc.Text(statementLeft, y, title)
+
+	return y + statementLine + 4
+}
+
+// statementAmountLine writes a label and its amount, in bold for the totals
+func statementAmountLine(doc *pdf.Document, y float64, label, amount string, bold bool) float64 {
+	if y > statementBottom {
+		doc.AddPage()
+		y = 60
+	}
+
+	font := pdf.Helvetica
+	if bold {
+		font = pdf.HelveticaBold
+	}
+
+	doc.SetFont(font, 10)
+	doc.Text(statementLeft+10, y, doc.Truncate(label, 350))
+	doc.TextRight(statementRight, y, amount)
+
+	return y + statementLine
+}
+
+func sortedCurrencies(totals map[string]float64) []string {
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+
+	sort.Strings(currencies)
+
+	return currencies
+}
+
+func writeStatementTotals(doc *pdf.Document, y float64, incomes models.IncomeReport, expenses models.ExpenseReport,
+	currencies map[string]models.Currency) float64 {
+	y = statementSection(doc, y, "Income")
+
+	if len(incomes.Totals) == 0 {
+		y = statementAmountLine(doc, y, "No income this month", "", false)
+	}
+
+	for _, currency := range sortedCurrencies(incomes.Totals) {
+		y = statementAmountLine(doc, y, "Total income ("+currency+")", formatAmount(currency, incomes.Totals[currency], currencies), true)
+	}
+
+	if converted := incomes.Converted; converted != nil && len(incomes.Totals) > 0 {
+		y = statementAmountLine(doc, y, "Total income in "+converted.BaseCurrency, formatAmount(converted.BaseCurrency, converted.Total, currencies), true)
+	}
+
+	y = statementSection(doc, y+statementLine, "Expenses by category")
+
+	if len(expenses.Totals) == 0 {
+		y = statementAmountLine(doc, y, "No expenses this month", "", false)
+	}
+
+	for _, currency := range sortedCurrencies(expenses.Totals) {
+		categories := expenses.Reports[currency]
+		sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+
+		for _, category := range categories {
+			y = statementAmountLine(doc, y, category.Name, formatAmount(currency, category.Total, currencies), false)
+		}
+
+		y = statementAmountLine(doc, y, "Total expenses ("+currency+")", formatAmount(currency, expenses.Totals[currency], currencies), true)
+	}
+
+	if converted := expenses.Converted; converted != nil && len(expenses.Totals) > 0 {
+		y = statementAmountLine(doc, y, "Total expenses in "+converted.BaseCurrency, formatAmount(converted.BaseCurrency, converted.Total, currencies), true)
+	}
+
+	return y + statementLine
+}
+
+// the transaction table columns
+var statementColumns = []struct {
+	title string
+	x     float64
+	width float64
+}{
+	{"Date", statementLeft, 60},
+	{"Description", statementLeft + 65, 200},
+	{"Category", statementLeft + 270, 130},
+}
+
+func writeStatementTableHeader(doc *pdf.Document, y float64) float64 {
+	doc.SetFont(pdf.HelveticaBold, 10)
+	for _, column := range statementColumns {
+		doc.Text(column.x, y, column.title)
+	}
+
+	doc.TextRight(statementRight, y, "Amount")
+	doc.Line(statementLeft, y+4, statementRight, y+4)
+
+	return y + statementLine + 2
+}
+
+// writeStatementRows writes the transaction table, its header is repeated on
+// each page it runs over
+func writeStatementRows(doc *pdf.Document, y float64, rows []statementRow, currencies map[string]models.Currency) {
+	y = statementSection(doc, y, "Transactions")
+
+	if len(rows) == 0 {
+		statementAmountLine(doc, y, "No transactions this month", "", false)
+		return
+	}
+
+	y = writeStatementTableHeader(doc, y)
+
+	for _, row := range rows {
+		if y > statementBottom {
+			doc.AddPage()
+			y = writeStatementTableHeader(doc, 60)
+		}
+
+		amount := formatAmount(row.currency, row.amount, currencies)
+		if row.amount < 0 {
+			amount = "-" + formatAmount(row.currency, -row.amount, currencies)
+		}
+
+		doc.SetFont(pdf.Helvetica, 9)
+		for i, value := range []string{row.date, row.description, row.category} {
+			doc.Text(statementColumns[i].x, y, doc.Truncate(value, statementColumns[i].width))
+		}
+
+		doc.TextRight(statementRight, y, amount)
+
+		y += statementLine
+	}
+}
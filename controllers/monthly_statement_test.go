@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+// pdfText inflates the page contents of a pdf, its text is in there as is
+func pdfText(data []byte) string {
+	var text strings.Builder
+	for _, stream := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(stream[1]))
+		if err != nil {
+			continue
+		}
+
+		content, _ := ioutil.ReadAll(zr)
+		text.Write(content)
+	}
+
+	return text.String()
+}
+
+func TestGetStatementReport(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	expenseLabel := []string{"id", "category_id", "category_name", "category_description", "product_id",
+		"product_name", "product_description", "date", "currency", "amount",
+		"user_id", "created_at", "updated_at", "account_id", "tags"}
+	incomeLabel := []string{"id", "name", "description", "user_id", "date", "currency", "amount",
+		"created_at", "updated_at", "account_id", "tags"}
+
+	// invalid month (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("GET", "?month=2021-1", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetStatementReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-month(yyyy-mm)", genericResp.Message)
+
+	// invalid user id (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("GET", "?month=2021-01", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	api.GetStatementReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-user-id", genericResp.Message)
+
+	// user not found (404)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT name FROM users.*").WithArgs(mockUserID).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+	req, _ = http.NewRequest("GET", "?month=2021-01", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetStatementReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "user-not-found", genericResp.Message)
+
+	// err select incomes total (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT name FROM users.*").WithArgs(mockUserID).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Jane"))
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT currency, SUM.*").WillReturnError(errors.New("err-incomes"))
+
+	req, _ = http.NewRequest("GET", "?month=2021-01", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetStatementReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-incomes", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	minDate := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxDate := time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	dbMock.ExpectQuery("SELECT name FROM users.*").WithArgs(mockUserID).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Jane (home)"))
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT currency, SUM.*").WithArgs(mockUserID, minDate, maxDate).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "total"}).AddRow("IDR", 5000000))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WithArgs(mockUserID, minDate, maxDate).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "total"}).AddRow("IDR", 75000))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").WithArgs(mockUserID, minDate, maxDate).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "id", "name", "total"}).
+			AddRow("IDR", mockID, "Transport", 50000).
+			AddRow("IDR", mockID, "Food", 25000))
+	dbMock.ExpectQuery("SELECT e.id.*ORDER BY e.date, e.created_at$").WithArgs(mockUserID, minDate, maxDate).
+		WillReturnRows(sqlmock.NewRows(expenseLabel).
+			AddRow(mockID, mockID, "Food", "", mockID, "Coffee", "", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC), "IDR", 25000,
+				mockUserID, time.Now(), time.Now(), nil, nil).
+			AddRow(mockID, mockID, "Transport", "", mockID, "Train", "", time.Date(2021, 1, 20, 0, 0, 0, 0, time.UTC), "IDR", 50000,
+				mockUserID, time.Now(), time.Now(), nil, nil))
+	dbMock.ExpectQuery("SELECT id.*ORDER BY date, created_at$").WithArgs(mockUserID, minDate, maxDate).
+		WillReturnRows(sqlmock.NewRows(incomeLabel).
+			AddRow(mockID, "Salary", "", mockUserID, time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC), "IDR", 5000000,
+				time.Now(), time.Now(), nil, nil).
+			AddRow(mockID, "Refund", "", mockUserID, time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC), "USD", 12.5,
+				time.Now(), time.Now(), nil, nil))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+
+	req, _ = http.NewRequest("GET", "?month=2021-01", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetStatementReport(c)
+
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	fileName := fmt.Sprintf("report_statement_%s.pdf", time.Now().In(loc).Format("20060102_150405"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment;filename=\""+fileName+"\"", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, true, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-1.4")))
+
+	text := pdfText(w.Body.Bytes())
+	for _, expected := range []string{"(Monthly Statement)", "(Jane \\(home\\))", "(January 2021)",
+		"(Total income \\(IDR\\))", "(Rp 5,000,000.00)", "(Food)", "(Transport)", "(Rp 75,000.00)"} {
+		assert.Equal(t, true, strings.Contains(text, expected), expected)
+	}
+
+	// the transactions are merged by date, the expenses negative
+	coffee := strings.Index(text, "(2021-01-03)")
+	salary := strings.Index(text, "(2021-01-10)")
+	train := strings.Index(text, "(2021-01-20)")
+	assert.Equal(t, true, coffee > 0 && coffee < salary && salary < train)
+	assert.Equal(t, true, strings.Contains(text, "(-Rp 25,000.00)"))
+	// the symbol and the minor unit of the registry
+	assert.Equal(t, true, strings.Contains(text, "($ 12.50)"))
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	// 200 over several pages, each with the table header
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	expenseRows := sqlmock.NewRows(expenseLabel)
+	for i := 0; i < 100; i++ {
+		expenseRows.AddRow(mockID, mockID, "Food", "", mockID, "Coffee", "", minDate, "IDR", 25000,
+			mockUserID, time.Now(), time.Now(), nil, nil)
+	}
+
+	dbMock.ExpectQuery("SELECT name FROM users.*").WithArgs(mockUserID).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Jane"))
+	dbMock.ExpectQuery("SELECT currency, SUM.*").WillReturnRows(sqlmock.NewRows([]string{"currency", "total"}))
+	dbMock.ExpectQuery("SELECT SUM.*").WithArgs(mockUserID, minDate, maxDate, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"total", "missing"}).AddRow(nil, 0))
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WillReturnRows(sqlmock.NewRows([]string{"currency", "total"}).AddRow("IDR", 2500000))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").WillReturnRows(sqlmock.NewRows([]string{"currency", "id", "name", "total"}).
+		AddRow("IDR", mockID, "Food", 2500000))
+	dbMock.ExpectQuery("SELECT c.id, c.name, SUM.*").WithArgs(mockUserID, minDate, maxDate, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "total", "missing"}).AddRow(mockID, "Food", 178.5, 0))
+	dbMock.ExpectQuery("SELECT e.id.*").WillReturnRows(expenseRows)
+	dbMock.ExpectQuery("SELECT id.*").WillReturnRows(sqlmock.NewRows(incomeLabel))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+
+	req, _ = http.NewRequest("GET", "?month=2021-01&base_currency=usd", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetStatementReport(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	text = pdfText(w.Body.Bytes())
+	assert.Equal(t, true, strings.Contains(text, "(No income this month)"))
+	assert.Equal(t, true, strings.Contains(text, "(Total expenses in USD)"))
+	assert.Equal(t, true, strings.Contains(text, "($ 178.50)"))
+	assert.Equal(t, true, bytes.Contains(w.Body.Bytes(), []byte("/Count 3")))
+	assert.Equal(t, 3, strings.Count(text, "(Description)"))
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
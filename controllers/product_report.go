@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// GetExpensesProductsReport drills the expense report down to the products of
+// each category, with export_as_excel=true it is sent as an xlsx
+func (api *API) GetExpensesProductsReport(c *gin.Context) {
+	u := ParsePayload(c)
+	filter := expenseReportFilter(c, u)
+	asExcel, _ := strconv.ParseBool(c.Query("export_as_excel"))
+
+	report, err := api.productsReport(filter)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !asExcel {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	wb, err := newWorkbook(currencies, "Products")
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = wb.writeProductsSheet(report); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	fileName := fmt.Sprintf("report_products_%s.xlsx", time.Now().In(loc).Format("20060102_150405"))
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", "attachment;filename=\""+fileName+"\"")
+
+	if _, err := wb.WriteTo(c.Writer); err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+}
+
+// share is the percentage part of total, rounded like the amounts
+func share(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return roundAmount(part / total * 100)
+}
+
+// productsReport totals the split lines per currency, category and product.
+// A line is a transaction of its product.
+func (api *API) productsReport(filter models.ExpenseFilter) (report models.ProductReport, err error) {
+	filterQ, stms := getFilterExpenseLines(filter)
+
+	q := `SELECT e.currency, c.id, c.name, p.id, p.name, SUM(l.amount), COUNT(*), MIN(l.amount), MAX(l.amount)
+		FROM expenses e` + expenseLinesQ + `
+		JOIN products p ON l.product_id = p.id AND NOT p.deleted
+		JOIN categories c ON p.category_id = c.id
+		WHERE NOT e.deleted` + filterQ + `
+		GROUP BY e.currency, c.id, c.name, p.id, p.name
+		ORDER BY e.currency, c.name, c.id, p.name`
+
+	log.Println(q)
+
+	rows, err := api.Db.Query(q, stms...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	report.Reports = map[string][]models.CategoryProductsReport{}
+	report.Totals = map[string]float64{}
+
+	for rows.Next() {
+		var currency, categoryId, categoryName string
+		var product models.ProductTotalReport
+
+		if err = rows.Scan(&currency, &categoryId, &categoryName, &product.Id, &product.Name,
+			&product.Total, &product.Count, &product.Min, &product.Max); err != nil {
+			return
+		}
+
+		product.Average = roundAmount(product.Total / float64(product.Count))
+
+		// the rows come ordered, a category follows on from its last product
+		categories := report.Reports[currency]
+		if n := len(categories); n == 0 || categories[n-1].Id != categoryId {
+			categories = append(categories, models.CategoryProductsReport{Id: categoryId, Name: categoryName})
+		}
+
+		category := &categories[len(categories)-1]
+		category.Total += product.Total
+		category.Count += product.Count
+		category.Products = append(category.Products, product)
+
+		report.Reports[currency] = categories
+		report.Totals[currency] += product.Total
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for currency, categories := range report.Reports {
+		total := report.Totals[currency]
+
+		for i := range categories {
+			category := &categories[i]
+			for j := range category.Products {
+				category.Products[j].CategoryShare = share(category.Products[j].Total, category.Total)
+				category.Products[j].Share = share(category.Products[j].Total, total)
+			}
+
+			category.Total = roundAmount(category.Total)
+			category.Share = share(category.Total, total)
+		}
+
+		report.Totals[currency] = roundAmount(total)
+	}
+
+	return
+}
+
+// writeProductsSheet lists the products under their category, each currency
+// in its own block ending with its total
+func (wb *workbook) writeProductsSheet(report models.ProductReport) error {
+	sheet := "Products"
+
+	if err := wb.SetColWidth(sheet, "A", "J", 20); err != nil {
+		return err
+	}
+
+	var style excelize.Style
+	if err := json.Unmarshal([]byte(s2), &style); err != nil {
+		return err
+	}
+
+	// the shares are percentages, the built-in format 10 is 0.00%
+	style.NumFmt = 10
+	percentStyle, err := wb.NewStyle(&style)
+	if err != nil {
+		return err
+	}
+
+	n := 1
+	setRow := func(cells ...excelize.Cell) error {
+		for i, cell := range cells {
+			axis, _ := excelize.CoordinatesToCellName(i+1, n)
+			if err := wb.SetCellValue(sheet, axis, cell.Value); err != nil {
+				return err
+			}
+
+			if err := wb.SetCellStyle(sheet, axis, axis, cell.StyleID); err != nil {
+				return err
+			}
+		}
+
+		n++
+		return nil
+	}
+
+	text := func(style int, value interface{}) excelize.Cell {
+		return excelize.Cell{StyleID: style, Value: value}
+	}
+
+	percent := func(share float64) excelize.Cell {
+		return excelize.Cell{StyleID: percentStyle, Value: share / 100}
+	}
+
+	amounts := func(currency string, values ...float64) ([]excelize.Cell, error) {
+		cells := make([]excelize.Cell, len(values))
+		for i := range values {
+			cell, err := wb.amountCell(currency, &values[i])
+			if err != nil {
+				return nil, err
+			}
+
+			cells[i] = cell
+		}
+
+		return cells, nil
+	}
+
+	currencies := make([]string, 0, len(report.Reports))
+	for currency := range report.Reports {
+		currencies = append(currencies, currency)
+	}
+
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		header := []excelize.Cell{}
+		for _, title := range []string{"Currency", "Category", "Product", "Count", "Total (" + currency + ")",
+			"Average", "Min", "Max", "% of Category", "% of Total"} {
+			header = append(header, text(wb.headerStyle, title))
+		}
+
+		if err := setRow(header...); err != nil {
+			return err
+		}
+
+		for _, category := range report.Reports[currency] {
+			for _, product := range category.Products {
+				cells, err := amounts(currency, product.Total, product.Average, product.Min, product.Max)
+				if err != nil {
+					return err
+				}
+
+				row := []excelize.Cell{text(wb.dataStyle, currency), text(wb.dataStyle, category.Name),
+					text(wb.dataStyle, product.Name), text(wb.dataStyle, product.Count)}
+				row = append(row, cells...)
+				row = append(row, percent(product.CategoryShare), percent(product.Share))
+
+				if err := setRow(row...); err != nil {
+					return err
+				}
+			}
+
+			cells, err := amounts(currency, category.Total)
+			if err != nil {
+				return err
+			}
+
+			if err := setRow(text(wb.headerStyle, currency), text(wb.headerStyle, category.Name),
+				text(wb.headerStyle, "Subtotal"), text(wb.headerStyle, category.Count), cells[0],
+				text(wb.headerStyle, nil), text(wb.headerStyle, nil), text(wb.headerStyle, nil),
+				text(wb.headerStyle, nil), percent(category.Share)); err != nil {
+				return err
+			}
+		}
+
+		cells, err := amounts(currency, report.Totals[currency])
+		if err != nil {
+			return err
+		}
+
+		if err := setRow(text(wb.headerStyle, currency), text(wb.headerStyle, "Total"), text(wb.headerStyle, nil),
+			text(wb.headerStyle, nil), cells[0]); err != nil {
+			return err
+		}
+
+		// a blank row between the currencies
+		n++
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetExpensesProductsReport(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	label := []string{"currency", "category_id", "category_name", "product_id", "product_name", "total", "count", "min", "max"}
+	productRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(label).
+			AddRow("IDR", mockID, "Food", mockID, "Coffee", 75000, 3, 20000, 30000).
+			AddRow("IDR", mockID, "Food", mockID2, "Lunch", 25000, 1, 25000, 25000).
+			AddRow("IDR", mockID2, "Transport", mockID, "Train", 100000, 4, 25000, 25000).
+			AddRow("USD", mockID, "Food", mockID, "Coffee", 10, 3, 3, 4)
+	}
+
+	// err select (500)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT e.currency, c.id, c.name, p.id.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetExpensesProductsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// 200, a split expense counts for the product of its lines
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT e.currency, c.id, c.name, p.id.*e.user_id = \\$1 AND p.category_id = \\$2 AND l.product_id = \\$3.*GROUP BY e.currency, c.id, c.name, p.id, p.name").
+		WithArgs(mockUserID, mockID, mockID).WillReturnRows(productRows())
+
+	req, _ = http.NewRequest("GET", "?category_id="+mockID+"&product_id="+mockID, nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetExpensesProductsReport(c)
+
+	var report models.ProductReport
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.DeepEqual(t, map[string]float64{"IDR": 200000, "USD": 10}, report.Totals)
+
+	idr := report.Reports["IDR"]
+	assert.Equal(t, 2, len(idr))
+	assert.Equal(t, "Food", idr[0].Name)
+	assert.Equal(t, float64(100000), idr[0].Total)
+	assert.Equal(t, 4, idr[0].Count)
+	assert.Equal(t, float64(50), idr[0].Share)
+	assert.DeepEqual(t, models.ProductTotalReport{Id: mockID, Name: "Coffee", Total: 75000, Count: 3, Average: 25000,
+		Min: 20000, Max: 30000, CategoryShare: 75, Share: 37.5}, idr[0].Products[0])
+	assert.Equal(t, float64(25), idr[0].Products[1].CategoryShare)
+	assert.Equal(t, float64(100), idr[1].Products[0].CategoryShare)
+	assert.Equal(t, float64(3.33), report.Reports["USD"][0].Products[0].Average)
+	assert.Equal(t, float64(100), report.Reports["USD"][0].Share)
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	// 200 excel
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT e.currency, c.id, c.name, p.id.*").WithArgs(mockUserID).WillReturnRows(productRows())
+	dbMock.ExpectQuery("SELECT code, name, minor_unit.*").WillReturnRows(currencyRows())
+
+	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetExpensesProductsReport(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", w.Header().Get("Content-Type"))
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	f, err := excelize.OpenReader(bytes.NewReader(w.Body.Bytes()))
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []string{"Products"}, f.GetSheetList())
+
+	rows, err := f.GetRows("Products")
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []string{"Currency", "Category", "Product", "Count", "Total (IDR)",
+		"Average", "Min", "Max", "% of Category", "% of Total"}, rows[0])
+	assert.DeepEqual(t, []string{"IDR", "Food", "Coffee", "3", "75000", "25000", "20000", "30000", "75.00%", "37.50%"}, rows[1])
+	assert.DeepEqual(t, []string{"IDR", "Food", "Subtotal", "4", "100000", "", "", "", "", "50.00%"}, rows[3])
+	assert.DeepEqual(t, []string{"IDR", "Total", "", "", "200000"}, rows[6])
+	assert.DeepEqual(t, []string{"USD", "Food", "Coffee", "3", "10", "3.33", "3", "4", "100.00%", "100.00%"}, rows[9])
+}
@@ -29,6 +29,7 @@ func (api *API) GetProducts(c *gin.Context) {
 	categoryId := c.Query("category_id")
 
 	asExcel, _ := strconv.ParseBool(c.Query("export_as_excel"))
+	asCSV := strings.ToLower(c.Query("export")) == "csv"
 
 	if u.Role == string(models.Customer) {
 		userId = u.Id
@@ -87,6 +88,12 @@ func (api *API) GetProducts(c *gin.Context) {
 	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
 	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
 
+	// exports are the whole filtered list, not a page of it
+	if asExcel || asCSV {
+		api.exportProducts(c, selectQ+orderVal, stms, asCSV)
+		return
+	}
+
 	log.Println(selectQ + orderVal + pagination)
 
 	products, err = api.getProducts(selectQ+orderVal+pagination, stms)
@@ -96,11 +103,6 @@ func (api *API) GetProducts(c *gin.Context) {
 		return
 	}
 
-	if asExcel {
-		handleExcelProducts(c, products)
-		return
-	}
-
 	productList.Total, err = api.GetTotal(countQ, stms)
 	if err != nil {
 		log.Println(err)
@@ -160,14 +162,7 @@ func (api *API) UpsertProducts(c *gin.Context) {
 			continue
 		}
 
-		if _, err := tx.Exec(`
-		INSERT INTO products
-		(id, name, description, user_id, created_at, updated_at, category_id)
-		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $5)
-		ON CONFLICT(id) DO UPDATE SET
-		name = $2, description = $3, user_id = $4, updated_at = CURRENT_TIMESTAMP, deleted = false, category_id = $5
-		`, product.Id, product.Name, product.Description, product.UserId, product.CategoryId); err != nil {
-			log.Println(err)
+		if err := upsertProduct(tx, product); err != nil {
 			errProducts = append(errProducts, models.RowError{Row: i + 1, Message: err.Error()})
 			continue
 		}
@@ -190,12 +185,33 @@ func (api *API) UpsertProducts(c *gin.Context) {
 	c.JSON(code, obj)
 }
 
+func upsertProduct(tx *sql.Tx, product models.Product) error {
+	if _, err := tx.Exec(`
+		INSERT INTO products
+		(id, name, description, user_id, created_at, updated_at, category_id)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $5)
+		ON CONFLICT(id) DO UPDATE SET
+		name = $2, description = $3, user_id = $4, updated_at = CURRENT_TIMESTAMP, deleted = false, category_id = $5
+		`, product.Id, product.Name, product.Description, product.UserId, product.CategoryId); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
 func (api *API) DeleteProducts(c *gin.Context) {
 	api.BatchDeletes(c, "products")
 }
 
-func handleExcelProducts(c *gin.Context, products []models.Product) {
-	if len(products) == 0 {
+func handleExcelProducts(c *gin.Context, cur *exportCursor) {
+	if !cur.Next() {
+		if err := cur.Err(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
 		sendError(c, http.StatusNotFound, "products-not-found")
 		return
 	}
@@ -207,7 +223,7 @@ func handleExcelProducts(c *gin.Context, products []models.Product) {
 	// delete default sheet
 	f.DeleteSheet("Sheet1")
 
-	err := f.SetColWidth(sheet, "A", "E", 50)
+	err := f.SetColWidth(sheet, "A", "F", 50)
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -236,14 +252,22 @@ func handleExcelProducts(c *gin.Context, products []models.Product) {
 		excelize.Cell{StyleID: headerStyle, Value: "Name"},
 		excelize.Cell{StyleID: headerStyle, Value: "Description"},
 		excelize.Cell{StyleID: headerStyle, Value: "Created At"},
-		excelize.Cell{StyleID: headerStyle, Value: "Updated At"}}); err != nil {
+		excelize.Cell{StyleID: headerStyle, Value: "Updated At"},
+		excelize.Cell{StyleID: headerStyle, Value: "ID"}}); err != nil {
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	loc, _ := time.LoadLocation("Asia/Jakarta")
 
-	for n, product := range products {
+	for n := 0; ; n++ {
+		product, err := scanProduct(cur)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
 		createdAt := product.CreatedAt.In(loc).Format("2006-01-02 15:04:05")
 		updatedAt := product.UpdatedAt.In(loc).Format("2006-01-02 15:04:05")
 
@@ -251,18 +275,29 @@ func handleExcelProducts(c *gin.Context, products []models.Product) {
 			updatedAt = "-"
 		}
 
-		row := make([]interface{}, 5)
+		row := make([]interface{}, 6)
 		row[0] = excelize.Cell{StyleID: dataStyle, Value: product.CategoryName}
 		row[1] = excelize.Cell{StyleID: dataStyle, Value: product.Name}
 		row[2] = excelize.Cell{StyleID: dataStyle, Value: product.Description}
 		row[3] = excelize.Cell{StyleID: dataStyle, Value: createdAt}
 		row[4] = excelize.Cell{StyleID: dataStyle, Value: updatedAt}
+		row[5] = excelize.Cell{StyleID: dataStyle, Value: product.Id}
 
 		cell, _ := excelize.CoordinatesToCellName(1, n+2)
 		if err = streamWriter.SetRow(cell, row); err != nil {
 			sendError(c, http.StatusInternalServerError, err.Error())
 			return
 		}
+
+		if !cur.Next() {
+			break
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	if err := streamWriter.Flush(); err != nil {
@@ -294,20 +329,12 @@ func (api *API) getProducts(q string, stms []interface{}) (products []models.Pro
 
 	for rows.Next() {
 		var product models.Product
-		var name, description, userId, categoryId, categoryName, categoryDescription sql.NullString
-		err = rows.Scan(&product.Id, &name, &description, &userId, &categoryId, &product.CreatedAt, &product.UpdatedAt, &categoryName, &categoryDescription)
+		product, err = scanProduct(rows)
 		if err != nil {
 			log.Println(err)
 			return
 		}
 
-		product.Name = name.String
-		product.Description = description.String
-		product.UserId = userId.String
-		product.CategoryId = categoryId.String
-		product.CategoryName = categoryName.String
-		product.CategoryDescription = categoryDescription.String
-
 		products = append(products, product)
 	}
 
@@ -315,6 +342,53 @@ func (api *API) getProducts(q string, stms []interface{}) (products []models.Pro
 
 }
 
+// exportProducts walks the whole filtered list through a cursor into the
+// excel or the csv export
+func (api *API) exportProducts(c *gin.Context, q string, stms []interface{}, asCSV bool) {
+	cur, err := api.openExportCursor(q, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer cur.Close()
+
+	if !asCSV {
+		handleExcelProducts(c, cur)
+		return
+	}
+
+	header := []string{"id", "name", "description", "category_id", "category_name", "user_id", "created_at", "updated_at"}
+
+	streamCSV(c, "products", header, cur, func() ([]string, error) {
+		product, err := scanProduct(cur)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{product.Id, product.Name, product.Description, product.CategoryId, product.CategoryName,
+			product.UserId, product.CreatedAt.Format(time.RFC3339), product.UpdatedAt.Format(time.RFC3339)}, nil
+	})
+}
+
+func scanProduct(rows rowScanner) (product models.Product, err error) {
+	var name, description, userId, categoryId, categoryName, categoryDescription sql.NullString
+	err = rows.Scan(&product.Id, &name, &description, &userId, &categoryId, &product.CreatedAt, &product.UpdatedAt, &categoryName, &categoryDescription)
+	if err != nil {
+		return
+	}
+
+	product.Name = name.String
+	product.Description = description.String
+	product.UserId = userId.String
+	product.CategoryId = categoryId.String
+	product.CategoryName = categoryName.String
+	product.CategoryDescription = categoryDescription.String
+
+	return
+}
+
 func getFilterProduct(userId, name, description, categoryId string) (filterQ string, stms []interface{}) {
 	if _, err := uuid.FromString(userId); err == nil {
 		filterQ = fmt.Sprintf(" AND p.user_id = $%d", len(stms)+1)
@@ -104,8 +104,7 @@ func TestGetProducts(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT p.id.*").WithArgs(mockUserID).
-		WillReturnRows(sqlmock.NewRows(label))
+	expectExportCursor(dbMock, "SELECT p.id.*", sqlmock.NewRows(label), mockUserID)
 
 	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
 	c.Request = req
@@ -121,9 +120,10 @@ func TestGetProducts(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	dbMock.ExpectQuery("SELECT p.id.*").WithArgs(mockUserID).
-		WillReturnRows(sqlmock.NewRows(label).AddRow(mockID, "dummy", "dummy", mockUserID, mockID, time.Now(), time.Now(), "", ""))
-	req, _ = http.NewRequest("GET", "?export_as_excel=true", nil)
+	expectExportCursor(dbMock, "SELECT p.id.*ORDER BY p.updated_at DESC$",
+		sqlmock.NewRows(label).AddRow(mockID, "dummy", "dummy", mockUserID, mockID, time.Now(), time.Now(), "", ""),
+		mockUserID)
+	req, _ = http.NewRequest("GET", "?export_as_excel=true&page=4", nil)
 	c.Request = req
 	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
 	api.GetProducts(c)
@@ -135,6 +135,52 @@ func TestGetProducts(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "attachment;filename=\""+fileName+"\"", w.Header()["Content-Disposition"][0])
 
+	// as csv
+	// err fetch (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DECLARE export_cursor.*SELECT p.id.*").WithArgs(mockUserID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("FETCH FORWARD.*").WillReturnError(fmt.Errorf("err-fetch"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("GET", "?export=csv", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetProducts(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-fetch", genericResp.Message)
+
+	// 200, the whole list without pagination
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	createdAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	expectExportCursor(dbMock, "SELECT p.id.*ORDER BY p.updated_at DESC$",
+		sqlmock.NewRows(label).
+			AddRow(mockID, "Coffee", "Morning, hot", mockUserID, mockID, createdAt, createdAt, "Food", "").
+			AddRow(mockUserID, "Tea", "", mockUserID, mockID, createdAt, createdAt, "Food", ""),
+		mockUserID)
+
+	req, _ = http.NewRequest("GET", "?export=csv&page=2&limit=1", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetProducts(c)
+
+	fileName = fmt.Sprintf("report_products_%s.csv", time.Now().In(loc).Format("20060102_150405"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment;filename=\""+fileName+"\"", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id,name,description,category_id,category_name,user_id,created_at,updated_at\n"+
+		mockID+",Coffee,\"Morning, hot\","+mockID+",Food,"+mockUserID+",2021-01-02T03:04:05Z,2021-01-02T03:04:05Z\n"+
+		mockUserID+",Tea,,"+mockID+",Food,"+mockUserID+",2021-01-02T03:04:05Z,2021-01-02T03:04:05Z\n", w.Body.String())
+
 }
 
 func TestUpsertProducts(t *testing.T) {
@@ -0,0 +1,554 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+func (api *API) GetRecurringTransactions(c *gin.Context) {
+	u := ParsePayload(c)
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	order := c.Query("order")
+	orderBy := c.Query("order_by")
+
+	filter := models.RecurringTransaction{
+		UserId:    c.Query("user_id"),
+		Type:      strings.ToUpper(c.Query("type")),
+		ProductId: c.Query("product_id"),
+		Frequency: strings.ToUpper(c.Query("frequency")),
+		Currency:  strings.ToUpper(c.Query("currency")),
+	}
+
+	if u.Role == string(models.Customer) {
+		filter.UserId = u.Id
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	if strings.ToUpper(order) != "ASC" && strings.ToUpper(order) != "DESC" {
+		order = "DESC"
+	}
+
+	mapOrderBy := map[string]string{
+		"id":         "id",
+		"user_id":    "user_id",
+		"type":       "type",
+		"name":       "name",
+		"currency":   "currency",
+		"amount":     "amount",
+		"frequency":  "frequency",
+		"start_date": "start_date",
+		"next_date":  "next_date",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	}
+
+	if val, ok := mapOrderBy[orderBy]; ok {
+		orderBy = val
+	} else {
+		orderBy = "updated_at"
+	}
+
+	countQ := `SELECT COUNT(1) FROM recurring_transactions
+		WHERE NOT deleted`
+	selectQ := `SELECT
+			id, user_id, type, product_id, name, description,
+			currency, amount, frequency, interval, start_date, end_date,
+			count, generated, next_date, created_at, updated_at
+		FROM recurring_transactions
+		WHERE NOT deleted`
+
+	var recurringList models.RecurringTransactionList
+	var recurrings []models.RecurringTransaction
+	var err error
+
+	filterQ, stms := getFilterRecurringTransaction(filter)
+
+	selectQ = selectQ + filterQ
+	countQ = countQ + filterQ
+
+	offset := (page - 1) * limit
+	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
+	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+
+	log.Println(selectQ + orderVal + pagination)
+
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var recurring models.RecurringTransaction
+		var productId, name, description sql.NullString
+		var count sql.NullInt64
+		var startDate, endDate, nextDate sql.NullTime
+
+		err = rows.Scan(&recurring.Id, &recurring.UserId, &recurring.Type, &productId, &name, &description,
+			&recurring.Currency, &recurring.Amount, &recurring.Frequency, &recurring.Interval, &startDate, &endDate,
+			&count, &recurring.Generated, &nextDate, &recurring.CreatedAt, &recurring.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		recurring.ProductId = productId.String
+		recurring.Name = name.String
+		recurring.Description = description.String
+		recurring.Count = int(count.Int64)
+
+		if startDate.Valid {
+			recurring.StartDate = startDate.Time.Format(dateFormat)
+		}
+
+		if endDate.Valid {
+			recurring.EndDate = endDate.Time.Format(dateFormat)
+		}
+
+		if nextDate.Valid {
+			recurring.NextDate = nextDate.Time.Format(dateFormat)
+		}
+
+		recurrings = append(recurrings, recurring)
+	}
+
+	recurringList.Total, err = api.GetTotal(countQ, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	recurringList.RecurringTransactions = recurrings
+	recurringList.Limit = limit
+	recurringList.Page = page
+
+	c.JSON(http.StatusOK, recurringList)
+}
+
+// UpsertRecurringTransactions restarts the schedule of updated rows from their
+// start date when the start date, frequency or interval changed, occurrences
+// already materialised are not created twice. Other edits keep the schedule
+// going, a finished one resumes when its count or end date is extended.
+func (api *API) UpsertRecurringTransactions(c *gin.Context) {
+	u := ParsePayload(c)
+	var payload models.UpsertRecurringTransactionRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	recurrings := payload.Data
+	if len(recurrings) == 0 {
+		sendError(c, http.StatusBadRequest, "missing-recurring-transactions")
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var errRecurrings []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	customer := false
+	if u.Role == string(models.Customer) {
+		customer = true
+	}
+
+	for i, recurring := range recurrings {
+		if customer {
+			recurring.UserId = u.Id
+		}
+
+		if _, err := uuid.FromString(recurring.Id); err != nil {
+			recurring.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateRecurringTransaction(&recurring, currencies); err != nil {
+			errRecurrings = append(errRecurrings, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		generated, next, err := recurringProgress(tx, recurring)
+		if err != nil {
+			log.Println(err)
+			errRecurrings = append(errRecurrings, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO recurring_transactions
+		(id, user_id, type, product_id, name, description, currency, amount, frequency,
+		interval, start_date, end_date, count, generated, next_date, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::UUID, $5, $6, $7, $8, $9,
+		$10, $11, NULLIF($12, '')::DATE, NULLIF($13, 0), $14, $15, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+		user_id = $2, type = $3, product_id = NULLIF($4, '')::UUID, name = $5, description = $6, currency = $7, amount = $8, frequency = $9,
+		interval = $10, start_date = $11, end_date = NULLIF($12, '')::DATE, count = NULLIF($13, 0), generated = $14, next_date = $15,
+		updated_at = CURRENT_TIMESTAMP, deleted = false
+		`, recurring.Id, recurring.UserId, recurring.Type, recurring.ProductId, recurring.Name, recurring.Description,
+			recurring.Currency, recurring.Amount, recurring.Frequency, recurring.Interval, recurring.StartDate,
+			recurring.EndDate, recurring.Count, generated, next); err != nil {
+			log.Println(err)
+			errRecurrings = append(errRecurrings, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+	}
+
+	code := http.StatusInternalServerError
+	obj := gin.H{"message": "error", "details": errRecurrings}
+
+	if len(errRecurrings) == 0 {
+		if err := tx.Commit(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		code = http.StatusOK
+		obj = gin.H{"message": "success", "total": len(recurrings)}
+	}
+
+	c.JSON(code, obj)
+}
+
+func (api *API) DeleteRecurringTransactions(c *gin.Context) {
+	api.BatchDeletes(c, "recurring_transactions")
+}
+
+// MaterializeRecurring creates the expenses and incomes of every schedule due
+// on or before now and returns how many were created. It is safe to run
+// concurrently and repeatedly.
+func (api *API) MaterializeRecurring(now time.Time) (total int, err error) {
+	today, _ := time.Parse(dateFormat, now.Format(dateFormat))
+
+	rows, err := api.Db.Query(`SELECT id FROM recurring_transactions
+		WHERE NOT deleted AND next_date IS NOT NULL AND next_date <= $1`, today)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			log.Println(err)
+			rows.Close()
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	for _, id := range ids {
+		n, err := api.materializeRecurring(id, today)
+		if err != nil {
+			// keep going, the schedule is retried on the next run
+			log.Println(id, err)
+			continue
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+func (api *API) materializeRecurring(id string, today time.Time) (int, error) {
+	tx, err := api.Db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var recurring models.RecurringTransaction
+	var productId, name, description sql.NullString
+	var count sql.NullInt64
+	var start time.Time
+	var end sql.NullTime
+
+	// another instance holding the lock is already materialising it
+	err = tx.QueryRow(`SELECT
+			user_id, type, product_id, name, description, currency, amount,
+			frequency, interval, start_date, end_date, count, generated
+		FROM recurring_transactions
+		WHERE id = $1 AND NOT deleted
+		FOR UPDATE SKIP LOCKED`, id).
+		Scan(&recurring.UserId, &recurring.Type, &productId, &name, &description, &recurring.Currency, &recurring.Amount,
+			&recurring.Frequency, &recurring.Interval, &start, &end, &count, &recurring.Generated)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var next *time.Time
+
+	for {
+		if count.Valid && recurring.Generated >= int(count.Int64) {
+			break
+		}
+
+		date := occurrence(start, models.Frequency(recurring.Frequency), recurring.Interval, recurring.Generated)
+		if end.Valid && date.After(end.Time) {
+			break
+		}
+
+		if date.After(today) {
+			next = &date
+			break
+		}
+
+		var q string
+		var stms []interface{}
+
+		if recurring.Type == string(models.ExpenseTransaction) {
+			q = `INSERT INTO expenses
+				(product_id, date, user_id, currency, amount, recurring_id, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+				ON CONFLICT(recurring_id, date) WHERE recurring_id IS NOT NULL DO NOTHING`
+			stms = []interface{}{productId.String, date, recurring.UserId, recurring.Currency, recurring.Amount, id}
+		} else {
+			q = `INSERT INTO incomes
+				(name, description, date, user_id, currency, amount, recurring_id, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+				ON CONFLICT(recurring_id, date) WHERE recurring_id IS NOT NULL DO NOTHING`
+			stms = []interface{}{name.String, description.String, date, recurring.UserId, recurring.Currency, recurring.Amount, id}
+		}
+
+		tag, err := tx.Exec(q, stms...)
+		if err != nil {
+			return 0, err
+		}
+
+		t, _ := tag.RowsAffected()
+		total += int(t)
+		recurring.Generated++
+	}
+
+	// a NULL next_date marks a finished schedule
+	if _, err := tx.Exec(`UPDATE recurring_transactions SET generated = $1, next_date = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3`, recurring.Generated, next, id); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// recurringProgress returns the occurrences the upserted schedule keeps as
+// generated and its next date, nil once finished. A new start date, frequency
+// or interval starts it over from the start date: the occurrences made with
+// the former timing are kept and do not count towards its count.
+func recurringProgress(tx *sql.Tx, recurring models.RecurringTransaction) (generated int, next *time.Time, err error) {
+	var start time.Time
+	var frequency string
+	var interval, stored int
+
+	err = tx.QueryRow(`SELECT start_date, frequency, interval, generated FROM recurring_transactions WHERE id = $1 FOR UPDATE`, recurring.Id).
+		Scan(&start, &frequency, &interval, &stored)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+
+	newStart, _ := time.Parse(dateFormat, recurring.StartDate)
+	if err == nil && start.Equal(newStart) && frequency == recurring.Frequency && interval == recurring.Interval {
+		generated = stored
+	}
+
+	if recurring.Count > 0 && generated >= recurring.Count {
+		return generated, nil, nil
+	}
+
+	date := occurrence(newStart, models.Frequency(recurring.Frequency), recurring.Interval, generated)
+	if end, err := time.Parse(dateFormat, recurring.EndDate); err == nil && date.After(end) {
+		return generated, nil, nil
+	}
+
+	return generated, &date, nil
+}
+
+// occurrence returns the n-th date (from 0) of a schedule. It is computed
+// from start every time, so monthly and yearly schedules on the 31st clamp to
+// the end of shorter months without drifting afterwards.
+func occurrence(start time.Time, frequency models.Frequency, interval, n int) time.Time {
+	switch frequency {
+	case models.Daily:
+		return start.AddDate(0, 0, n*interval)
+	case models.Weekly:
+		return start.AddDate(0, 0, 7*n*interval)
+	case models.Yearly:
+		return addMonths(start, 12*n*interval)
+	}
+
+	return addMonths(start, n*interval)
+}
+
+func addMonths(date time.Time, months int) time.Time {
+	first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location()).AddDate(0, months, 0)
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	day := date.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+
+	return first.AddDate(0, 0, day-1)
+}
+
+func getFilterRecurringTransaction(filter models.RecurringTransaction) (filterQ string, stms []interface{}) {
+	if _, err := uuid.FromString(filter.UserId); err == nil {
+		filterQ = fmt.Sprintf(" AND user_id = $%d", len(stms)+1)
+		stms = append(stms, filter.UserId)
+	}
+
+	if filter.Type != "" {
+		filterQ += fmt.Sprintf(" AND type = $%d", len(stms)+1)
+		stms = append(stms, filter.Type)
+	}
+
+	if _, err := uuid.FromString(filter.ProductId); err == nil {
+		filterQ += fmt.Sprintf(" AND product_id = $%d", len(stms)+1)
+		stms = append(stms, filter.ProductId)
+	}
+
+	if filter.Frequency != "" {
+		filterQ += fmt.Sprintf(" AND frequency = $%d", len(stms)+1)
+		stms = append(stms, filter.Frequency)
+	}
+
+	if isCurrencyCode(filter.Currency) {
+		filterQ += fmt.Sprintf(" AND currency = $%d", len(stms)+1)
+		stms = append(stms, filter.Currency)
+	}
+
+	return
+}
+
+func validateRecurringTransaction(recurring *models.RecurringTransaction, currencies map[string]models.Currency) error {
+	recurring.Type = strings.ToUpper(recurring.Type)
+	recurring.Frequency = strings.ToUpper(recurring.Frequency)
+
+	if recurring.Type == "" {
+		return errors.New("missing-type")
+	}
+
+	if recurring.Frequency == "" {
+		return errors.New("missing-frequency")
+	}
+
+	if recurring.StartDate == "" {
+		return errors.New("missing-start-date")
+	}
+
+	if recurring.Currency == "" {
+		return errors.New("missing-currency")
+	}
+
+	if recurring.Amount == 0 {
+		return errors.New("missing-amount")
+	}
+
+	if _, err := uuid.FromString(recurring.UserId); err != nil {
+		return errors.New("invalid-user-id")
+	}
+
+	switch models.TransactionType(recurring.Type) {
+	case models.ExpenseTransaction:
+		if _, err := uuid.FromString(recurring.ProductId); err != nil {
+			return errors.New("invalid-product-id")
+		}
+
+		recurring.Name = ""
+		recurring.Description = ""
+	case models.IncomeTransaction:
+		if recurring.Name == "" {
+			return errors.New("missing-name")
+		}
+
+		recurring.ProductId = ""
+	default:
+		return errors.New("invalid-type(expense|income)")
+	}
+
+	switch models.Frequency(recurring.Frequency) {
+	case models.Daily, models.Weekly, models.Monthly, models.Yearly:
+	default:
+		return errors.New("invalid-frequency(daily|weekly|monthly|yearly)")
+	}
+
+	if recurring.Interval == 0 {
+		recurring.Interval = 1
+	}
+
+	if recurring.Interval < 0 {
+		return errors.New("interval-shall-be-positive")
+	}
+
+	if recurring.Count < 0 {
+		return errors.New("count-shall-be-positive")
+	}
+
+	start, err := time.Parse(dateFormat, recurring.StartDate)
+	if err != nil {
+		return errors.New("invalid-start-date(yyyy-mm-dd)")
+	}
+
+	if recurring.EndDate != "" {
+		end, err := time.Parse(dateFormat, recurring.EndDate)
+		if err != nil {
+			return errors.New("invalid-end-date(yyyy-mm-dd)")
+		}
+
+		if end.Before(start) {
+			return errors.New("end-date-shall-be-after-start-date")
+		}
+	}
+
+	return validateAmountCurrency(&recurring.Currency, recurring.Amount, currencies)
+}
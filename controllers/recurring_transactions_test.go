@@ -0,0 +1,535 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetRecurringTransactions(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// err select (500)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM recurring_transactions.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// scan error (500)
+	label := []string{
+		"id", "user_id", "type", "product_id", "name", "description",
+		"currency", "amount", "frequency", "interval", "start_date", "end_date",
+		"count", "generated", "next_date", "created_at", "updated_at",
+	}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM recurring_transactions.*").
+		WillReturnRows(sqlmock.NewRows(label[15:]).AddRow(time.Now(), time.Now()))
+
+	req, _ = http.NewRequest("GET", "?order_by=next_date", nil)
+	c.Request = req
+	api.GetRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 2 destination arguments in Scan, not 17", genericResp.Message)
+
+	// err count (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM recurring_transactions.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, "EXPENSE", mockID, nil, nil,
+				"IDR", 3500000, "MONTHLY", 1, time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), nil,
+				nil, 3, time.Date(2022, 4, 30, 0, 0, 0, 0, time.UTC), time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-count", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM recurring_transactions.*").WithArgs(mockUserID, "INCOME", "MONTHLY", "IDR").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, "INCOME", nil, "Salary", "Monthly salary",
+				"IDR", 15000000, "MONTHLY", 1, time.Date(2022, 1, 25, 0, 0, 0, 0, time.UTC), time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC),
+				12, 12, nil, time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	q := url.Values{}
+	q.Add("type", "income")
+	q.Add("frequency", "monthly")
+	q.Add("currency", "idr")
+
+	req, _ = http.NewRequest("GET", "", nil)
+	req.URL.RawQuery = q.Encode()
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetRecurringTransactions(c)
+
+	var resp models.RecurringTransactionList
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, int(resp.Total))
+	assert.Equal(t, 1, len(resp.RecurringTransactions))
+	assert.Equal(t, "Salary", resp.RecurringTransactions[0].Name)
+	assert.Equal(t, "2022-01-25", resp.RecurringTransactions[0].StartDate)
+	assert.Equal(t, "2022-12-31", resp.RecurringTransactions[0].EndDate)
+	assert.Equal(t, 12, resp.RecurringTransactions[0].Count)
+	assert.Equal(t, "", resp.RecurringTransactions[0].NextDate)
+}
+
+func TestUpsertRecurringTransactions(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+
+	// nil request (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// bad request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.UpsertRecurringTransactionRequest{})
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-recurring-transactions", genericResp.Message)
+
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertRecurringTransactionRequest{Data: []models.RecurringTransaction{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-currencies"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-currencies", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertRecurringTransactionRequest{Data: []models.RecurringTransaction{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// recurring transactions validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	expense := models.RecurringTransaction{
+		UserId:    mockUserID,
+		Type:      "expense",
+		ProductId: mockID,
+		Currency:  "IDR",
+		Amount:    3500000,
+		Frequency: "monthly",
+		StartDate: "2022-01-31",
+	}
+	progressLabel := []string{"start_date", "frequency", "interval", "generated"}
+	withChange := func(change func(r *models.RecurringTransaction)) models.RecurringTransaction {
+		r := expense
+		change(&r)
+		return r
+	}
+	recurrings := models.UpsertRecurringTransactionRequest{Data: []models.RecurringTransaction{
+		{},
+		{Type: "expense"},
+		{Type: "expense", Frequency: "monthly"},
+		{Type: "expense", Frequency: "monthly", StartDate: "2022-01-31"},
+		{Type: "expense", Frequency: "monthly", StartDate: "2022-01-31", Currency: "IDR"},
+		{Type: "expense", Frequency: "monthly", StartDate: "2022-01-31", Currency: "IDR", Amount: 1},
+		withChange(func(r *models.RecurringTransaction) { r.ProductId = "err" }),
+		withChange(func(r *models.RecurringTransaction) { r.Type = "income" }),
+		withChange(func(r *models.RecurringTransaction) { r.Type = "transfer" }),
+		withChange(func(r *models.RecurringTransaction) { r.Frequency = "hourly" }),
+		withChange(func(r *models.RecurringTransaction) { r.Interval = -1 }),
+		withChange(func(r *models.RecurringTransaction) { r.Count = -1 }),
+		withChange(func(r *models.RecurringTransaction) { r.StartDate = "31-01-2022" }),
+		withChange(func(r *models.RecurringTransaction) { r.EndDate = "31-12-2022" }),
+		withChange(func(r *models.RecurringTransaction) { r.EndDate = "2021-12-31" }),
+		withChange(func(r *models.RecurringTransaction) { r.Currency = "EUR" }),
+		expense,
+	}}
+	payload = parsePayload(recurrings)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT start_date, frequency, interval, generated FROM recurring_transactions.*FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows(progressLabel))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").
+		WithArgs(sqlmock.AnyArg(), mockUserID, "EXPENSE", mockID, "", "", "IDR", 3500000.0, "MONTHLY", 1, "2022-01-31", "", 0,
+			0, time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)).
+		WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 17, len(respErrors.Details))
+	assert.Equal(t, "missing-type", respErrors.Details[0].Message)
+	assert.Equal(t, "missing-frequency", respErrors.Details[1].Message)
+	assert.Equal(t, "missing-start-date", respErrors.Details[2].Message)
+	assert.Equal(t, "missing-currency", respErrors.Details[3].Message)
+	assert.Equal(t, "missing-amount", respErrors.Details[4].Message)
+	assert.Equal(t, "invalid-user-id", respErrors.Details[5].Message)
+	assert.Equal(t, "invalid-product-id", respErrors.Details[6].Message)
+	assert.Equal(t, "missing-name", respErrors.Details[7].Message)
+	assert.Equal(t, "invalid-type(expense|income)", respErrors.Details[8].Message)
+	assert.Equal(t, "invalid-frequency(daily|weekly|monthly|yearly)", respErrors.Details[9].Message)
+	assert.Equal(t, "interval-shall-be-positive", respErrors.Details[10].Message)
+	assert.Equal(t, "count-shall-be-positive", respErrors.Details[11].Message)
+	assert.Equal(t, "invalid-start-date(yyyy-mm-dd)", respErrors.Details[12].Message)
+	assert.Equal(t, "invalid-end-date(yyyy-mm-dd)", respErrors.Details[13].Message)
+	assert.Equal(t, "end-date-shall-be-after-start-date", respErrors.Details[14].Message)
+	assert.Equal(t, "unsupported-currency", respErrors.Details[15].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[16].Message)
+
+	// err select schedule (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	recurrings = models.UpsertRecurringTransactionRequest{Data: []models.RecurringTransaction{
+		expense,
+		{Type: "income", Name: "Salary", Currency: "IDR", Amount: 15000000, Frequency: "monthly", StartDate: "2022-01-25", Count: 12},
+	}}
+	payload = parsePayload(recurrings)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WillReturnRows(sqlmock.NewRows(progressLabel))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WillReturnError(fmt.Errorf("err-select"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, 1, len(respErrors.Details))
+	assert.Equal(t, 2, respErrors.Details[0].Row)
+	assert.Equal(t, "err-select", respErrors.Details[0].Message)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(recurrings)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WillReturnRows(sqlmock.NewRows(progressLabel))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WillReturnRows(sqlmock.NewRows(progressLabel))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").
+		WithArgs(sqlmock.AnyArg(), mockUserID, "INCOME", "", "Salary", "", "IDR", 15000000.0, "MONTHLY", 1, "2022-01-25", "", 12,
+			0, time.Date(2022, 1, 25, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	stored := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	recurrings = models.UpsertRecurringTransactionRequest{Data: []models.RecurringTransaction{
+		withChange(func(r *models.RecurringTransaction) { r.Id = mockID; r.Amount = 3750000 }),
+		withChange(func(r *models.RecurringTransaction) { r.Id = mockID; r.Count = 6 }),
+		withChange(func(r *models.RecurringTransaction) { r.Id = mockID; r.Count = 3 }),
+		withChange(func(r *models.RecurringTransaction) { r.Id = mockID; r.EndDate = "2022-12-31" }),
+		withChange(func(r *models.RecurringTransaction) { r.Id = mockID; r.Interval = 2 }),
+	}}
+	payload = parsePayload(recurrings)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	// editing only the amount keeps what was generated and the next date, no
+	// occurrence is created again
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(progressLabel).AddRow(stored, "MONTHLY", 1, 3))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").
+		WithArgs(mockID, mockUserID, "EXPENSE", mockID, "", "", "IDR", 3750000.0, "MONTHLY", 1, "2022-01-31", "", 0,
+			3, time.Date(2022, 4, 30, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// a schedule finished by its count resumes when the count is raised
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(progressLabel).AddRow(stored, "MONTHLY", 1, 3))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").
+		WithArgs(mockID, mockUserID, "EXPENSE", mockID, "", "", "IDR", 3500000.0, "MONTHLY", 1, "2022-01-31", "", 6,
+			3, time.Date(2022, 4, 30, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// and finishes again when it is lowered
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(progressLabel).AddRow(stored, "MONTHLY", 1, 3))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").
+		WithArgs(mockID, mockUserID, "EXPENSE", mockID, "", "", "IDR", 3500000.0, "MONTHLY", 1, "2022-01-31", "", 3,
+			3, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// so does one finished by its end date when the end date is pushed back
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(progressLabel).AddRow(stored, "MONTHLY", 1, 3))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").
+		WithArgs(mockID, mockUserID, "EXPENSE", mockID, "", "", "IDR", 3500000.0, "MONTHLY", 1, "2022-01-31", "2022-12-31", 0,
+			3, time.Date(2022, 4, 30, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// a new interval starts over from the start date
+	dbMock.ExpectQuery("SELECT start_date.*FROM recurring_transactions.*").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(progressLabel).AddRow(stored, "MONTHLY", 1, 3))
+	dbMock.ExpectExec("INSERT INTO recurring_transactions.*").
+		WithArgs(mockID, mockUserID, "EXPENSE", mockID, "", "", "IDR", 3500000.0, "MONTHLY", 2, "2022-01-31", "", 0,
+			0, stored).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 5, respSuccess.Total)
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
+
+func TestDeleteRecurringTransactions(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	// 200
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+	payload := parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE recurring_transactions.*").WithArgs(sqlmock.AnyArg(), mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.DeleteRecurringTransactions(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+}
+
+func TestMaterializeRecurring(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	now := time.Date(2022, 4, 15, 10, 0, 0, 0, time.UTC)
+	today := time.Date(2022, 4, 15, 0, 0, 0, 0, time.UTC)
+
+	label := []string{
+		"user_id", "type", "product_id", "name", "description", "currency", "amount",
+		"frequency", "interval", "start_date", "end_date", "count", "generated",
+	}
+
+	// err select (500)
+	dbMock.ExpectQuery("SELECT id FROM recurring_transactions.*").WithArgs(today).WillReturnError(errors.New("err-select"))
+
+	_, err = api.MaterializeRecurring(now)
+	assert.Equal(t, "err-select", err.Error())
+
+	// a failing schedule does not stop the others
+	dbMock.ExpectQuery("SELECT id FROM recurring_transactions.*").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID).AddRow(mockID2))
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT.*FOR UPDATE SKIP LOCKED").WithArgs(mockID).WillReturnError(errors.New("err-lock"))
+	dbMock.ExpectRollback()
+	dbMock.ExpectBegin()
+	// locked by another instance
+	dbMock.ExpectQuery("SELECT.*FOR UPDATE SKIP LOCKED").WithArgs(mockID2).WillReturnRows(sqlmock.NewRows(label))
+	dbMock.ExpectRollback()
+
+	total, err := api.MaterializeRecurring(now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, total)
+
+	// monthly on the 31st, clamped to the end of the month
+	dbMock.ExpectQuery("SELECT id FROM recurring_transactions.*").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT.*FOR UPDATE SKIP LOCKED").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockUserID, "EXPENSE", mockID2, nil, nil, "IDR", 3500000,
+				"MONTHLY", 1, time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), nil, nil, 1))
+	dbMock.ExpectExec("INSERT INTO expenses.*ON CONFLICT.*DO NOTHING").
+		WithArgs(mockID2, time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC), mockUserID, "IDR", 3500000.0, mockID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// already materialised by an earlier run
+	dbMock.ExpectExec("INSERT INTO expenses.*ON CONFLICT.*DO NOTHING").
+		WithArgs(mockID2, time.Date(2022, 3, 31, 0, 0, 0, 0, time.UTC), mockUserID, "IDR", 3500000.0, mockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("UPDATE recurring_transactions.*").
+		WithArgs(3, time.Date(2022, 4, 30, 0, 0, 0, 0, time.UTC), mockID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	total, err = api.MaterializeRecurring(now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, total)
+
+	// weekly income ending by count
+	dbMock.ExpectQuery("SELECT id FROM recurring_transactions.*").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT.*FOR UPDATE SKIP LOCKED").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockUserID, "INCOME", nil, "Tutoring", "", "USD", 50,
+				"WEEKLY", 2, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), nil, 2, 0))
+	dbMock.ExpectExec("INSERT INTO incomes.*").
+		WithArgs("Tutoring", "", time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), mockUserID, "USD", 50.0, mockID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("INSERT INTO incomes.*").
+		WithArgs("Tutoring", "", time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC), mockUserID, "USD", 50.0, mockID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("UPDATE recurring_transactions.*").
+		WithArgs(2, nil, mockID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	total, err = api.MaterializeRecurring(now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, total)
+
+	// yearly ending by end date
+	dbMock.ExpectQuery("SELECT id FROM recurring_transactions.*").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockID))
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT.*FOR UPDATE SKIP LOCKED").WithArgs(mockID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockUserID, "EXPENSE", mockID2, nil, nil, "IDR", 600000,
+				"YEARLY", 1, time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), nil, 1))
+	dbMock.ExpectExec("INSERT INTO expenses.*").
+		WithArgs(mockID2, time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC), mockUserID, "IDR", 600000.0, mockID).
+		WillReturnError(errors.New("err-insert"))
+	dbMock.ExpectRollback()
+
+	total, err = api.MaterializeRecurring(now)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, total)
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
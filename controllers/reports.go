@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTagsReport totals the expenses, or the incomes with type=income, per tag.
+// The amounts of rows having several tags count in each of them.
+func (api *API) GetTagsReport(c *gin.Context) {
+	u := ParsePayload(c)
+
+	var sourceQ, table string
+	var filterQ string
+	var stms []interface{}
+
+	switch strings.ToLower(c.DefaultQuery("type", "expense")) {
+	case "expense":
+		filter := models.ExpenseFilter{
+			Expense: models.Expense{
+				UserId:     c.Query("user_id"),
+				CategoryId: c.Query("category_id"),
+				AccountId:  c.Query("account_id"),
+				Currency:   c.Query("currency"),
+			},
+			MinDate: c.Query("min_date"),
+			MaxDate: c.Query("max_date"),
+		}
+
+		filter.Tags, filter.TagsMatch = parseTagsQuery(c)
+
+		if u.Role == string(models.Customer) {
+			filter.UserId = u.Id
+		}
+
+		table = "expenses"
+		filterQ, stms = getFilterExpense(filter)
+		sourceQ = `SELECT e.* FROM expenses e
+			JOIN products p ON e.product_id = p.id AND NOT p.deleted
+			WHERE NOT e.deleted` + filterQ
+	case "income":
+		filter := models.IncomeFilter{
+			Income: models.Income{
+				UserId:    c.Query("user_id"),
+				AccountId: c.Query("account_id"),
+				Currency:  c.Query("currency"),
+			},
+			MinDate: c.Query("min_date"),
+			MaxDate: c.Query("max_date"),
+		}
+
+		filter.Tags, filter.TagsMatch = parseTagsQuery(c)
+
+		if u.Role == string(models.Customer) {
+			filter.UserId = u.Id
+		}
+
+		table = "incomes"
+		filterQ, stms = getFilterIncome(filter)
+		sourceQ = `SELECT * FROM incomes WHERE NOT deleted` + filterQ
+	default:
+		sendError(c, http.StatusBadRequest, "invalid-type(expense|income)")
+		return
+	}
+
+	baseCurrency, err := parseBaseCurrency(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	baseCurrency, err = api.defaultBaseCurrency(u.Id, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	link := tagLinks[table]
+	fromQ := `
+		FROM (` + sourceQ + `) t
+		JOIN ` + link.table + ` xt ON xt.` + link.column + ` = t.id
+		JOIN tags tg ON xt.tag_id = tg.id`
+
+	selectQ := `SELECT t.currency, tg.id, tg.name, SUM(t.amount)` + fromQ + `
+		GROUP BY t.currency, tg.id, tg.name ORDER BY tg.name`
+
+	log.Println(selectQ)
+
+	rows, err := api.Db.Query(selectQ, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	report := models.TagReport{
+		Reports: map[string][]models.CategoryTotalReport{},
+	}
+
+	for rows.Next() {
+		var total sql.NullFloat64
+		var tagReport models.CategoryTotalReport
+		var currency string
+
+		if err := rows.Scan(&currency, &tagReport.Id, &tagReport.Name, &total); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		tagReport.Total = total.Float64
+		report.Reports[currency] = append(report.Reports[currency], tagReport)
+	}
+
+	if baseCurrency != "" {
+		report.Converted, err = api.getConvertedTagsReport(fromQ, stms, baseCurrency)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// getConvertedTagsReport converts the per tag totals, the report total counts
+// every row once whatever the number of its tags
+func (api *API) getConvertedTagsReport(fromQ string, stms []interface{}, baseCurrency string) (*models.ConvertedReport, error) {
+	target := fmt.Sprintf("$%d", len(stms)+1)
+	args := append(append([]interface{}{}, stms...), baseCurrency)
+
+	q := `SELECT tg.id, tg.name, SUM(` + convertedQ("t", "t.amount", target) + `), ` + missingRateQ("t", target) + fromQ +
+		rateJoinQ("t", target) + ` GROUP BY tg.id, tg.name ORDER BY tg.name`
+
+	rows, err := api.Db.Query(q, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	converted := &models.ConvertedReport{BaseCurrency: baseCurrency}
+	for rows.Next() {
+		var total sql.NullFloat64
+		var missing int
+		var tagReport models.CategoryTotalReport
+
+		if err := rows.Scan(&tagReport.Id, &tagReport.Name, &total, &missing); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		tagReport.Total = roundAmount(total.Float64)
+		converted.Reports = append(converted.Reports, tagReport)
+		converted.MissingRates += missing
+	}
+
+	q = `SELECT SUM(` + convertedQ("t", "t.amount", target) + `)
+		FROM (SELECT DISTINCT t.* ` + fromQ + `) t` + rateJoinQ("t", target)
+
+	var total sql.NullFloat64
+	if err := api.Db.QueryRow(q, args...).Scan(&total); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	converted.Total = roundAmount(total.Float64)
+
+	return converted, nil
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetTagsReport(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// invalid type (400)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("GET", "?type=transfer", nil)
+	c.Request = req
+	api.GetTagsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-type(expense|income)", genericResp.Message)
+
+	// invalid base currency (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("GET", "?base_currency=rupiah", nil)
+	c.Request = req
+	api.GetTagsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-base-currency", genericResp.Message)
+
+	// err select base currency (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).WillReturnError(errors.New("err-select-base-currency"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetTagsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-base-currency", genericResp.Message)
+
+	// err select (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT t.currency, tg.id.*FROM expenses e.*JOIN expense_tags.*").WillReturnError(errors.New("err-select"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetTagsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// err scan (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	label := []string{"currency", "id", "name", "total"}
+
+	dbMock.ExpectQuery("SELECT t.currency, tg.id.*").WillReturnRows(sqlmock.NewRows(label[1:]).AddRow(mockID, "food", 1234))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetTagsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 3 destination arguments in Scan, not 4", genericResp.Message)
+
+	// (200)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT t.currency, tg.id.*FROM expenses e.*JOIN expense_tags.*").
+		WithArgs(mockUserID, mockID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow("IDR", mockID, "food", 20000).
+			AddRow("USD", mockID, "food", 15).
+			AddRow("IDR", mockID2, "travel", 5000))
+
+	req, _ = http.NewRequest("GET", "?category_id="+mockID+"&min_date=2020-01-01&max_date=2020-02-02&tags=food,travel&tags_match=all", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetTagsReport(c)
+
+	var report models.TagReport
+
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, len(report.Reports["IDR"]))
+	assert.Equal(t, 1, len(report.Reports["USD"]))
+	assert.Equal(t, "travel", report.Reports["IDR"][1].Name)
+	assert.Equal(t, true, report.Converted == nil)
+
+	// err select converted (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT t.currency, tg.id.*").WillReturnRows(sqlmock.NewRows(label).AddRow("IDR", mockID, "food", 20000))
+	dbMock.ExpectQuery("SELECT tg.id, tg.name.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "USD").WillReturnError(errors.New("err-select-converted"))
+
+	req, _ = http.NewRequest("GET", "?base_currency=usd", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetTagsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-converted", genericResp.Message)
+
+	// err select converted total (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT t.currency, tg.id.*").WillReturnRows(sqlmock.NewRows(label).AddRow("IDR", mockID, "food", 20000))
+	dbMock.ExpectQuery("SELECT tg.id, tg.name.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "sum", "missing"}).AddRow(mockID, "food", 1.5, 0))
+	dbMock.ExpectQuery("SELECT SUM.*SELECT DISTINCT.*").WithArgs(mockUserID, "USD").WillReturnError(errors.New("err-select-total"))
+
+	req, _ = http.NewRequest("GET", "?base_currency=usd", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetTagsReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-total", genericResp.Message)
+
+	// (200) incomes converted
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT t.currency, tg.id.*FROM incomes.*JOIN income_tags.*").
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow("IDR", mockID, "salary", 20000).
+			AddRow("USD", mockID2, "bonus", 35))
+	dbMock.ExpectQuery("SELECT tg.id, tg.name.*LEFT JOIN LATERAL.*").WithArgs(mockUserID, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "sum", "missing"}).
+			AddRow(mockID2, "bonus", 35, 0).
+			AddRow(mockID, "salary", 1.333, 1))
+	dbMock.ExpectQuery("SELECT SUM.*SELECT DISTINCT.*").WithArgs(mockUserID, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(36.333))
+
+	req, _ = http.NewRequest("GET", "?type=income&base_currency=USD", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetTagsReport(c)
+
+	report = models.TagReport{}
+	err = json.NewDecoder(w.Body).Decode(&report)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, len(report.Reports["USD"]))
+	assert.Equal(t, "USD", report.Converted.BaseCurrency)
+	assert.Equal(t, 36.33, report.Converted.Total)
+	assert.Equal(t, 1, report.Converted.MissingRates)
+	assert.Equal(t, 1.33, report.Converted.Reports[1].Total)
+}
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+func (api *API) GetRules(c *gin.Context) {
+	u := ParsePayload(c)
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	order := c.DefaultQuery("order", "ASC")
+	orderBy := c.Query("order_by")
+
+	filter := models.CategorisationRule{
+		UserId:    c.Query("user_id"),
+		ProductId: c.Query("product_id"),
+	}
+
+	if u.Role == string(models.Customer) {
+		filter.UserId = u.Id
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	if strings.ToUpper(order) != "ASC" && strings.ToUpper(order) != "DESC" {
+		order = "ASC"
+	}
+
+	mapOrderBy := map[string]string{
+		"id":         "r.id",
+		"user_id":    "r.user_id",
+		"product_id": "r.product_id",
+		"priority":   "r.priority",
+		"created_at": "r.created_at",
+		"updated_at": "r.updated_at",
+	}
+
+	if val, ok := mapOrderBy[orderBy]; ok {
+		orderBy = val
+	} else {
+		orderBy = "r.priority"
+	}
+
+	countQ := `SELECT COUNT(1) FROM categorisation_rules r
+		WHERE NOT r.deleted`
+	selectQ := `SELECT
+			r.id, r.user_id, r.product_id, p.name, r.priority, r.payee_contains, r.payee_regex,
+			r.min_amount, r.max_amount, COALESCE(r.currency, ''), r.created_at, r.updated_at
+		FROM categorisation_rules r
+		JOIN products p ON r.product_id = p.id
+		WHERE NOT r.deleted`
+
+	var ruleList models.CategorisationRuleList
+	var rules []models.CategorisationRule
+	var err error
+
+	filterQ, stms := getFilterRule(filter)
+
+	selectQ = selectQ + filterQ
+	countQ = countQ + filterQ
+
+	offset := (page - 1) * limit
+	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
+	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+
+	log.Println(selectQ + orderVal + pagination)
+
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.CategorisationRule
+		var minAmount, maxAmount sql.NullFloat64
+
+		err = rows.Scan(&rule.Id, &rule.UserId, &rule.ProductId, &rule.ProductName, &rule.Priority,
+			&rule.PayeeContains, &rule.PayeeRegex, &minAmount, &maxAmount, &rule.Currency,
+			&rule.CreatedAt, &rule.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if minAmount.Valid {
+			rule.MinAmount = &minAmount.Float64
+		}
+
+		if maxAmount.Valid {
+			rule.MaxAmount = &maxAmount.Float64
+		}
+
+		rules = append(rules, rule)
+	}
+
+	ruleList.Total, err = api.GetTotal(countQ, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ruleList.Rules = rules
+	ruleList.Limit = limit
+	ruleList.Page = page
+
+	c.JSON(http.StatusOK, ruleList)
+}
+
+func (api *API) UpsertRules(c *gin.Context) {
+	u := ParsePayload(c)
+	var payload models.UpsertCategorisationRuleRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rules := payload.Data
+	if len(rules) == 0 {
+		sendError(c, http.StatusBadRequest, "missing-rules")
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var errRules []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	customer := false
+	if u.Role == string(models.Customer) {
+		customer = true
+	}
+
+	for i, rule := range rules {
+		if customer {
+			rule.UserId = u.Id
+		}
+
+		if _, err := uuid.FromString(rule.Id); err != nil {
+			rule.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateRule(&rule, currencies); err != nil {
+			errRules = append(errRules, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = $1 AND user_id = $2 AND NOT deleted)",
+			rule.ProductId, rule.UserId).Scan(&exists); err != nil {
+			log.Println(err)
+			errRules = append(errRules, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if !exists {
+			errRules = append(errRules, models.RowError{Row: i + 1, Message: "product-not-found"})
+			continue
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO categorisation_rules
+		(id, user_id, product_id, priority, payee_contains, payee_regex, min_amount, max_amount, currency, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+		user_id = $2, product_id = $3, priority = $4, payee_contains = $5, payee_regex = $6, min_amount = $7, max_amount = $8,
+		currency = NULLIF($9, ''), updated_at = CURRENT_TIMESTAMP, deleted = false
+		`, rule.Id, rule.UserId, rule.ProductId, rule.Priority, rule.PayeeContains, rule.PayeeRegex,
+			rule.MinAmount, rule.MaxAmount, rule.Currency); err != nil {
+			log.Println(err)
+			errRules = append(errRules, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+	}
+
+	code := http.StatusInternalServerError
+	obj := gin.H{"message": "error", "details": errRules}
+
+	if len(errRules) == 0 {
+		if err := tx.Commit(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		code = http.StatusOK
+		obj = gin.H{"message": "success", "total": len(rules)}
+	}
+
+	c.JSON(code, obj)
+}
+
+func (api *API) DeleteRules(c *gin.Context) {
+	api.BatchDeletes(c, "categorisation_rules")
+}
+
+func validateRule(rule *models.CategorisationRule, currencies map[string]models.Currency) error {
+	if rule.ProductId == "" {
+		return errors.New("missing-product-id")
+	}
+
+	if _, err := uuid.FromString(rule.ProductId); err != nil {
+		return errors.New("invalid-product-id")
+	}
+
+	if _, err := uuid.FromString(rule.UserId); err != nil {
+		return errors.New("invalid-user-id")
+	}
+
+	if rule.PayeeContains == "" && rule.PayeeRegex == "" && rule.MinAmount == nil && rule.MaxAmount == nil && rule.Currency == "" {
+		return errors.New("missing-condition")
+	}
+
+	if _, err := regexp.Compile(rule.PayeeRegex); err != nil {
+		return errors.New("invalid-payee-regex")
+	}
+
+	if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+		return errors.New("invalid-amount-range")
+	}
+
+	rule.Currency = strings.ToUpper(rule.Currency)
+	if _, ok := currencies[rule.Currency]; rule.Currency != "" && !ok {
+		return errors.New("unsupported-currency")
+	}
+
+	return nil
+}
+
+func getFilterRule(filter models.CategorisationRule) (filterQ string, stms []interface{}) {
+	if _, err := uuid.FromString(filter.UserId); err == nil {
+		filterQ = fmt.Sprintf(" AND r.user_id = $%d", len(stms)+1)
+		stms = append(stms, filter.UserId)
+	}
+
+	if _, err := uuid.FromString(filter.ProductId); err == nil {
+		filterQ += fmt.Sprintf(" AND r.product_id = $%d", len(stms)+1)
+		stms = append(stms, filter.ProductId)
+	}
+
+	return
+}
+
+// categoriser gives the expenses saved without product the product of the
+// first matching rule of their user, the rules are loaded once per user
+type categoriser struct {
+	rules map[string][]categorisationRule
+}
+
+type categorisationRule struct {
+	models.CategorisationRule
+	payee *regexp.Regexp
+}
+
+func newCategoriser() *categoriser {
+	return &categoriser{rules: map[string][]categorisationRule{}}
+}
+
+// categorise sets the product and the rule of the expense when it has no
+// product nor split lines and a rule matches
+func (r *categoriser) categorise(tx *sql.Tx, expense *models.Expense) error {
+	expense.RuleId = ""
+	if expense.ProductId != "" || len(expense.Splits) > 0 {
+		return nil
+	}
+
+	if _, err := uuid.FromString(expense.UserId); err != nil {
+		return nil
+	}
+
+	rules, ok := r.rules[expense.UserId]
+	if !ok {
+		var err error
+		if rules, err = loadRules(tx, expense.UserId); err != nil {
+			return err
+		}
+
+		r.rules[expense.UserId] = rules
+	}
+
+	for _, rule := range rules {
+		if rule.matches(*expense) {
+			expense.ProductId = rule.ProductId
+			expense.RuleId = rule.Id
+			break
+		}
+	}
+
+	return nil
+}
+
+func (rule categorisationRule) matches(expense models.Expense) bool {
+	if rule.PayeeContains != "" && !strings.Contains(strings.ToLower(expense.Payee), strings.ToLower(rule.PayeeContains)) {
+		return false
+	}
+
+	if rule.payee != nil && !rule.payee.MatchString(expense.Payee) {
+		return false
+	}
+
+	if rule.MinAmount != nil && expense.Amount < *rule.MinAmount {
+		return false
+	}
+
+	if rule.MaxAmount != nil && expense.Amount > *rule.MaxAmount {
+		return false
+	}
+
+	return rule.Currency == "" || strings.EqualFold(rule.Currency, expense.Currency)
+}
+
+// loadRules reads the rules of the user by priority, leaving out the ones of
+// deleted products
+func loadRules(tx *sql.Tx, userId string) ([]categorisationRule, error) {
+	rows, err := tx.Query(`SELECT r.id, r.product_id, r.payee_contains, r.payee_regex,
+			r.min_amount, r.max_amount, COALESCE(r.currency, '')
+		FROM categorisation_rules r
+		JOIN products p ON r.product_id = p.id AND NOT p.deleted
+		WHERE NOT r.deleted AND r.user_id = $1
+		ORDER BY r.priority, r.created_at`, userId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var rules []categorisationRule
+	for rows.Next() {
+		var rule categorisationRule
+		var minAmount, maxAmount sql.NullFloat64
+
+		if err := rows.Scan(&rule.Id, &rule.ProductId, &rule.PayeeContains, &rule.PayeeRegex,
+			&minAmount, &maxAmount, &rule.Currency); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		if minAmount.Valid {
+			rule.MinAmount = &minAmount.Float64
+		}
+
+		if maxAmount.Valid {
+			rule.MaxAmount = &maxAmount.Float64
+		}
+
+		if rule.PayeeRegex != "" {
+			if rule.payee, err = regexp.Compile(rule.PayeeRegex); err != nil {
+				log.Println(err)
+				continue
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
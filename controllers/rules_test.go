@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetRules(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// err select (500)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM categorisation_rules.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// scan error (500)
+	label := []string{
+		"id", "user_id", "product_id", "product_name", "priority", "payee_contains", "payee_regex",
+		"min_amount", "max_amount", "currency", "created_at", "updated_at",
+	}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM categorisation_rules.*ORDER BY r.updated_at desc.*").
+		WillReturnRows(sqlmock.NewRows(label[10:]).AddRow(time.Now(), time.Now()))
+
+	req, _ = http.NewRequest("GET", "?order_by=updated_at&order=desc", nil)
+	c.Request = req
+	api.GetRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 2 destination arguments in Scan, not 12", genericResp.Message)
+
+	// err count (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM categorisation_rules.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, "Transport", 1, "grab", "", nil, nil, "", time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-count", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM categorisation_rules.*ORDER BY r.priority ASC.*").WithArgs(mockUserID, mockID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, "Transport", 1, "grab", "", 10, nil, "USD", time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	req, _ = http.NewRequest("GET", "?product_id="+mockID, nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetRules(c)
+
+	var resp models.CategorisationRuleList
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, int(resp.Total))
+	assert.Equal(t, "Transport", resp.Rules[0].ProductName)
+	assert.Equal(t, 10.0, *resp.Rules[0].MinAmount)
+	assert.Equal(t, true, resp.Rules[0].MaxAmount == nil)
+}
+
+func TestUpsertRules(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+
+	// nil request (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	api.UpsertRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// bad request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.UpsertCategorisationRuleRequest{})
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-rules", genericResp.Message)
+
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertCategorisationRuleRequest{Data: []models.CategorisationRule{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-currencies"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-currencies", genericResp.Message)
+
+	// rules validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	min, max := 10.0, 5.0
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	rules := models.UpsertCategorisationRuleRequest{Data: []models.CategorisationRule{
+		{},
+		{ProductId: "err"},
+		{ProductId: mockID, UserId: "err"},
+		{ProductId: mockID, UserId: mockUserID},
+		{ProductId: mockID, UserId: mockUserID, PayeeRegex: "(grab"},
+		{ProductId: mockID, UserId: mockUserID, MinAmount: &min, MaxAmount: &max},
+		{ProductId: mockID, UserId: mockUserID, Currency: "EUR"},
+		{ProductId: mockID, UserId: mockUserID, PayeeContains: "grab"},
+		{ProductId: mockID, UserId: mockUserID, PayeeContains: "grab"},
+		{Id: mockID, ProductId: mockID, UserId: mockUserID, PayeeContains: "grab", Currency: "usd", Priority: 2},
+	}}
+	payload = parsePayload(rules)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM products.*").WithArgs(mockID, mockUserID).WillReturnError(fmt.Errorf("err-product"))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM products.*").WithArgs(mockID, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM products.*").WithArgs(mockID, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO categorisation_rules.*").
+		WithArgs(mockID, mockUserID, mockID, 2, "grab", "", nil, nil, "USD").
+		WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	api.UpsertRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 10, len(respErrors.Details))
+	assert.Equal(t, "missing-product-id", respErrors.Details[0].Message)
+	assert.Equal(t, "invalid-product-id", respErrors.Details[1].Message)
+	assert.Equal(t, "invalid-user-id", respErrors.Details[2].Message)
+	assert.Equal(t, "missing-condition", respErrors.Details[3].Message)
+	assert.Equal(t, "invalid-payee-regex", respErrors.Details[4].Message)
+	assert.Equal(t, "invalid-amount-range", respErrors.Details[5].Message)
+	assert.Equal(t, "unsupported-currency", respErrors.Details[6].Message)
+	assert.Equal(t, "err-product", respErrors.Details[7].Message)
+	assert.Equal(t, "product-not-found", respErrors.Details[8].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[9].Message)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	rules = models.UpsertCategorisationRuleRequest{Data: []models.CategorisationRule{
+		{ProductId: mockID, PayeeRegex: "(?i)^grab", MinAmount: &max, MaxAmount: &min},
+	}}
+	payload = parsePayload(rules)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM products.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO categorisation_rules.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM products.*").WithArgs(mockID, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO categorisation_rules.*").
+		WithArgs(sqlmock.AnyArg(), mockUserID, mockID, 0, "", "(?i)^grab", max, min, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload = parsePayload(rules)
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
+
+func TestDeleteRules(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	var genericResp GenericResponse
+
+	// not found (404)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	payload := parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE categorisation_rules.*").WithArgs(sqlmock.AnyArg(), mockUserID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectRollback()
+
+	req, _ := http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.DeleteRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "expected-1-deleted-but-got-0", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE categorisation_rules.*").WithArgs(sqlmock.AnyArg(), mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.DeleteRules(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+}
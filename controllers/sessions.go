@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"budgetingapi/tokens"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofrs/uuid"
+)
+
+// the access tokens are short-lived, the refresh token gets new ones until it
+// expires in turn. A session lives as long as its refresh token.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = tokens.RefreshTTL
+	sessionTTL      = refreshTokenTTL
+)
+
+var errSessionNotFound = errors.New("session-not-found")
+
+// sessionKey is the hash of a session, the auth middleware bumps its
+// last_seen on each request
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+// userSessionsKey is the set of the session ids of a user
+func userSessionsKey(userId string) string {
+	return "sessions:" + userId
+}
+
+func newSession(c *gin.Context) models.Session {
+	id, _ := uuid.NewV4()
+	now := time.Now().UTC()
+
+	return models.Session{
+		Id:        id.String(),
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+}
+
+func (api *API) getSession(id string) (session models.Session, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fields, err := api.Redis.HGetAll(ctx, sessionKey(id)).Result()
+	if err != nil {
+		return
+	}
+
+	if len(fields) == 0 {
+		return session, errSessionNotFound
+	}
+
+	session = models.Session{
+		Id:           id,
+		UserAgent:    fields["user_agent"],
+		IP:           fields["ip"],
+		Token:        fields["token"],
+		RefreshToken: fields["refresh_token"],
+	}
+
+	session.CreatedAt, _ = time.Parse(time.RFC3339, fields["created_at"])
+	session.LastSeen, _ = time.Parse(time.RFC3339, fields["last_seen"])
+
+	return session, nil
+}
+
+// saveSession stores the session with its new tokens and lists it under the
+// user, both live as long as the refresh token
+func (api *API) saveSession(ctx context.Context, userId string, session models.Session) error {
+	key := sessionKey(session.Id)
+
+	err := api.Redis.HSet(ctx, key, map[string]interface{}{
+		"token":         session.Token,
+		"refresh_token": session.RefreshToken,
+		"user_agent":    session.UserAgent,
+		"ip":            session.IP,
+		"created_at":    session.CreatedAt.Format(time.RFC3339),
+		"last_seen":     session.LastSeen.Format(time.RFC3339),
+	}).Err()
+	if err != nil {
+		return err
+	}
+
+	if err = api.Redis.Expire(ctx, key, sessionTTL).Err(); err != nil {
+		return err
+	}
+
+	if err = api.Redis.SAdd(ctx, userSessionsKey(userId), session.Id).Err(); err != nil {
+		return err
+	}
+
+	return api.Redis.Expire(ctx, userSessionsKey(userId), sessionTTL).Err()
+}
+
+// revokeSession drops the tokens of the session along with it. The stateless
+// access tokens cannot be dropped, the session is denied until they expired.
+func (api *API) revokeSession(userId, id string) error {
+	session, err := api.getSession(id)
+	if err != nil && err != errSessionNotFound {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys := append([]string{sessionKey(id)}, tokenKeys(session.Token, session.RefreshToken)...)
+	if err := api.Redis.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	if tokens.Stateless() {
+		if err := api.Redis.Set(ctx, tokens.DenylistKey(id), userId, accessTokenTTL).Err(); err != nil {
+			return err
+		}
+	}
+
+	return api.Redis.SRem(ctx, userSessionsKey(userId), id).Err()
+}
+
+// userSessions lists the live sessions of the user, the expired ones are
+// removed from the set on the way
+func (api *API) userSessions(userId string) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ids, err := api.Redis.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ids)
+
+	sessions := []models.Session{}
+	for _, id := range ids {
+		session, err := api.getSession(id)
+		if err == errSessionNotFound {
+			if err := api.Redis.SRem(ctx, userSessionsKey(userId), id).Err(); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// GetSessions lists the sessions of the user, the most recently seen first
+func (api *API) GetSessions(c *gin.Context) {
+	u := ParsePayload(c)
+
+	sessions, err := api.userSessions(u.Id)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == u.SessionId
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastSeen.After(sessions[j].LastSeen) })
+
+	c.JSON(http.StatusOK, models.SessionList{Sessions: sessions})
+}
+
+// DeleteSession logs one of the user's devices out
+func (api *API) DeleteSession(c *gin.Context) {
+	u := ParsePayload(c)
+	id := c.Param("id")
+
+	if _, err := uuid.FromString(id); err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the set makes sure the session is one of the user's
+	member, err := api.Redis.SIsMember(ctx, userSessionsKey(u.Id), id).Result()
+	if err != nil && err != redis.Nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !member {
+		sendError(c, http.StatusNotFound, errSessionNotFound.Error())
+		return
+	}
+
+	if err := api.revokeSession(u.Id, id); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, genericOK)
+}
+
+// DeleteSessions logs the user out everywhere, the current session included
+func (api *API) DeleteSessions(c *gin.Context) {
+	u := ParsePayload(c)
+
+	sessions, err := api.userSessions(u.Id)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, session := range sessions {
+		if err := api.revokeSession(u.Id, session.Id); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, genericOK)
+}
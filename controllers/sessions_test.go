@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redismock/v8"
+	"gotest.tools/assert"
+)
+
+func TestGetSessions(t *testing.T) {
+	api := NewAPI()
+
+	redisDB, redisMock := redismock.NewClientMock()
+	api.Redis = redisDB
+
+	var genericResp GenericResponse
+
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	laptop := "63eb226a-d612-412b-b8d4-a3e17b7d2201"
+	phone := "63eb226a-d612-412b-b8d4-a3e17b7d2202"
+	expired := "63eb226a-d612-412b-b8d4-a3e17b7d2203"
+	payload := "{\"session-id\":\"" + laptop + "\",\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	// err redis (500)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	redisMock.ExpectSMembers("sessions:" + mockUserID).SetErr(errors.New("err-redis"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetSessions(c)
+
+	err := json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-redis", genericResp.Message)
+
+	// 200, the expired session is dropped from the set
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectSMembers("sessions:" + mockUserID).SetVal([]string{phone, expired, laptop})
+	redisMock.ExpectHGetAll("session:" + laptop).SetVal(map[string]string{"token": "laptop-token",
+		"user_agent": "Mozilla/5.0", "ip": "10.0.0.1", "created_at": "2021-01-01T00:00:00Z", "last_seen": "2021-01-01T00:10:00Z"})
+	redisMock.ExpectHGetAll("session:" + phone).SetVal(map[string]string{"token": "phone-token",
+		"user_agent": "budgeting-mobile/2.1", "ip": "10.0.0.2", "created_at": "2021-01-01T00:05:00Z", "last_seen": "2021-01-01T00:20:00Z"})
+	redisMock.ExpectHGetAll("session:" + expired).SetVal(map[string]string{})
+	redisMock.ExpectSRem("sessions:"+mockUserID, expired).SetVal(1)
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetSessions(c)
+
+	var list models.SessionList
+	err = json.NewDecoder(w.Body).Decode(&list)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, len(list.Sessions))
+	assert.Equal(t, phone, list.Sessions[0].Id)
+	assert.Equal(t, "budgeting-mobile/2.1", list.Sessions[0].UserAgent)
+	assert.Equal(t, false, list.Sessions[0].Current)
+	assert.Equal(t, laptop, list.Sessions[1].Id)
+	assert.Equal(t, "10.0.0.1", list.Sessions[1].IP)
+	assert.Equal(t, true, list.Sessions[1].Current)
+	assert.Equal(t, "", list.Sessions[1].Token)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+}
+
+func TestDeleteSession(t *testing.T) {
+	api := NewAPI()
+
+	redisDB, redisMock := redismock.NewClientMock()
+	api.Redis = redisDB
+
+	var genericResp GenericResponse
+
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	phone := "63eb226a-d612-412b-b8d4-a3e17b7d2202"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	// invalid id (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("DELETE", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	c.Params = gin.Params{{Key: "id", Value: "phone"}}
+	api.DeleteSession(c)
+
+	err := json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-id", genericResp.Message)
+
+	// another user's session (404)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectSIsMember("sessions:"+mockUserID, phone).SetVal(false)
+
+	req, _ = http.NewRequest("DELETE", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	c.Params = gin.Params{{Key: "id", Value: phone}}
+	api.DeleteSession(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "session-not-found", genericResp.Message)
+
+	// err del (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectSIsMember("sessions:"+mockUserID, phone).SetVal(true)
+	redisMock.ExpectHGetAll("session:" + phone).SetVal(map[string]string{"token": "phone-token", "refresh_token": "phone-refresh"})
+	redisMock.ExpectDel("session:"+phone, "access:phone-token", "refresh:phone-refresh").SetErr(errors.New("err-del"))
+
+	req, _ = http.NewRequest("DELETE", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	c.Params = gin.Params{{Key: "id", Value: phone}}
+	api.DeleteSession(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-del", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectSIsMember("sessions:"+mockUserID, phone).SetVal(true)
+	redisMock.ExpectHGetAll("session:" + phone).SetVal(map[string]string{"token": "phone-token", "refresh_token": "phone-refresh"})
+	redisMock.ExpectDel("session:"+phone, "access:phone-token", "refresh:phone-refresh").SetVal(3)
+	redisMock.ExpectSRem("sessions:"+mockUserID, phone).SetVal(1)
+
+	req, _ = http.NewRequest("DELETE", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	c.Params = gin.Params{{Key: "id", Value: phone}}
+	api.DeleteSession(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+
+	// stateless, the session is denied until its access token expired (200)
+	os.Setenv("AUTH_MODE", "stateless")
+	defer os.Unsetenv("AUTH_MODE")
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectSIsMember("sessions:"+mockUserID, phone).SetVal(true)
+	redisMock.ExpectHGetAll("session:" + phone).SetVal(map[string]string{"token": "phone-token", "refresh_token": "phone-refresh"})
+	redisMock.ExpectDel("session:"+phone, "access:phone-token", "refresh:phone-refresh").SetVal(2)
+	redisMock.ExpectSet("denylist:"+phone, mockUserID, accessTokenTTL).SetVal("OK")
+	redisMock.ExpectSRem("sessions:"+mockUserID, phone).SetVal(1)
+
+	req, _ = http.NewRequest("DELETE", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	c.Params = gin.Params{{Key: "id", Value: phone}}
+	api.DeleteSession(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+}
+
+func TestDeleteSessions(t *testing.T) {
+	api := NewAPI()
+
+	redisDB, redisMock := redismock.NewClientMock()
+	api.Redis = redisDB
+
+	var genericResp GenericResponse
+
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	laptop := "63eb226a-d612-412b-b8d4-a3e17b7d2201"
+	phone := "63eb226a-d612-412b-b8d4-a3e17b7d2202"
+	payload := "{\"session-id\":\"" + laptop + "\",\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	// 200, the current session goes too
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	redisMock.ExpectSMembers("sessions:" + mockUserID).SetVal([]string{phone, laptop})
+	redisMock.ExpectHGetAll("session:" + laptop).SetVal(map[string]string{"token": "laptop-token", "refresh_token": "laptop-refresh"})
+	redisMock.ExpectHGetAll("session:" + phone).SetVal(map[string]string{"token": "phone-token", "refresh_token": "phone-refresh"})
+	for _, session := range []string{laptop, phone} {
+		redisMock.ExpectHGetAll("session:" + session).SetVal(map[string]string{"token": session + "-token", "refresh_token": session + "-refresh"})
+		redisMock.ExpectDel("session:"+session, "access:"+session+"-token", "refresh:"+session+"-refresh").SetVal(3)
+		redisMock.ExpectSRem("sessions:"+mockUserID, session).SetVal(1)
+	}
+
+	req, _ := http.NewRequest("DELETE", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.DeleteSessions(c)
+
+	err := json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+}
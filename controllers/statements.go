@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+// the qif account types holding transactions
+var qifTypes = map[string]bool{"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true}
+
+// ImportStatement imports the transactions of an ofx or qif bank statement in
+// the account, the debits as expenses of the product of the matching rule or
+// else of product_id, and the credits as incomes. The transactions already
+// imported in the account, deleted or not, are skipped, so overlapping
+// statements can be imported. The zero amount ones are skipped too.
+func (api *API) ImportStatement(c *gin.Context) {
+	u := ParsePayload(c)
+	accountId := c.Param("id")
+	if _, err := uuid.FromString(accountId); err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-account-id")
+		return
+	}
+
+	transactions, err := readStatement(c)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	q := "SELECT user_id, currency FROM accounts WHERE id = $1 AND NOT deleted"
+	stms := []interface{}{accountId}
+	if u.Role == string(models.Customer) {
+		q += " AND user_id = $2"
+		stms = append(stms, u.Id)
+	}
+
+	var userId, currency string
+	err = api.Db.QueryRow(q, stms...).Scan(&userId, &currency)
+	if err == sql.ErrNoRows {
+		sendError(c, http.StatusNotFound, "account-not-found")
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	productId := c.PostForm("product_id")
+	rules := newCategoriser()
+	api.importRows(c, len(transactions), func(tx *sql.Tx, i int) (interface{}, error) {
+		transaction := transactions[i]
+		// neither a debit nor a credit, e.g. a waived fee
+		if transaction.Amount == 0 {
+			return nil, nil
+		}
+
+		table := "incomes"
+		if transaction.Amount < 0 {
+			table = "expenses"
+		}
+
+		imported, err := externalRefExists(tx, table, accountId, transaction.ExternalRef)
+		if err != nil || imported {
+			return nil, err
+		}
+
+		var row interface{}
+		id := uuid.Must(uuid.NewV4()).String()
+		if table == "expenses" {
+			expense := models.Expense{
+				Id:        id,
+				UserId:    userId,
+				AccountId: accountId,
+				Date:      transaction.Date,
+				Currency:  currency,
+				Amount:    -transaction.Amount,
+				Payee:     firstNonEmpty(transaction.Payee, transaction.Memo),
+			}
+
+			// product_id is for the debits no rule matches
+			if err := rules.categorise(tx, &expense); err != nil {
+				return nil, err
+			}
+
+			if expense.ProductId == "" {
+				expense.ProductId = productId
+			}
+
+			if err := validateExpense(&expense, currencies); err != nil {
+				return nil, err
+			}
+
+			if err := upsertExpense(tx, expense); err != nil {
+				return nil, err
+			}
+
+			row = expense
+		} else {
+			income := models.Income{
+				Id:          id,
+				UserId:      userId,
+				AccountId:   accountId,
+				Name:        firstNonEmpty(transaction.Payee, transaction.Memo),
+				Description: firstNonEmpty(transaction.Memo, transaction.Payee),
+				Date:        transaction.Date,
+				Currency:    currency,
+				Amount:      transaction.Amount,
+			}
+
+			if err := validateIncome(&income, currencies); err != nil {
+				return nil, err
+			}
+
+			if err := upsertIncome(tx, income); err != nil {
+				return nil, err
+			}
+
+			row = income
+		}
+
+		return row, setExternalRef(tx, table, id, transaction.ExternalRef)
+	})
+}
+
+// readStatement parses the statement file of a multipart request, its format
+// is the format field or else the file extension
+func readStatement(c *gin.Context) ([]models.StatementTransaction, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New("missing-file")
+	}
+
+	format := strings.ToLower(c.DefaultPostForm("format", strings.TrimPrefix(filepath.Ext(header.Filename), ".")))
+	dateOrder := c.DefaultPostForm("date_format", "mm/dd")
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []models.StatementTransaction
+	switch format {
+	case "ofx", "qfx":
+		transactions, err = parseOFX(string(data))
+	case "qif":
+		if dateOrder != "mm/dd" && dateOrder != "dd/mm" {
+			return nil, errors.New("invalid-date-format(mm/dd|dd/mm)")
+		}
+
+		transactions, err = parseQIF(string(data), dateOrder)
+	default:
+		return nil, errors.New("invalid-format(ofx|qif)")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transactions) == 0 {
+		return nil, errors.New("empty-file")
+	}
+
+	setHashRefs(transactions)
+
+	return transactions, nil
+}
+
+// parseOFX reads the STMTTRN aggregates of an ofx file, sgml or xml
+func parseOFX(data string) ([]models.StatementTransaction, error) {
+	if !strings.Contains(data, "<OFX>") {
+		return nil, errors.New("invalid-ofx")
+	}
+
+	var transactions []models.StatementTransaction
+	for _, block := range strings.Split(data, "<STMTTRN>")[1:] {
+		if i := strings.Index(block, "</STMTTRN>"); i >= 0 {
+			block = block[:i]
+		}
+
+		posted := ofxValue(block, "DTPOSTED")
+		if len(posted) < 8 {
+			return nil, errors.New("invalid-ofx")
+		}
+
+		date, err := time.Parse("20060102", posted[:8])
+		if err != nil {
+			return nil, errors.New("invalid-ofx")
+		}
+
+		amount, err := strconv.ParseFloat(strings.Replace(ofxValue(block, "TRNAMT"), ",", ".", 1), 64)
+		if err != nil {
+			return nil, errors.New("invalid-ofx")
+		}
+
+		transactions = append(transactions, models.StatementTransaction{
+			ExternalRef: ofxValue(block, "FITID"),
+			Date:        date.Format(dateFormat),
+			Amount:      amount,
+			Payee:       ofxValue(block, "NAME"),
+			Memo:        ofxValue(block, "MEMO"),
+		})
+	}
+
+	return transactions, nil
+}
+
+// ofxValue is the value of the tag element of block. The sgml elements have
+// no end tag, the value runs to the next tag or the end of the line.
+func ofxValue(block, tag string) string {
+	i := strings.Index(block, "<"+tag+">")
+	if i < 0 {
+		return ""
+	}
+
+	value := block[i+len(tag)+2:]
+	if j := strings.IndexAny(value, "<\r\n"); j >= 0 {
+		value = value[:j]
+	}
+
+	return strings.TrimSpace(html.UnescapeString(value))
+}
+
+// parseQIF reads the transactions of the bank like sections of a qif file,
+// dateOrder tells whether the dates start with the month or the day
+func parseQIF(data, dateOrder string) ([]models.StatementTransaction, error) {
+	layouts := []string{"1/2/2006", "1/2/06"}
+	if dateOrder == "dd/mm" {
+		layouts = []string{"2/1/2006", "2/1/06"}
+	}
+
+	dateReplacer := strings.NewReplacer("'", "/", "-", "/", ".", "/", " ", "")
+
+	var transactions []models.StatementTransaction
+	var transaction models.StatementTransaction
+	inTransactions := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if line[0] == '!' {
+			inTransactions = strings.HasPrefix(strings.ToLower(line), "!type:") &&
+				qifTypes[strings.ToLower(strings.TrimSpace(line[6:]))]
+			continue
+		}
+
+		if !inTransactions {
+			continue
+		}
+
+		value := strings.TrimSpace(line[1:])
+		switch line[0] {
+		case 'D':
+			transaction.Date = ""
+			for _, layout := range layouts {
+				if date, err := time.Parse(layout, dateReplacer.Replace(value)); err == nil {
+					transaction.Date = date.Format(dateFormat)
+					break
+				}
+			}
+
+			if transaction.Date == "" {
+				return nil, errors.New("invalid-qif")
+			}
+		case 'T', 'U':
+			amount, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+			if err != nil {
+				return nil, errors.New("invalid-qif")
+			}
+
+			transaction.Amount = amount
+		case 'P':
+			transaction.Payee = value
+		case 'M':
+			transaction.Memo = value
+		case '^':
+			if transaction.Date == "" {
+				return nil, errors.New("invalid-qif")
+			}
+
+			transactions = append(transactions, transaction)
+			transaction = models.StatementTransaction{}
+		}
+	}
+
+	return transactions, nil
+}
+
+// setHashRefs gives the transactions without a bank id a hash of their date,
+// amount and payee. Alike transactions of a statement are told apart by their
+// order, which an overlapping statement of whole days keeps.
+func setHashRefs(transactions []models.StatementTransaction) {
+	seen := map[string]int{}
+	for i, transaction := range transactions {
+		if transaction.ExternalRef != "" {
+			continue
+		}
+
+		key := transaction.Date + "|" + strconv.FormatFloat(transaction.Amount, 'f', -1, 64) + "|" +
+			strings.ToLower(transaction.Payee)
+		seen[key]++
+
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", key, seen[key])))
+		transactions[i].ExternalRef = hex.EncodeToString(sum[:])
+	}
+}
+
+// externalRefExists tells whether a row of table in the account was imported
+// from the bank transaction ref
+func externalRefExists(tx *sql.Tx, table, accountId, ref string) (exists bool, err error) {
+	err = tx.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE account_id = $1 AND external_ref = $2)", table),
+		accountId, ref).Scan(&exists)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+func setExternalRef(tx *sql.Tx, table, id, ref string) error {
+	if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET external_ref = $2 WHERE id = $1", table), id, ref); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
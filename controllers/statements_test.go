@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+const ofxStatement = `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>IDR
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20211230120000[+7:WIB]
+<TRNAMT>-50000.00
+<FITID>202112300001
+<NAME>COFFEE &amp; CO
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20211231
+<TRNAMT>1000000.00
+<FITID>202112310001
+<NAME>ACME PAYROLL
+<MEMO>Salary December
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`
+
+func TestImportStatement(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// invalid account id (400)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	ruleLabel := []string{"id", "product_id", "payee_contains", "payee_regex", "min_amount", "max_amount", "currency"}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	payload, contentType := filePayload(ofxStatement, map[string]string{"format": "ofx"})
+	req, _ := http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	api.ImportStatement(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-account-id", genericResp.Message)
+
+	// invalid files (400)
+	invalids := []struct {
+		file    string
+		fields  map[string]string
+		message string
+	}{
+		{"", map[string]string{"format": "ofx"}, "missing-file"},
+		{ofxStatement, nil, "invalid-format(ofx|qif)"},
+		{"!Type:Bank", map[string]string{"format": "qif", "date_format": "yyyy-mm-dd"}, "invalid-date-format(mm/dd|dd/mm)"},
+		{"date,amount", map[string]string{"format": "ofx"}, "invalid-ofx"},
+		{"<OFX><STMTTRN><DTPOSTED>2021<TRNAMT>1</STMTTRN></OFX>", map[string]string{"format": "ofx"}, "invalid-ofx"},
+		{"<OFX></OFX>", map[string]string{"format": "ofx"}, "empty-file"},
+		{"!Type:Bank\nD31/12/2021\nT10\n^", map[string]string{"format": "qif"}, "invalid-qif"},
+		{"!Type:Bank\nD12/31/2021\nTten\n^", map[string]string{"format": "qif"}, "invalid-qif"},
+	}
+
+	for _, invalid := range invalids {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+
+		payload, contentType = filePayload(invalid.file, invalid.fields)
+		req, _ = http.NewRequest("POST", "", payload)
+		req.Header.Set("Content-Type", contentType)
+		c.Request = req
+		c.Params = gin.Params{{Key: "id", Value: mockID}}
+		api.ImportStatement(c)
+
+		err = json.NewDecoder(w.Body).Decode(&genericResp)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, invalid.message, genericResp.Message)
+	}
+
+	// account not found (404)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT user_id, currency FROM accounts.*").WithArgs(mockID, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "currency"}))
+
+	payload, contentType = filePayload(ofxStatement, map[string]string{"format": "ofx"})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	c.Params = gin.Params{{Key: "id", Value: mockID}}
+	api.ImportStatement(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "account-not-found", genericResp.Message)
+
+	// err select account (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT user_id, currency FROM accounts.*").WithArgs(mockID).WillReturnError(fmt.Errorf("err-select-account"))
+
+	payload, contentType = filePayload(ofxStatement, map[string]string{"format": "ofx"})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	c.Params = gin.Params{{Key: "id", Value: mockID}}
+	api.ImportStatement(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select-account", genericResp.Message)
+
+	// errors rows (500)
+	respErrors := struct {
+		Message string `json:"message"`
+		Details []struct {
+			Row     int    `json:"row"`
+			Message string `json:"message"`
+		} `json:"details"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT user_id, currency FROM accounts.*").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "currency"}).AddRow(mockUserID, "IDR"))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM expenses.*").WithArgs(mockID, "202112300001").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT r.id, r.product_id.*FROM categorisation_rules.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows(ruleLabel))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM incomes.*").WithArgs(mockID, "202112310001").
+		WillReturnError(fmt.Errorf("err-select-ref"))
+	dbMock.ExpectRollback()
+
+	payload, contentType = filePayload(ofxStatement, map[string]string{"format": "ofx"})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	c.Params = gin.Params{{Key: "id", Value: mockID}}
+	api.ImportStatement(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, 2, len(respErrors.Details))
+	assert.Equal(t, "missing-product-id", respErrors.Details[0].Message)
+	assert.Equal(t, "err-select-ref", respErrors.Details[1].Message)
+
+	// ofx (200)
+	respSuccess := struct {
+		Message string             `json:"message"`
+		Total   int                `json:"total"`
+		Skipped int                `json:"skipped"`
+		Matches []models.RuleMatch `json:"matches"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT user_id, currency FROM accounts.*").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "currency"}).AddRow(mockUserID, "IDR"))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	// the debit was imported with a previous statement
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM expenses.*").WithArgs(mockID, "202112300001").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM incomes.*").WithArgs(mockID, "202112310001").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID, mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("INSERT INTO incomes.*").
+		WithArgs(sqlmock.AnyArg(), "ACME PAYROLL", "Salary December", "2021-12-31", mockUserID, "IDR", 1000000.0, mockID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("UPDATE incomes SET external_ref.*").WithArgs(sqlmock.AnyArg(), "202112310001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload, contentType = filePayload(ofxStatement, map[string]string{"format": "ofx", "product_id": mockID})
+	req, _ = http.NewRequest("POST", "", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	c.Params = gin.Params{{Key: "id", Value: mockID}}
+	api.ImportStatement(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, respSuccess.Total)
+	assert.Equal(t, 1, respSuccess.Skipped)
+
+	// qif (200)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT user_id, currency FROM accounts.*").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "currency"}).AddRow(mockUserID, "USD"))
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+
+	refs := map[string]bool{}
+	for i, amount := range []float64{-12.5, -12.5} {
+		dbMock.ExpectQuery("SELECT EXISTS.*FROM expenses.*").WithArgs(mockID, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		if i == 0 {
+			// the second rule matches the coffees
+			dbMock.ExpectQuery("SELECT r.id, r.product_id.*FROM categorisation_rules.*").WithArgs(mockUserID).
+				WillReturnRows(sqlmock.NewRows(ruleLabel).
+					AddRow(mockID, mockID, "coffee", "", nil, 10, "USD").
+					AddRow(mockID2, mockID2, "", "(?i)^coffee", 10, nil, "usd"))
+		}
+		dbMock.ExpectQuery("SELECT EXISTS.*FROM accounts.*").WithArgs(mockID, mockUserID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		dbMock.ExpectExec("INSERT INTO expenses.*").
+			WithArgs(sqlmock.AnyArg(), mockID2, "2021-12-31", mockUserID, "USD", -amount, mockID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec("DELETE FROM expense_splits.*").WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec("UPDATE expenses SET external_ref.*").WithArgs(sqlmock.AnyArg(), refArg(refs)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	dbMock.ExpectRollback()
+
+	// the waived fee in between is skipped
+	qif := "!Account\nNChecking\nTBank\n^\n!Type:Bank\nD31/12'21\nT-12.50\nPCOFFEE\n^\nD31/12/2021\nT0.00\nPFEE\n^\n" +
+		"D31/12/2021\nT-12.50\nPCOFFEE\n^\n"
+	payload, contentType = filePayload(qif, map[string]string{"format": "qif", "date_format": "dd/mm", "product_id": mockID})
+	req, _ = http.NewRequest("POST", "?dry_run=true", payload)
+	req.Header.Set("Content-Type", contentType)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	c.Params = gin.Params{{Key: "id", Value: mockID}}
+	api.ImportStatement(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, respSuccess.Total)
+	assert.Equal(t, 1, respSuccess.Skipped)
+	assert.Equal(t, 2, len(respSuccess.Matches))
+	assert.Equal(t, mockID2, respSuccess.Matches[1].RuleId)
+	// the two alike coffees get their own hash
+	assert.Equal(t, 2, len(refs))
+}
+
+// refArg matches any hash ref and records it in refs
+type refArg map[string]bool
+
+func (refs refArg) Match(v driver.Value) bool {
+	ref, ok := v.(string)
+	refs[ref] = true
+	return ok && len(ref) == 64
+}
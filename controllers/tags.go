@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// tagLinks are the link tables of the taggable tables
+var tagLinks = map[string]struct{ table, column string }{
+	"expenses": {"expense_tags", "expense_id"},
+	"incomes":  {"income_tags", "income_id"},
+}
+
+// parseTagsQuery reads the tags=a,b query and whether all of them have to
+// match, any of them matching by default
+func parseTagsQuery(c *gin.Context) ([]string, string) {
+	var tags []string
+	for _, tag := range strings.Split(c.Query("tags"), ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	match := string(models.AnyTags)
+	if strings.ToLower(c.Query("tags_match")) == string(models.AllTags) {
+		match = string(models.AllTags)
+	}
+
+	return tags, match
+}
+
+// normalizeTags lower cases the tag names and drops the duplicates, nil
+// stays nil so an upsert without tags leaves the saved ones untouched
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > 50 || strings.Contains(tag, ",") {
+			return nil, errors.New("invalid-tag")
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized, nil
+}
+
+// tagsFilterQ restricts id to the rows tagged with any or all of the tags
+func tagsFilterQ(table, id string, tags []string, match string, n int) (string, interface{}) {
+	link := tagLinks[table]
+	having := ""
+	if match == string(models.AllTags) {
+		having = fmt.Sprintf(" GROUP BY xt.%s HAVING COUNT(DISTINCT tg.name) = %d", link.column, len(tags))
+	}
+
+	return fmt.Sprintf(` AND %[1]s IN (
+			SELECT xt.%[3]s FROM %[2]s xt JOIN tags tg ON xt.tag_id = tg.id
+			WHERE tg.name = ANY($%[4]d)%[5]s)`, id, link.table, link.column, n, having), pq.Array(tags)
+}
+
+// tagNamesQ selects the sorted tag names of id as an array
+func tagNamesQ(table, id string) string {
+	link := tagLinks[table]
+
+	return fmt.Sprintf(`ARRAY(SELECT tg.name FROM %[2]s xt JOIN tags tg ON xt.tag_id = tg.id
+				WHERE xt.%[3]s = %[1]s ORDER BY tg.name)`, id, link.table, link.column)
+}
+
+// setTags replaces the tags of the row id, creating the missing tags of the user
+func setTags(tx *sql.Tx, table, id, userId string, tags []string) error {
+	if tags == nil {
+		return nil
+	}
+
+	link := tagLinks[table]
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = $1", link.table, link.column), id); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	for _, tag := range tags {
+		var tagId string
+		if err := tx.QueryRow(`
+		INSERT INTO tags (user_id, name, created_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+		`, userId, tag).Scan(&tagId); err != nil {
+			log.Println(err)
+			return err
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s, tag_id) VALUES ($1, $2)", link.table, link.column), id, tagId); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+
+	return nil
+}
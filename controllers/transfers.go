@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+func (api *API) GetTransfers(c *gin.Context) {
+	u := ParsePayload(c)
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	order := c.Query("order")
+	orderBy := c.Query("order_by")
+
+	filter := models.TransferFilter{
+		Transfer: models.Transfer{
+			UserId:        c.Query("user_id"),
+			FromAccountId: c.Query("from_account_id"),
+			ToAccountId:   c.Query("to_account_id"),
+			Date:          c.Query("date"),
+		},
+		AccountId: c.Query("account_id"),
+		MinDate:   c.Query("min_date"),
+		MaxDate:   c.Query("max_date"),
+	}
+
+	if u.Role == string(models.Customer) {
+		filter.UserId = u.Id
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	if strings.ToUpper(order) != "ASC" && strings.ToUpper(order) != "DESC" {
+		order = "DESC"
+	}
+
+	mapOrderBy := map[string]string{
+		"id":              "t.id",
+		"user_id":         "t.user_id",
+		"from_account_id": "t.from_account_id",
+		"to_account_id":   "t.to_account_id",
+		"date":            "t.date",
+		"currency":        "t.currency",
+		"amount":          "t.amount",
+		"created_at":      "t.created_at",
+		"updated_at":      "t.updated_at",
+	}
+
+	if val, ok := mapOrderBy[orderBy]; ok {
+		orderBy = val
+	} else {
+		orderBy = "t.updated_at"
+	}
+
+	countQ := `SELECT COUNT(1) FROM transfers t
+		WHERE NOT t.deleted`
+	selectQ := `SELECT
+			t.id, t.user_id, t.from_account_id, t.to_account_id, t.date, t.description,
+			t.currency, t.amount, t.rate, a.currency, t.created_at, t.updated_at
+		FROM transfers t
+		JOIN accounts a ON t.to_account_id = a.id
+		WHERE NOT t.deleted`
+
+	var transferList models.TransferList
+	var transfers []models.Transfer
+	var err error
+
+	filterQ, stms := getFilterTransfer(filter)
+
+	selectQ = selectQ + filterQ
+	countQ = countQ + filterQ
+
+	offset := (page - 1) * limit
+	pagination := fmt.Sprintf(" LIMIT %d OFFSET %d ", limit, offset)
+	orderVal := fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+
+	log.Println(selectQ + orderVal + pagination)
+
+	rows, err := api.Db.Query(selectQ+orderVal+pagination, stms...)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var transfer models.Transfer
+		var description sql.NullString
+		var rate sql.NullFloat64
+		var date sql.NullTime
+
+		err = rows.Scan(&transfer.Id, &transfer.UserId, &transfer.FromAccountId, &transfer.ToAccountId, &date, &description,
+			&transfer.Currency, &transfer.Amount, &rate, &transfer.ToCurrency, &transfer.CreatedAt, &transfer.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		transfer.Description = description.String
+
+		if date.Valid {
+			transfer.Date = date.Time.Format(dateFormat)
+		}
+
+		// without a rate of its own the received amount depends on the
+		// exchange rates, see the account balances
+		if rate.Valid {
+			transfer.Rate = &rate.Float64
+			toAmount := roundAmount(transfer.Amount * rate.Float64)
+			transfer.ToAmount = &toAmount
+		} else if transfer.Currency == transfer.ToCurrency {
+			toAmount := transfer.Amount
+			transfer.ToAmount = &toAmount
+		}
+
+		transfers = append(transfers, transfer)
+	}
+
+	transferList.Total, err = api.GetTotal(countQ, stms)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	transferList.Transfers = transfers
+	transferList.Limit = limit
+	transferList.Page = page
+
+	c.JSON(http.StatusOK, transferList)
+}
+
+// UpsertTransfers takes the currency of the source account, the rate is
+// dropped when both accounts share the same currency
+func (api *API) UpsertTransfers(c *gin.Context) {
+	u := ParsePayload(c)
+	var payload models.UpsertTransferRequest
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	transfers := payload.Data
+	if len(transfers) == 0 {
+		sendError(c, http.StatusBadRequest, "missing-transfers")
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var errTransfers []models.RowError
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	customer := false
+	if u.Role == string(models.Customer) {
+		customer = true
+	}
+
+	for i, transfer := range transfers {
+		if customer {
+			transfer.UserId = u.Id
+		}
+
+		if _, err := uuid.FromString(transfer.Id); err != nil {
+			transfer.Id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if err := validateTransfer(&transfer); err != nil {
+			errTransfers = append(errTransfers, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		// both accounts have to belong to the transfer owner
+		fromCurrency, err := accountCurrency(tx, transfer.FromAccountId, transfer.UserId)
+		if err == sql.ErrNoRows {
+			err = errors.New("from-account-not-found")
+		}
+
+		if err != nil {
+			errTransfers = append(errTransfers, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		toCurrency, err := accountCurrency(tx, transfer.ToAccountId, transfer.UserId)
+		if err == sql.ErrNoRows {
+			err = errors.New("to-account-not-found")
+		}
+
+		if err != nil {
+			errTransfers = append(errTransfers, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		transfer.Currency = fromCurrency
+		if err := validateAmountCurrency(&transfer.Currency, transfer.Amount, currencies); err != nil {
+			errTransfers = append(errTransfers, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+
+		if fromCurrency == toCurrency {
+			transfer.Rate = nil
+		}
+
+		if _, err := tx.Exec(`
+		INSERT INTO transfers
+		(id, user_id, from_account_id, to_account_id, date, description, currency, amount, rate, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+		user_id = $2, from_account_id = $3, to_account_id = $4, date = $5, description = $6, currency = $7, amount = $8, rate = $9,
+		updated_at = CURRENT_TIMESTAMP, deleted = false
+		`, transfer.Id, transfer.UserId, transfer.FromAccountId, transfer.ToAccountId, transfer.Date, transfer.Description,
+			transfer.Currency, transfer.Amount, transfer.Rate); err != nil {
+			log.Println(err)
+			errTransfers = append(errTransfers, models.RowError{Row: i + 1, Message: err.Error()})
+			continue
+		}
+	}
+
+	code := http.StatusInternalServerError
+	obj := gin.H{"message": "error", "details": errTransfers}
+
+	if len(errTransfers) == 0 {
+		if err := tx.Commit(); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		code = http.StatusOK
+		obj = gin.H{"message": "success", "total": len(transfers)}
+	}
+
+	c.JSON(code, obj)
+}
+
+func (api *API) DeleteTransfers(c *gin.Context) {
+	api.BatchDeletes(c, "transfers")
+}
+
+func getFilterTransfer(filter models.TransferFilter) (filterQ string, stms []interface{}) {
+	if _, err := uuid.FromString(filter.UserId); err == nil {
+		filterQ = fmt.Sprintf(" AND t.user_id = $%d", len(stms)+1)
+		stms = append(stms, filter.UserId)
+	}
+
+	if _, err := uuid.FromString(filter.AccountId); err == nil {
+		filterQ += fmt.Sprintf(" AND $%d IN (t.from_account_id, t.to_account_id)", len(stms)+1)
+		stms = append(stms, filter.AccountId)
+	}
+
+	if _, err := uuid.FromString(filter.FromAccountId); err == nil {
+		filterQ += fmt.Sprintf(" AND t.from_account_id = $%d", len(stms)+1)
+		stms = append(stms, filter.FromAccountId)
+	}
+
+	if _, err := uuid.FromString(filter.ToAccountId); err == nil {
+		filterQ += fmt.Sprintf(" AND t.to_account_id = $%d", len(stms)+1)
+		stms = append(stms, filter.ToAccountId)
+	}
+
+	if date, err := time.Parse(dateFormat, filter.Date); err == nil {
+		filterQ += fmt.Sprintf(" AND t.date = $%d", len(stms)+1)
+		stms = append(stms, date)
+	}
+
+	if date, err := time.Parse(dateFormat, filter.MinDate); err == nil {
+		filterQ += fmt.Sprintf(" AND t.date >= $%d", len(stms)+1)
+		stms = append(stms, date)
+	}
+
+	if date, err := time.Parse(dateFormat, filter.MaxDate); err == nil {
+		filterQ += fmt.Sprintf(" AND t.date <= $%d", len(stms)+1)
+		stms = append(stms, date)
+	}
+
+	return
+}
+
+func validateTransfer(transfer *models.Transfer) error {
+
+	if transfer.FromAccountId == "" {
+		return errors.New("missing-from-account-id")
+	}
+
+	if transfer.ToAccountId == "" {
+		return errors.New("missing-to-account-id")
+	}
+
+	if transfer.Date == "" {
+		return errors.New("missing-date")
+	}
+
+	if transfer.Amount == 0 {
+		return errors.New("missing-amount")
+	}
+
+	if _, err := uuid.FromString(transfer.UserId); err != nil {
+		return errors.New("invalid-user-id")
+	}
+
+	if _, err := uuid.FromString(transfer.FromAccountId); err != nil {
+		return errors.New("invalid-from-account-id")
+	}
+
+	if _, err := uuid.FromString(transfer.ToAccountId); err != nil {
+		return errors.New("invalid-to-account-id")
+	}
+
+	if transfer.FromAccountId == transfer.ToAccountId {
+		return errors.New("same-from-and-to-account")
+	}
+
+	date, err := time.Parse(dateFormat, transfer.Date)
+	if err != nil {
+		return errors.New("invalid-date(yyyy-mm-dd)")
+	}
+
+	if date.After(time.Now()) {
+		return errors.New("date-shall-be-a-past-date")
+	}
+
+	if transfer.Amount < 0 {
+		return errors.New("amount-shall-be-positive")
+	}
+
+	if transfer.Rate != nil && *transfer.Rate <= 0 {
+		return errors.New("rate-shall-be-positive")
+	}
+
+	return nil
+}
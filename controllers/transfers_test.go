@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetTransfers(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	// err select (500)
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM transfers.*").WillReturnError(errors.New("err-select"))
+
+	req, _ := http.NewRequest("GET", "", nil)
+	c.Request = req
+	api.GetTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// scan error (500)
+	label := []string{
+		"id", "user_id", "from_account_id", "to_account_id", "date", "description",
+		"currency", "amount", "rate", "to_currency", "created_at", "updated_at",
+	}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM transfers.*").
+		WillReturnRows(sqlmock.NewRows(label[10:]).AddRow(time.Now(), time.Now()))
+
+	req, _ = http.NewRequest("GET", "?order_by=date", nil)
+	c.Request = req
+	api.GetTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "sql: expected 2 destination arguments in Scan, not 12", genericResp.Message)
+
+	// err count (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT.*FROM transfers.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, mockID2, time.Now(), nil,
+				"IDR", 500000, nil, "IDR", time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnError(errors.New("err-count"))
+
+	req, _ = http.NewRequest("GET", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-count", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	minDate := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxDate := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery("SELECT.*FROM transfers.*").WithArgs(mockUserID, mockID, minDate, maxDate).
+		WillReturnRows(sqlmock.NewRows(label).
+			AddRow(mockID, mockUserID, mockID, mockID2, time.Now(), "savings",
+				"IDR", 500000, nil, "IDR", time.Now(), time.Now()).
+			AddRow(mockID2, mockUserID, mockID, mockID2, time.Now(), nil,
+				"IDR", 1000000, 0.0000655, "USD", time.Now(), time.Now()).
+			AddRow(mockID2, mockUserID, mockID, mockID2, time.Now(), nil,
+				"IDR", 1000000, nil, "USD", time.Now(), time.Now()))
+	dbMock.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	q := url.Values{}
+	q.Add("account_id", mockID)
+	q.Add("min_date", "2022-01-01")
+	q.Add("max_date", "2022-01-31")
+
+	req, _ = http.NewRequest("GET", "", nil)
+	req.URL.RawQuery = q.Encode()
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.GetTransfers(c)
+
+	var resp models.TransferList
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, int(resp.Total))
+	assert.Equal(t, 3, len(resp.Transfers))
+	assert.Equal(t, "savings", resp.Transfers[0].Description)
+	assert.Equal(t, 500000.0, *resp.Transfers[0].ToAmount)
+	assert.Equal(t, 65.5, *resp.Transfers[1].ToAmount)
+	assert.Equal(t, true, resp.Transfers[2].ToAmount == nil)
+}
+
+func TestUpsertTransfers(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockID2 := "63eb226a-d612-412b-b8d4-a3e17b7d2228"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+
+	// nil request (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	api.UpsertTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", genericResp.Message)
+
+	// bad request (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload := parsePayload(models.UpsertTransferRequest{})
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-transfers", genericResp.Message)
+
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertTransferRequest{Data: []models.Transfer{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnError(fmt.Errorf("err-currencies"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-currencies", genericResp.Message)
+
+	// err begin (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(models.UpsertTransferRequest{Data: []models.Transfer{
+		{},
+	}})
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin().WillReturnError(fmt.Errorf("err-begin"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpsertTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-begin", genericResp.Message)
+
+	// transfers validation & insert failure (500)
+	respErrors := struct {
+		Message string            `json:"message"`
+		Details []models.RowError `json:"details"`
+	}{}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	dateFuture := time.Now().AddDate(1, 1, 1)
+	zeroRate := 0.0
+	rate := 0.0000655
+	transfer := models.Transfer{
+		Id: mockID, UserId: mockUserID, FromAccountId: mockID, ToAccountId: mockID2, Date: "2022-01-05", Amount: 1000000,
+	}
+	withChange := func(change func(t *models.Transfer)) models.Transfer {
+		t := transfer
+		change(&t)
+		return t
+	}
+	transfers := models.UpsertTransferRequest{Data: []models.Transfer{
+		{},
+		{FromAccountId: mockID},
+		{FromAccountId: mockID, ToAccountId: mockID2},
+		{FromAccountId: mockID, ToAccountId: mockID2, Date: "2022-01-05"},
+		withChange(func(t *models.Transfer) { t.UserId = "err" }),
+		withChange(func(t *models.Transfer) { t.FromAccountId = "err" }),
+		withChange(func(t *models.Transfer) { t.ToAccountId = "err" }),
+		withChange(func(t *models.Transfer) { t.ToAccountId = mockID }),
+		withChange(func(t *models.Transfer) { t.Date = "05-01-2022" }),
+		withChange(func(t *models.Transfer) { t.Date = dateFuture.Format("2006-01-02") }),
+		withChange(func(t *models.Transfer) { t.Amount = -1 }),
+		withChange(func(t *models.Transfer) { t.Rate = &zeroRate }),
+		// from account not found
+		transfer,
+		// to account not found
+		transfer,
+		// err select account
+		transfer,
+		// JPY has no minor unit
+		withChange(func(t *models.Transfer) { t.Amount = 10.5 }),
+		withChange(func(t *models.Transfer) { t.Rate = &rate }),
+	}}
+	payload = parsePayload(transfers)
+
+	currencyRow := func(currency string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"currency"}).AddRow(currency)
+	}
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnError(sql.ErrNoRows)
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnRows(currencyRow("IDR"))
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID2, mockUserID).WillReturnError(sql.ErrNoRows)
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnError(errors.New("err-account"))
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnRows(currencyRow("JPY"))
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID2, mockUserID).WillReturnRows(currencyRow("USD"))
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnRows(currencyRow("IDR"))
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID2, mockUserID).WillReturnRows(currencyRow("USD"))
+	dbMock.ExpectExec("INSERT INTO transfers.*").
+		WithArgs(mockID, mockUserID, mockID, mockID2, "2022-01-05", "", "IDR", 1000000.0, rate).
+		WillReturnError(fmt.Errorf("err-insert"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"ADMIN\"}}")
+	api.UpsertTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respErrors)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "error", respErrors.Message)
+	assert.Equal(t, 17, len(respErrors.Details))
+	assert.Equal(t, "missing-from-account-id", respErrors.Details[0].Message)
+	assert.Equal(t, "missing-to-account-id", respErrors.Details[1].Message)
+	assert.Equal(t, "missing-date", respErrors.Details[2].Message)
+	assert.Equal(t, "missing-amount", respErrors.Details[3].Message)
+	assert.Equal(t, "invalid-user-id", respErrors.Details[4].Message)
+	assert.Equal(t, "invalid-from-account-id", respErrors.Details[5].Message)
+	assert.Equal(t, "invalid-to-account-id", respErrors.Details[6].Message)
+	assert.Equal(t, "same-from-and-to-account", respErrors.Details[7].Message)
+	assert.Equal(t, "invalid-date(yyyy-mm-dd)", respErrors.Details[8].Message)
+	assert.Equal(t, "date-shall-be-a-past-date", respErrors.Details[9].Message)
+	assert.Equal(t, "amount-shall-be-positive", respErrors.Details[10].Message)
+	assert.Equal(t, "rate-shall-be-positive", respErrors.Details[11].Message)
+	assert.Equal(t, "from-account-not-found", respErrors.Details[12].Message)
+	assert.Equal(t, "to-account-not-found", respErrors.Details[13].Message)
+	assert.Equal(t, "err-account", respErrors.Details[14].Message)
+	assert.Equal(t, "amount-exceeds-currency-minor-unit", respErrors.Details[15].Message)
+	assert.Equal(t, "err-insert", respErrors.Details[16].Message)
+
+	// err commit (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	// the rate is dropped between accounts of the same currency
+	transfers = models.UpsertTransferRequest{Data: []models.Transfer{
+		withChange(func(t *models.Transfer) { t.Rate = &rate }),
+	}}
+	payload = parsePayload(transfers)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID, mockUserID).WillReturnRows(currencyRow("IDR"))
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WithArgs(mockID2, mockUserID).WillReturnRows(currencyRow("IDR"))
+	dbMock.ExpectExec("INSERT INTO transfers.*").
+		WithArgs(mockID, mockUserID, mockID, mockID2, "2022-01-05", "", "IDR", 1000000.0, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit().WillReturnError(fmt.Errorf("err-commit"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-commit", genericResp.Message)
+
+	// 200
+	respSuccess := struct {
+		Message string `json:"message"`
+		Total   int    `json:"total"`
+	}{}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT code.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WillReturnRows(currencyRow("IDR"))
+	dbMock.ExpectQuery("SELECT currency FROM accounts.*").WillReturnRows(currencyRow("IDR"))
+	dbMock.ExpectExec("INSERT INTO transfers.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	payload = parsePayload(transfers)
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpsertTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&respSuccess)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "success", respSuccess.Message)
+	assert.Equal(t, 1, respSuccess.Total)
+}
+
+func TestDeleteTransfers(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	// 200
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	var genericResp GenericResponse
+	payload := parsePayload(models.BatchDeleteRequest{Data: []string{mockID}})
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE transfers.*").WithArgs(sqlmock.AnyArg(), mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	req, _ := http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.DeleteTransfers(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+}
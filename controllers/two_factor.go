@@ -0,0 +1,494 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"budgetingapi/totp"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+)
+
+// the challenge is a few minutes to type the code in. The wrong codes are
+// counted per user across the challenges, too many of them lock two-factor
+// logins out for a while.
+const (
+	challengeTTL          = 5 * time.Minute
+	maxTwoFactorAttempts  = 5
+	twoFactorLockout      = 15 * time.Minute
+	recoveryCodesCount    = 10
+	recoveryCodeHexLength = 10
+)
+
+var (
+	errTwoFactorNotEnabled = errors.New("two-factor-not-enabled")
+	totpCodeRegex          = regexp.MustCompile(`^[0-9]{6}$`)
+	// recovery codes are typed with or without the dash
+	recoveryCodeReplacer = strings.NewReplacer("-", "", " ", "")
+)
+
+func challengeKey(token string) string {
+	return "2fa-challenge:" + token
+}
+
+func twoFactorAttemptsKey(userId string) string {
+	return "2fa-attempts:" + userId
+}
+
+// totpUsedKey remembers a code went through while it is still valid
+func totpUsedKey(userId string, step int64) string {
+	return fmt.Sprintf("totp-used:%s:%d", userId, step)
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+
+	return "Budgeting"
+}
+
+// newRecoveryCodes returns the codes as shown to the user, xxxxx-xxxxx
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeHexLength/2)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := fmt.Sprintf("%x", b)
+		codes[i] = code[:recoveryCodeHexLength/2] + "-" + code[recoveryCodeHexLength/2:]
+	}
+
+	return codes, nil
+}
+
+// EnrolTwoFactor generates a new secret for the user, two-factor is only
+// enabled once ConfirmTwoFactor gets a first code of it
+func (api *API) EnrolTwoFactor(c *gin.Context) {
+	u := ParsePayload(c)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res, err := api.Db.Exec(`
+		UPDATE users SET totp_secret = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND NOT totp_enabled AND NOT deleted
+	`, u.Id, secret)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		sendError(c, http.StatusConflict, "two-factor-already-enabled")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorEnrolment{Secret: secret, URI: totp.URI(totpIssuer(), u.Email, secret)})
+}
+
+// ConfirmTwoFactor enables two-factor with a code of the enrolled secret, the
+// recovery codes are only ever shown in its response
+func (api *API) ConfirmTwoFactor(c *gin.Context) {
+	u := ParsePayload(c)
+
+	var req models.TwoFactorCode
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Code == "" {
+		sendError(c, http.StatusBadRequest, "missing-code")
+		return
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	err := api.Db.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = $1 AND NOT deleted", u.Id).
+		Scan(&secret, &enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendError(c, http.StatusNotFound, "user-not-found")
+			return
+		}
+
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if enabled {
+		sendError(c, http.StatusConflict, "two-factor-already-enabled")
+		return
+	}
+
+	if !secret.Valid {
+		sendError(c, http.StatusBadRequest, "two-factor-not-enrolled")
+		return
+	}
+
+	step, ok := totp.Validate(secret.String, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		sendError(c, http.StatusBadRequest, "invalid-code")
+		return
+	}
+
+	// the code confirming is used up like a login one
+	if ok, err = api.useTOTPStep(u.Id, step); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !ok {
+		sendError(c, http.StatusBadRequest, "invalid-code")
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = $1", u.Id); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", u.Id); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	stored := make([]string, len(codes))
+	for i, code := range codes {
+		stored[i] = recoveryCodeReplacer.Replace(code)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO recovery_codes (user_id, code, created_at)
+		SELECT $1, crypt(code, gen_salt('bf', 8)), CURRENT_TIMESTAMP FROM UNNEST($2::text[]) code
+	`, u.Id, pq.Array(stored)); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor takes a code like a login would, so that a stolen session
+// alone cannot turn it off. The wrong codes count towards the same lockout.
+func (api *API) DisableTwoFactor(c *gin.Context) {
+	u := ParsePayload(c)
+
+	var req models.TwoFactorCode
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Code == "" {
+		sendError(c, http.StatusBadRequest, "missing-code")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	locked, err := api.twoFactorLocked(ctx, u.Id)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if locked {
+		sendError(c, http.StatusTooManyRequests, "too-many-attempts")
+		return
+	}
+
+	ok, err := api.checkTwoFactor(u.Id, req.Code)
+	if err == errTwoFactorNotEnabled {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !ok {
+		api.failTwoFactor(ctx, u.Id, "")
+		sendError(c, http.StatusBadRequest, "invalid-code")
+		return
+	}
+
+	tx, err := api.Db.Begin()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, u.Id); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", u.Id); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := api.Redis.Del(ctx, twoFactorAttemptsKey(u.Id)).Err(); err != nil {
+		log.Println(err)
+	}
+
+	c.JSON(http.StatusOK, genericOK)
+}
+
+// challengeTwoFactor answers a correct password with a challenge token
+// standing for the user until the second factor is checked
+func (api *API) challengeTwoFactor(c *gin.Context, user models.User) {
+	payload, _ := json.Marshal(user)
+	token := tokenGenerator()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// a new challenge would be as many new tries
+	locked, err := api.twoFactorLocked(ctx, user.Id)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if locked {
+		sendError(c, http.StatusTooManyRequests, "too-many-attempts")
+		return
+	}
+
+	if err := api.Redis.Set(ctx, challengeKey(token), string(payload), challengeTTL).Err(); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorChallenge{ChallengeToken: token, ExpiresIn: int(challengeTTL.Seconds())})
+}
+
+// LoginTwoFactor exchanges the challenge token and a TOTP or recovery code
+// for a session
+func (api *API) LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLogin
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ChallengeToken == "" || req.Code == "" {
+		sendError(c, http.StatusBadRequest, "missing-challenge-token-or-code")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payload, err := api.Redis.Get(ctx, challengeKey(req.ChallengeToken)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			sendError(c, http.StatusUnauthorized, "challenge-invalid-or-expired")
+			return
+		}
+
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var user models.User
+	if err := json.Unmarshal([]byte(payload), &user); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// the challenges issued before the lockout are no way around it
+	locked, err := api.twoFactorLocked(ctx, user.Id)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if locked {
+		api.Redis.Del(ctx, challengeKey(req.ChallengeToken))
+		sendError(c, http.StatusTooManyRequests, "too-many-attempts")
+		return
+	}
+
+	ok, err := api.checkTwoFactor(user.Id, req.Code)
+	if err != nil && err != errTwoFactorNotEnabled {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !ok {
+		api.failTwoFactor(ctx, user.Id, req.ChallengeToken)
+		sendError(c, http.StatusUnauthorized, "invalid-code")
+		return
+	}
+
+	// a challenge makes one session, even when sent twice at once
+	deleted, err := api.Redis.Del(ctx, challengeKey(req.ChallengeToken)).Result()
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if deleted == 0 {
+		sendError(c, http.StatusUnauthorized, "challenge-invalid-or-expired")
+		return
+	}
+
+	if err := api.Redis.Del(ctx, twoFactorAttemptsKey(user.Id)).Err(); err != nil {
+		log.Println(err)
+	}
+
+	api.startSession(c, models.AuthResponse{User: user})
+}
+
+// twoFactorLocked tells whether the user had too many wrong codes lately
+func (api *API) twoFactorLocked(ctx context.Context, userId string) (bool, error) {
+	attempts, err := api.Redis.Get(ctx, twoFactorAttemptsKey(userId)).Int()
+	if err == redis.Nil {
+		return false, nil
+	}
+
+	return attempts >= maxTwoFactorAttempts, err
+}
+
+// failTwoFactor counts a wrong code of the user, each one pushes the lockout
+// back. The challenge, if any, is dropped once the user is locked out.
+func (api *API) failTwoFactor(ctx context.Context, userId, token string) {
+	attempts, err := api.Redis.Incr(ctx, twoFactorAttemptsKey(userId)).Result()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	api.Redis.Expire(ctx, twoFactorAttemptsKey(userId), twoFactorLockout)
+
+	if attempts >= maxTwoFactorAttempts {
+		log.Println("too many two-factor attempts, locking out", userId)
+		if token != "" {
+			api.Redis.Del(ctx, challengeKey(token))
+		}
+	}
+}
+
+// checkTwoFactor tells whether the code is a TOTP code of the user not used
+// yet, or one of their recovery codes which is then used up
+func (api *API) checkTwoFactor(userId, code string) (bool, error) {
+	var secret string
+	err := api.Db.QueryRow("SELECT totp_secret FROM users WHERE id = $1 AND totp_enabled", userId).Scan(&secret)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, errTwoFactorNotEnabled
+		}
+
+		return false, err
+	}
+
+	code = strings.ToLower(recoveryCodeReplacer.Replace(code))
+
+	if totpCodeRegex.MatchString(code) {
+		step, ok := totp.Validate(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+
+		return api.useTOTPStep(userId, step)
+	}
+
+	res, err := api.Db.Exec(`
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL AND code = crypt($2, code)
+	`, userId, code)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, err
+}
+
+// useTOTPStep marks the code of the step as used, false when it already was
+func (api *API) useTOTPStep(userId string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the code stays valid for the steps of the skew after its own
+	return api.Redis.SetNX(ctx, totpUsedKey(userId, step), 1, (2*totp.Skew+1)*totp.Period).Result()
+}
@@ -0,0 +1,519 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"budgetingapi/totp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redismock/v8"
+	"gotest.tools/assert"
+)
+
+const mockTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func TestEnrolTwoFactor(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"email\":\"test@gmail.com\", \"role\":\"CUSTOMER\"}}"
+
+	// err update (500)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	dbMock.ExpectExec("UPDATE users SET totp_secret.*").WithArgs(mockUserID, sqlmock.AnyArg()).
+		WillReturnError(errors.New("err-update"))
+
+	req, _ := http.NewRequest("POST", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.EnrolTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-update", genericResp.Message)
+
+	// already enabled (409)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectExec("UPDATE users SET totp_secret.*NOT totp_enabled").WithArgs(mockUserID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	req, _ = http.NewRequest("POST", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.EnrolTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "two-factor-already-enabled", genericResp.Message)
+
+	// 200
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectExec("UPDATE users SET totp_secret.*").WithArgs(mockUserID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req, _ = http.NewRequest("POST", "", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.EnrolTwoFactor(c)
+
+	var resp models.TwoFactorEnrolment
+
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 32, len(resp.Secret))
+	assert.Equal(t, true, strings.HasPrefix(resp.URI, "otpauth://totp/Budgeting:test@gmail.com?"))
+	assert.Equal(t, true, strings.Contains(resp.URI, "secret="+resp.Secret))
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
+
+func TestConfirmTwoFactor(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	redisDB, redisMock := redismock.NewClientMock()
+	api.Redis = redisDB
+
+	var genericResp GenericResponse
+
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+	code, _ := totp.Code(mockTOTPSecret, totp.Step(time.Now()))
+
+	// missing code (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("POST", "", parsePayload(models.TwoFactorCode{}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.ConfirmTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-code", genericResp.Message)
+
+	// not enrolled (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT totp_secret, totp_enabled.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled"}).AddRow(nil, false))
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorCode{Code: code}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.ConfirmTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "two-factor-not-enrolled", genericResp.Message)
+
+	// already enabled (409)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT totp_secret, totp_enabled.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled"}).AddRow(mockTOTPSecret, true))
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorCode{Code: code}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.ConfirmTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "two-factor-already-enabled", genericResp.Message)
+
+	// invalid code (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT totp_secret, totp_enabled.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled"}).AddRow(mockTOTPSecret, false))
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorCode{Code: "12345"}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.ConfirmTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-code", genericResp.Message)
+
+	// code already used, e.g. by a login (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT totp_secret, totp_enabled.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled"}).AddRow(mockTOTPSecret, false))
+	redisMock.Regexp().ExpectSetNX("^totp-used:"+mockUserID+":[0-9]+$", 1, 90*time.Second).SetVal(false)
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorCode{Code: code}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.ConfirmTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-code", genericResp.Message)
+
+	// err insert recovery codes (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT totp_secret, totp_enabled.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled"}).AddRow(mockTOTPSecret, false))
+	redisMock.Regexp().ExpectSetNX("^totp-used:"+mockUserID+":[0-9]+$", 1, 90*time.Second).SetVal(true)
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE users SET totp_enabled = TRUE.*").WithArgs(mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM recovery_codes.*").WithArgs(mockUserID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("INSERT INTO recovery_codes.*").WithArgs(mockUserID, sqlmock.AnyArg()).
+		WillReturnError(errors.New("err-insert"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorCode{Code: code}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.ConfirmTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-insert", genericResp.Message)
+
+	// 200, the code cannot be used again
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT totp_secret, totp_enabled.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled"}).AddRow(mockTOTPSecret, false))
+	redisMock.Regexp().ExpectSetNX("^totp-used:"+mockUserID+":[0-9]+$", 1, 90*time.Second).SetVal(true)
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE users SET totp_enabled = TRUE.*").WithArgs(mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM recovery_codes.*").WithArgs(mockUserID).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("INSERT INTO recovery_codes.*crypt.*UNNEST").WithArgs(mockUserID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	dbMock.ExpectCommit()
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorCode{Code: code}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.ConfirmTwoFactor(c)
+
+	var resp models.RecoveryCodes
+
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 10, len(resp.RecoveryCodes))
+	assert.Equal(t, 11, len(resp.RecoveryCodes[0]))
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	redisDB, redisMock := redismock.NewClientMock()
+	api.Redis = redisDB
+
+	var genericResp GenericResponse
+
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	// not enabled (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).RedisNil()
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*totp_enabled").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}))
+
+	req, _ := http.NewRequest("DELETE", "", parsePayload(models.TwoFactorCode{Code: "abcde-01234"}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.DisableTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "two-factor-not-enabled", genericResp.Message)
+
+	// used recovery code, the attempt is counted (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).RedisNil()
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}).AddRow(mockTOTPSecret))
+	dbMock.ExpectExec("UPDATE recovery_codes SET used_at.*used_at IS NULL").WithArgs(mockUserID, "abcde01234").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	redisMock.ExpectIncr("2fa-attempts:" + mockUserID).SetVal(maxTwoFactorAttempts)
+	redisMock.ExpectExpire("2fa-attempts:"+mockUserID, twoFactorLockout).SetVal(true)
+
+	req, _ = http.NewRequest("DELETE", "", parsePayload(models.TwoFactorCode{Code: "ABCDE-01234"}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.DisableTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-code", genericResp.Message)
+
+	// locked out, even a right code is not checked (429)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).SetVal("5")
+
+	req, _ = http.NewRequest("DELETE", "", parsePayload(models.TwoFactorCode{Code: "abcde-01234"}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.DisableTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "too-many-attempts", genericResp.Message)
+
+	// 200 with a recovery code
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).SetVal("1")
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}).AddRow(mockTOTPSecret))
+	dbMock.ExpectExec("UPDATE recovery_codes SET used_at.*").WithArgs(mockUserID, "abcde01234").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE users SET totp_secret = NULL.*").WithArgs(mockUserID).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM recovery_codes.*").WithArgs(mockUserID).WillReturnResult(sqlmock.NewResult(0, 9))
+	dbMock.ExpectCommit()
+	redisMock.ExpectDel("2fa-attempts:" + mockUserID).SetVal(1)
+
+	req, _ = http.NewRequest("DELETE", "", parsePayload(models.TwoFactorCode{Code: "abcde-01234"}))
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.DisableTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", genericResp.Message)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	redisDB, redisMock := redismock.NewClientMock()
+	api.Redis = redisDB
+
+	var genericResp GenericResponse
+
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	challenge := "test-challenge"
+	user := "{\"id\":\"" + mockUserID + "\",\"email\":\"test@gmail.com\",\"name\":\"test\",\"role\":\"CUSTOMER\"}"
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(mockTOTPSecret, step)
+	expired, _ := totp.Code(mockTOTPSecret, step-10)
+
+	// missing code (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: challenge}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-challenge-token-or-code", genericResp.Message)
+
+	// expired challenge (401)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-challenge:" + challenge).RedisNil()
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: challenge, Code: code}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "challenge-invalid-or-expired", genericResp.Message)
+
+	// wrong code, the attempt is counted (401)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-challenge:" + challenge).SetVal(user)
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).RedisNil()
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}).AddRow(mockTOTPSecret))
+	redisMock.ExpectIncr("2fa-attempts:" + mockUserID).SetVal(1)
+	redisMock.ExpectExpire("2fa-attempts:"+mockUserID, twoFactorLockout).SetVal(true)
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: challenge, Code: expired}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "invalid-code", genericResp.Message)
+
+	// too many wrong codes, the challenge is dropped (401)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-challenge:" + challenge).SetVal(user)
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).RedisNil()
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}).AddRow(mockTOTPSecret))
+	dbMock.ExpectExec("UPDATE recovery_codes.*").WithArgs(mockUserID, "abcde01234").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	redisMock.ExpectIncr("2fa-attempts:" + mockUserID).SetVal(maxTwoFactorAttempts)
+	redisMock.ExpectExpire("2fa-attempts:"+mockUserID, twoFactorLockout).SetVal(true)
+	redisMock.ExpectDel("2fa-challenge:" + challenge).SetVal(1)
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: challenge, Code: "abcde-01234"}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "invalid-code", genericResp.Message)
+
+	// locked out, another challenge of the same password gets no more tries (429)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-challenge:other-challenge").SetVal(user)
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).SetVal("5")
+	redisMock.ExpectDel("2fa-challenge:other-challenge").SetVal(1)
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: "other-challenge", Code: code}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "too-many-attempts", genericResp.Message)
+
+	// code already used (401)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-challenge:" + challenge).SetVal(user)
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).RedisNil()
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}).AddRow(mockTOTPSecret))
+	redisMock.Regexp().ExpectSetNX("^totp-used:"+mockUserID+":[0-9]+$", 1, 90*time.Second).SetVal(false)
+	redisMock.ExpectIncr("2fa-attempts:" + mockUserID).SetVal(1)
+	redisMock.ExpectExpire("2fa-attempts:"+mockUserID, twoFactorLockout).SetVal(true)
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: challenge, Code: code}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "invalid-code", genericResp.Message)
+
+	// challenge used meanwhile (401)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-challenge:" + challenge).SetVal(user)
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).RedisNil()
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}).AddRow(mockTOTPSecret))
+	redisMock.Regexp().ExpectSetNX("^totp-used:"+mockUserID+":[0-9]+$", 1, 90*time.Second).SetVal(true)
+	redisMock.ExpectDel("2fa-challenge:" + challenge).SetVal(0)
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: challenge, Code: code}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "challenge-invalid-or-expired", genericResp.Message)
+
+	// 200, a session like a login without two-factor
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	redisMock.ExpectGet("2fa-challenge:" + challenge).SetVal(user)
+	redisMock.ExpectGet("2fa-attempts:" + mockUserID).RedisNil()
+	dbMock.ExpectQuery("SELECT totp_secret FROM users.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret"}).AddRow(mockTOTPSecret))
+	redisMock.Regexp().ExpectSetNX("^totp-used:"+mockUserID+":[0-9]+$", 1, 90*time.Second).SetVal(true)
+	redisMock.ExpectDel("2fa-challenge:" + challenge).SetVal(1)
+	// the count starts over
+	redisMock.ExpectDel("2fa-attempts:" + mockUserID).SetVal(1)
+	expectSaveSession(redisMock, mockUserID, "[0-9a-f-]{36}")
+
+	req, _ = http.NewRequest("POST", "", parsePayload(models.TwoFactorLogin{ChallengeToken: challenge, Code: code}))
+	c.Request = req
+	api.LoginTwoFactor(c)
+
+	var respOK models.AuthResponse
+
+	err = json.NewDecoder(w.Body).Decode(&respOK)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "test@gmail.com", respOK.Email)
+	assert.Equal(t, true, strings.HasPrefix(respOK.Token, "Bearer "))
+	assert.Equal(t, true, respOK.RefreshToken != "")
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+}
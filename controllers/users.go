@@ -8,11 +8,16 @@ import (
 	"log"
 	"net/http"
 	"net/mail"
+	"regexp"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
 )
 
+// language tag such as "id", "en-US" or "zh-Hant-TW"
+var localeRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
 // only customer
 func (api *API) Register(c *gin.Context) {
 	var user models.User
@@ -67,8 +72,8 @@ func (api *API) GetUser(c *gin.Context) {
 
 	var user models.User
 
-	if err := api.Db.QueryRow("SELECT id, email, name, role, created_at, updated_at FROM users WHERE id = $1 AND NOT deleted", userId).
-		Scan(&user.Id, &user.Email, &user.Name, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
+	if err := api.Db.QueryRow("SELECT id, email, name, role, base_currency, locale, created_at, updated_at FROM users WHERE id = $1 AND NOT deleted", userId).
+		Scan(&user.Id, &user.Email, &user.Name, &user.Role, &user.BaseCurrency, &user.Locale, &user.CreatedAt, &user.UpdatedAt); err != nil {
 		if err == sql.ErrNoRows {
 			sendError(c, http.StatusNotFound, "user-not-found")
 			return
@@ -100,6 +105,12 @@ func (api *API) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if err := validatePreferences(&user); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	var exists bool
 	if err := api.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1 AND id != $2 AND NOT deleted)", user.Email, userId).Scan(&exists); err != nil {
 		log.Println(err)
@@ -112,12 +123,36 @@ func (api *API) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if user.BaseCurrency != nil && *user.BaseCurrency != "" {
+		if err := api.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM currencies WHERE code = $1)", *user.BaseCurrency).Scan(&exists); err != nil {
+			log.Println(err)
+			sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if !exists {
+			sendError(c, http.StatusBadRequest, "unsupported-currency")
+			return
+		}
+	}
+
 	q := "UPDATE users SET name = $1, email = $2"
 	stms := []interface{}{user.Name, user.Email}
 
+	// the preferences are kept when left out, empty ones are stored as NULL
+	if user.BaseCurrency != nil {
+		stms = append(stms, *user.BaseCurrency)
+		q += fmt.Sprintf(", base_currency = NULLIF($%d, '')", len(stms))
+	}
+
+	if user.Locale != nil {
+		stms = append(stms, *user.Locale)
+		q += fmt.Sprintf(", locale = NULLIF($%d, '')", len(stms))
+	}
+
 	if updatePassword {
-		q += ", password = crypt($3, gen_salt('bf', 8))"
 		stms = append(stms, user.Password)
+		q += fmt.Sprintf(", password = crypt($%d, gen_salt('bf', 8))", len(stms))
 	}
 
 	stms = append(stms, userId)
@@ -158,3 +193,36 @@ func validateUser(user models.User, checkPassword bool) error {
 
 	return nil
 }
+
+func validatePreferences(user *models.User) error {
+	if user.BaseCurrency != nil {
+		base := strings.ToUpper(*user.BaseCurrency)
+		if base != "" && !isCurrencyCode(base) {
+			return errors.New("invalid-base-currency")
+		}
+
+		user.BaseCurrency = &base
+	}
+
+	if user.Locale != nil && *user.Locale != "" && !localeRegex.MatchString(*user.Locale) {
+		return errors.New("invalid-locale(bcp-47)")
+	}
+
+	return nil
+}
+
+// defaultBaseCurrency falls back to the user's preferred currency when none
+// was requested, it stays empty when the user has no preference either
+func (api *API) defaultBaseCurrency(userId, base string) (string, error) {
+	if base != "" || userId == "" {
+		return base, nil
+	}
+
+	var preferred sql.NullString
+	err := api.Db.QueryRow("SELECT base_currency FROM users WHERE id = $1", userId).Scan(&preferred)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	return preferred.String, nil
+}
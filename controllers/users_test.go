@@ -226,7 +226,7 @@ func TestGetUser(t *testing.T) {
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 
-	label := []string{"id", "email", "name", "role", "created_at", "updated_at"}
+	label := []string{"id", "email", "name", "role", "base_currency", "locale", "created_at", "updated_at"}
 	dbMock.ExpectQuery("SELECT id.*").
 		WillReturnRows(sqlmock.NewRows(label))
 
@@ -246,7 +246,7 @@ func TestGetUser(t *testing.T) {
 
 	dbMock.ExpectQuery("SELECT id.*").WithArgs(mockUserID).
 		WillReturnRows(sqlmock.NewRows(label).
-			AddRow(mockUserID, "test@gmail.com", "test", "CUSTOMER", time.Now(), time.Now()))
+			AddRow(mockUserID, "test@gmail.com", "test", "CUSTOMER", "IDR", "en-US", time.Now(), time.Now()))
 
 	req, _ = http.NewRequest("GET", "", nil)
 	c.Request = req
@@ -259,9 +259,12 @@ func TestGetUser(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, mockUserID, user.Id)
+	assert.Equal(t, "IDR", *user.BaseCurrency)
+	assert.Equal(t, "en-US", *user.Locale)
 }
 
 func TestUpdateUser(t *testing.T) {
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
 	db, dbMock, err := sqlmock.New()
 	assert.Equal(t, nil, err)
 
@@ -331,7 +334,79 @@ func TestUpdateUser(t *testing.T) {
 	assert.Equal(t, http.StatusConflict, w.Code)
 	assert.Equal(t, "email-already-exist", genericResp.Message)
 
+	// invalid base currency (400)
+	baseCurrency := "euro"
+	user.BaseCurrency = &baseCurrency
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(user)
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpdateUser(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-base-currency", genericResp.Message)
+
+	// invalid locale (400)
+	baseCurrency = "usd"
+	user.BaseCurrency = &baseCurrency
+	locale := "en_US"
+	user.Locale = &locale
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(user)
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpdateUser(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-locale(bcp-47)", genericResp.Message)
+
+	// err select currency (500)
+	locale = "en-US"
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(user)
+
+	dbMock.ExpectQuery("SELECT EXISTS.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT EXISTS.*currencies.*").WithArgs("USD").WillReturnError(errors.New("err-select"))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpdateUser(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-select", genericResp.Message)
+
+	// unsupported currency (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(user)
+
+	dbMock.ExpectQuery("SELECT EXISTS.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery("SELECT EXISTS.*currencies.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	api.UpdateUser(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "unsupported-currency", genericResp.Message)
+
 	// err update (500)
+	baseCurrency = ""
+	locale = ""
+	user.BaseCurrency = &baseCurrency
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 	payload = parsePayload(user)
@@ -348,13 +423,81 @@ func TestUpdateUser(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Equal(t, "err-update", genericResp.Message)
 
+	// clears the preferences (200)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(user)
+
+	dbMock.ExpectQuery("SELECT EXISTS.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectExec("UPDATE users SET name = .*, email = .*, base_currency = .*, locale = .*, password = .* WHERE id = \\$6").
+		WithArgs("test", "test@gmail.com", "", "", "test1234", mockUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpdateUser(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// without the preferences the stored ones are kept (200)
+	user.BaseCurrency = nil
+	user.Locale = nil
+	user.Password = ""
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(user)
+
+	dbMock.ExpectQuery("SELECT EXISTS.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectExec("UPDATE users SET name = .*, email = .* WHERE id = \\$3").
+		WithArgs("test", "test@gmail.com", mockUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpdateUser(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// only the locale (200)
+	locale = "id"
+	user.Locale = &locale
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	payload = parsePayload(user)
+
+	dbMock.ExpectQuery("SELECT EXISTS.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectExec("UPDATE users SET name = .*, email = .*, locale = NULLIF\\(\\$3, ''\\) WHERE id = \\$4").
+		WithArgs("test", "test@gmail.com", "id", mockUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req, _ = http.NewRequest("POST", "", payload)
+	c.Request = req
+	c.Request.Header.Set("payload", "{\"user\":{\"id\":\""+mockUserID+"\", \"role\":\"CUSTOMER\"}}")
+	api.UpdateUser(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+
 	// 200
+	baseCurrency = "usd"
+	user.BaseCurrency = &baseCurrency
+	locale = "zh-Hant-TW"
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 	payload = parsePayload(user)
 
 	dbMock.ExpectQuery("SELECT EXISTS.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
-	dbMock.ExpectExec("UPDATE users.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT EXISTS.*currencies.*").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectExec("UPDATE users.*").
+		WithArgs("test", "test@gmail.com", "USD", "zh-Hant-TW", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	req, _ = http.NewRequest("POST", "", payload)
 	c.Request = req
@@ -0,0 +1,598 @@
+package controllers
+
+import (
+	"budgetingapi/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// GetWorkbookReport sends one xlsx with the expenses, the incomes, the totals
+// per category and the monthly summary of the period with its chart. The
+// amounts are numbers formatted in their currency, in the user's base
+// currency too when there is one.
+func (api *API) GetWorkbookReport(c *gin.Context) {
+	u := ParsePayload(c)
+
+	minDate, err := time.Parse(dateFormat, c.Query("min_date"))
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-min-date")
+		return
+	}
+
+	maxDate, err := time.Parse(dateFormat, c.Query("max_date"))
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "invalid-max-date")
+		return
+	}
+
+	if maxDate.Before(minDate) {
+		sendError(c, http.StatusBadRequest, "invalid-date-range")
+		return
+	}
+
+	userId := c.Query("user_id")
+	if u.Role == string(models.Customer) {
+		userId = u.Id
+	}
+
+	baseCurrency, err := parseBaseCurrency(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	baseCurrency, err = api.defaultBaseCurrency(u.Id, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	currencies, err := api.getCurrencies()
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	wb, err := newWorkbook(currencies, "Expenses", "Incomes", "Categories", "Summary")
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	expenseFilter := models.ExpenseFilter{
+		Expense: models.Expense{UserId: userId},
+		MinDate: c.Query("min_date"),
+		MaxDate: c.Query("max_date"),
+	}
+
+	incomeFilter := models.IncomeFilter{
+		Income:  models.Income{UserId: userId},
+		MinDate: c.Query("min_date"),
+		MaxDate: c.Query("max_date"),
+	}
+
+	expenseFilterQ, stms := getFilterExpense(expenseFilter)
+	incomeFilterQ, _ := getFilterIncome(incomeFilter)
+
+	if err = api.writeExpensesSheet(wb, expenseFilterQ, stms, baseCurrency); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = api.writeIncomesSheet(wb, incomeFilterQ, stms, baseCurrency); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	report, err := api.expensesReport(expenseFilter, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = wb.writeCategoriesSheet(report); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// with only the user and the dates set both filters take the same arguments
+	months, err := api.monthlyTotals(expenseFilterQ, incomeFilterQ, stms, baseCurrency)
+	if err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = wb.writeSummarySheet(months); err != nil {
+		log.Println(err)
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fileName := fmt.Sprintf("report_workbook_%s_%s.xlsx", minDate.Format(dateFormat), maxDate.Format(dateFormat))
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", "attachment;filename=\""+fileName+"\"")
+
+	if _, err := wb.WriteTo(c.Writer); err != nil {
+		sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+}
+
+// workbook keeps the styles shared by the sheets of the report, the amount
+// style of each currency is made on first use
+type workbook struct {
+	*excelize.File
+	headerStyle  int
+	dataStyle    int
+	currencies   map[string]models.Currency
+	amountStyles map[string]int
+}
+
+// newWorkbook makes the sheets upfront, the default sheet being the first one
+// and the last one the active one. Deleting a sheet or changing the active one
+// rereads every sheet and drops what was streamed, so none of that can happen
+// later.
+func newWorkbook(currencies map[string]models.Currency, sheets ...string) (wb *workbook, err error) {
+	wb = &workbook{
+		File:         excelize.NewFile(),
+		currencies:   currencies,
+		amountStyles: map[string]int{},
+	}
+
+	wb.SetSheetName("Sheet1", sheets[0])
+	for _, sheet := range sheets[1:] {
+		wb.NewSheet(sheet)
+	}
+
+	wb.SetActiveSheet(wb.GetSheetIndex(sheets[len(sheets)-1]))
+
+	if wb.headerStyle, err = wb.NewStyle(s1); err != nil {
+		return
+	}
+
+	wb.dataStyle, err = wb.NewStyle(s2)
+
+	return
+}
+
+// amountFormat is the number format of formatAmount
+func amountFormat(currency string, currencies map[string]models.Currency) string {
+	symbol, minorUnit := currencyDisplay(currency, currencies)
+
+	format := fmt.Sprintf(`"%s" #,##0`, strings.ReplaceAll(symbol, `"`, ""))
+	if minorUnit > 0 {
+		format += "." + strings.Repeat("0", minorUnit)
+	}
+
+	return format
+}
+
+func (wb *workbook) amountStyle(currency string) (int, error) {
+	if id, ok := wb.amountStyles[currency]; ok {
+		return id, nil
+	}
+
+	var style excelize.Style
+	if err := json.Unmarshal([]byte(s2), &style); err != nil {
+		return 0, err
+	}
+
+	format := amountFormat(currency, wb.currencies)
+	style.CustomNumFmt = &format
+
+	id, err := wb.NewStyle(&style)
+	if err != nil {
+		return 0, err
+	}
+
+	wb.amountStyles[currency] = id
+
+	return id, nil
+}
+
+// amountCell is a number cell formatted in currency, no amount leaves it empty
+func (wb *workbook) amountCell(currency string, amount *float64) (excelize.Cell, error) {
+	style, err := wb.amountStyle(currency)
+	if err != nil || amount == nil {
+		return excelize.Cell{StyleID: style}, err
+	}
+
+	return excelize.Cell{StyleID: style, Value: *amount}, nil
+}
+
+// newListSheet adds the sheet with its header row and returns the stream
+// writer the list rows go through
+func (wb *workbook) newListSheet(sheet string, header []string) (*excelize.StreamWriter, error) {
+	lastCol, _ := excelize.ColumnNumberToName(len(header))
+	if err := wb.SetColWidth(sheet, "A", lastCol, 25); err != nil {
+		return nil, err
+	}
+
+	streamWriter, err := wb.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]interface{}, len(header))
+	for i, name := range header {
+		row[i] = excelize.Cell{StyleID: wb.headerStyle, Value: name}
+	}
+
+	return streamWriter, streamWriter.SetRow("A1", row)
+}
+
+func (api *API) writeExpensesSheet(wb *workbook, filterQ string, stms []interface{}, baseCurrency string) error {
+	q, args := expensesSelectQ(filterQ, stms, baseCurrency)
+
+	cur, err := api.openExportCursor(q+" ORDER BY e.date, e.created_at", args)
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close()
+
+	header := []string{"Date", "Category", "Product", "Currency", "Amount"}
+	if baseCurrency != "" {
+		header = append(header, "Amount ("+baseCurrency+")")
+	}
+
+	header = append(header, "Tags", "ID")
+
+	streamWriter, err := wb.newListSheet("Expenses", header)
+	if err != nil {
+		return err
+	}
+
+	for n := 2; cur.Next(); n++ {
+		expense, err := scanExpense(cur, baseCurrency != "")
+		if err != nil {
+			return err
+		}
+
+		amount, err := wb.amountCell(expense.Currency, &expense.Amount)
+		if err != nil {
+			return err
+		}
+
+		row := []interface{}{
+			excelize.Cell{StyleID: wb.dataStyle, Value: expense.Date},
+			excelize.Cell{StyleID: wb.dataStyle, Value: expense.CategoryName},
+			excelize.Cell{StyleID: wb.dataStyle, Value: expense.ProductName},
+			excelize.Cell{StyleID: wb.dataStyle, Value: expense.Currency},
+			amount}
+
+		if baseCurrency != "" {
+			converted, err := wb.amountCell(baseCurrency, expense.ConvertedAmount)
+			if err != nil {
+				return err
+			}
+
+			row = append(row, converted)
+		}
+
+		row = append(row,
+			excelize.Cell{StyleID: wb.dataStyle, Value: strings.Join(expense.Tags, ", ")},
+			excelize.Cell{StyleID: wb.dataStyle, Value: expense.Id})
+
+		cell, _ := excelize.CoordinatesToCellName(1, n)
+		if err = streamWriter.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	return streamWriter.Flush()
+}
+
+func (api *API) writeIncomesSheet(wb *workbook, filterQ string, stms []interface{}, baseCurrency string) error {
+	q, args := incomesSelectQ(filterQ, stms, baseCurrency)
+
+	cur, err := api.openExportCursor(q+" ORDER BY date, created_at", args)
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close()
+
+	header := []string{"Date", "Name", "Description", "Currency", "Amount"}
+	if baseCurrency != "" {
+		header = append(header, "Amount ("+baseCurrency+")")
+	}
+
+	header = append(header, "Tags", "ID")
+
+	streamWriter, err := wb.newListSheet("Incomes", header)
+	if err != nil {
+		return err
+	}
+
+	for n := 2; cur.Next(); n++ {
+		income, err := scanIncome(cur, baseCurrency != "")
+		if err != nil {
+			return err
+		}
+
+		amount, err := wb.amountCell(income.Currency, &income.Amount)
+		if err != nil {
+			return err
+		}
+
+		row := []interface{}{
+			excelize.Cell{StyleID: wb.dataStyle, Value: income.Date},
+			excelize.Cell{StyleID: wb.dataStyle, Value: income.Name},
+			excelize.Cell{StyleID: wb.dataStyle, Value: income.Description},
+			excelize.Cell{StyleID: wb.dataStyle, Value: income.Currency},
+			amount}
+
+		if baseCurrency != "" {
+			converted, err := wb.amountCell(baseCurrency, income.ConvertedAmount)
+			if err != nil {
+				return err
+			}
+
+			row = append(row, converted)
+		}
+
+		row = append(row,
+			excelize.Cell{StyleID: wb.dataStyle, Value: strings.Join(income.Tags, ", ")},
+			excelize.Cell{StyleID: wb.dataStyle, Value: income.Id})
+
+		cell, _ := excelize.CoordinatesToCellName(1, n)
+		if err = streamWriter.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	return streamWriter.Flush()
+}
+
+// writeCategoriesSheet lists the GetExpensesReport totals, each currency
+// closed by its total, then the converted totals when there are some
+func (wb *workbook) writeCategoriesSheet(report models.ExpenseReport) error {
+	sheet := "Categories"
+
+	if err := wb.SetColWidth(sheet, "A", "C", 25); err != nil {
+		return err
+	}
+
+	n := 1
+	setRow := func(cells ...excelize.Cell) error {
+		for i, cell := range cells {
+			axis, _ := excelize.CoordinatesToCellName(i+1, n)
+			if err := wb.SetCellValue(sheet, axis, cell.Value); err != nil {
+				return err
+			}
+
+			if err := wb.SetCellStyle(sheet, axis, axis, cell.StyleID); err != nil {
+				return err
+			}
+		}
+
+		n++
+		return nil
+	}
+
+	header := func(currency string) []excelize.Cell {
+		return []excelize.Cell{
+			{StyleID: wb.headerStyle, Value: "Currency"},
+			{StyleID: wb.headerStyle, Value: "Category"},
+			{StyleID: wb.headerStyle, Value: "Total (" + currency + ")"}}
+	}
+
+	writeTotals := func(currency string, reports []models.CategoryTotalReport, total float64) error {
+		if err := setRow(header(currency)...); err != nil {
+			return err
+		}
+
+		for _, category := range reports {
+			amount, err := wb.amountCell(currency, &category.Total)
+			if err != nil {
+				return err
+			}
+
+			if err = setRow(excelize.Cell{StyleID: wb.dataStyle, Value: currency},
+				excelize.Cell{StyleID: wb.dataStyle, Value: category.Name}, amount); err != nil {
+				return err
+			}
+		}
+
+		amount, err := wb.amountCell(currency, &total)
+		if err != nil {
+			return err
+		}
+
+		if err = setRow(excelize.Cell{StyleID: wb.headerStyle, Value: currency},
+			excelize.Cell{StyleID: wb.headerStyle, Value: "Total"}, amount); err != nil {
+			return err
+		}
+
+		// a blank row between the currencies
+		n++
+		return nil
+	}
+
+	currencies := make([]string, 0, len(report.Reports))
+	for currency := range report.Reports {
+		currencies = append(currencies, currency)
+	}
+
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		reports := report.Reports[currency]
+		sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+
+		if err := writeTotals(currency, reports, report.Totals[currency]); err != nil {
+			return err
+		}
+	}
+
+	if report.Converted == nil {
+		return nil
+	}
+
+	converted := report.Converted
+	sort.Slice(converted.Reports, func(i, j int) bool { return converted.Reports[i].Name < converted.Reports[j].Name })
+
+	if err := writeTotals(converted.BaseCurrency, converted.Reports, converted.Total); err != nil {
+		return err
+	}
+
+	if converted.MissingRates > 0 {
+		return setRow(excelize.Cell{StyleID: wb.dataStyle,
+			Value: fmt.Sprintf("%d expenses without an exchange rate are not converted", converted.MissingRates)})
+	}
+
+	return nil
+}
+
+// monthTotals is a row of the workbook summary
+type monthTotals struct {
+	month    string
+	currency string
+	income   float64
+	expenses float64
+}
+
+// monthlyTotals sums the incomes and the expenses per month and currency, or
+// per month in baseCurrency when it is set
+func (api *API) monthlyTotals(expenseFilterQ, incomeFilterQ string, stms []interface{}, baseCurrency string) (months []monthTotals, err error) {
+	expenseAmountQ, incomeAmountQ := "e.amount", "e.amount"
+	expenseJoinQ, incomeJoinQ := "", ""
+	currencyQ := "t.currency"
+	args := stms
+
+	if baseCurrency != "" {
+		target := fmt.Sprintf("$%d", len(stms)+1)
+		expenseAmountQ, incomeAmountQ = convertedQ("e", "e.amount", target), convertedQ("e", "e.amount", target)
+		expenseJoinQ, incomeJoinQ = rateJoinQ("e", target), rateJoinQ("e", target)
+		currencyQ = target + "::TEXT"
+		args = append(append([]interface{}{}, stms...), baseCurrency)
+	}
+
+	q := `SELECT TO_CHAR(t.date, 'YYYY-MM'), ` + currencyQ + `, SUM(t.income), SUM(t.expenses) FROM (
+			SELECT e.date, e.currency, 0 AS income, ` + expenseAmountQ + ` AS expenses
+			FROM expenses e
+			JOIN products p ON e.product_id = p.id AND NOT p.deleted` + expenseJoinQ + `
+			WHERE NOT e.deleted` + expenseFilterQ + `
+			UNION ALL
+			SELECT e.date, e.currency, ` + incomeAmountQ + `, 0
+			FROM incomes e` + incomeJoinQ + `
+			WHERE NOT deleted` + incomeFilterQ + `
+		) t GROUP BY 1, 2 ORDER BY 1, 2`
+
+	log.Println(q)
+
+	rows, err := api.Db.Query(q, args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var month monthTotals
+		var income, expenses sql.NullFloat64
+
+		if err = rows.Scan(&month.month, &month.currency, &income, &expenses); err != nil {
+			return
+		}
+
+		month.income = roundAmount(income.Float64)
+		month.expenses = roundAmount(expenses.Float64)
+		months = append(months, month)
+	}
+
+	return months, rows.Err()
+}
+
+// writeSummarySheet lists the monthly totals and charts the incomes against
+// the expenses of each month
+func (wb *workbook) writeSummarySheet(months []monthTotals) error {
+	sheet := "Summary"
+
+	if err := wb.SetColWidth(sheet, "A", "E", 20); err != nil {
+		return err
+	}
+
+	header := []interface{}{"Month", "Currency", "Income", "Expenses", "Net"}
+	if err := wb.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+
+	if err := wb.SetCellStyle(sheet, "A1", "E1", wb.headerStyle); err != nil {
+		return err
+	}
+
+	for i, month := range months {
+		n := i + 2
+		row := []interface{}{month.month, month.currency, month.income, month.expenses, roundAmount(month.income - month.expenses)}
+
+		axis, _ := excelize.CoordinatesToCellName(1, n)
+		if err := wb.SetSheetRow(sheet, axis, &row); err != nil {
+			return err
+		}
+
+		style, err := wb.amountStyle(month.currency)
+		if err != nil {
+			return err
+		}
+
+		if err = wb.SetCellStyle(sheet, fmt.Sprintf("A%d", n), fmt.Sprintf("B%d", n), wb.dataStyle); err != nil {
+			return err
+		}
+
+		if err = wb.SetCellStyle(sheet, fmt.Sprintf("C%d", n), fmt.Sprintf("E%d", n), style); err != nil {
+			return err
+		}
+	}
+
+	// a chart of no rows would be an invalid range
+	if len(months) == 0 {
+		return nil
+	}
+
+	last := len(months) + 1
+	chart, err := json.Marshal(map[string]interface{}{
+		"type": "col",
+		"series": []map[string]string{{
+			"name":       sheet + "!$C$1",
+			"categories": fmt.Sprintf("%s!$A$2:$B$%d", sheet, last),
+			"values":     fmt.Sprintf("%s!$C$2:$C$%d", sheet, last),
+		}, {
+			"name":       sheet + "!$D$1",
+			"categories": fmt.Sprintf("%s!$A$2:$B$%d", sheet, last),
+			"values":     fmt.Sprintf("%s!$D$2:$D$%d", sheet, last),
+		}},
+		"title":  map[string]string{"name": "Income vs Expenses"},
+		"legend": map[string]string{"position": "bottom"},
+	})
+	if err != nil {
+		return err
+	}
+
+	return wb.AddChart(sheet, "G2", string(chart))
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gotest.tools/assert"
+)
+
+func TestGetWorkbookReport(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.Equal(t, nil, err)
+
+	api := NewAPI()
+	api.Db = db
+
+	var genericResp GenericResponse
+
+	mockID := "63eb226a-d612-412b-b8d4-a3e17b7d2226"
+	mockUserID := "63eb226a-d612-412b-b8d4-a3e17b7d2227"
+	payload := "{\"user\":{\"id\":\"" + mockUserID + "\", \"role\":\"CUSTOMER\"}}"
+
+	// invalid min date (400)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("GET", "?min_date=2021-13-01&max_date=2021-01-31", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetWorkbookReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-min-date", genericResp.Message)
+
+	// invalid date range (400)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	req, _ = http.NewRequest("GET", "?min_date=2021-02-01&max_date=2021-01-31", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetWorkbookReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid-date-range", genericResp.Message)
+
+	// err select currencies (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT code, name, minor_unit.*").WillReturnError(errors.New("err-currencies"))
+
+	req, _ = http.NewRequest("GET", "?min_date=2021-01-01&max_date=2021-01-31", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetWorkbookReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-currencies", genericResp.Message)
+
+	// err declare cursor (500)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	dbMock.ExpectQuery("SELECT base_currency.*").WithArgs(mockUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"base_currency"}).AddRow(nil))
+	dbMock.ExpectQuery("SELECT code, name, minor_unit.*").WillReturnRows(currencyRows())
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DECLARE export_cursor.*SELECT e.id.*").WillReturnError(errors.New("err-declare"))
+	dbMock.ExpectRollback()
+
+	req, _ = http.NewRequest("GET", "?min_date=2021-01-01&max_date=2021-01-31", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetWorkbookReport(c)
+
+	err = json.NewDecoder(w.Body).Decode(&genericResp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "err-declare", genericResp.Message)
+
+	// 200 converted into the requested base currency
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+
+	date := time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery("SELECT code, name, minor_unit.*").WillReturnRows(currencyRows())
+	expectExportCursor(dbMock, "SELECT e.id.*LEFT JOIN LATERAL.*ORDER BY e.date, e.created_at$",
+		sqlmock.NewRows([]string{"id", "category_id", "category_name", "category_description", "product_id",
+			"product_name", "product_description", "date", "currency", "amount",
+			"user_id", "created_at", "updated_at", "account_id", "tags", "converted_amount"}).
+			AddRow(mockID, mockID, "Food", "", mockID,
+				"Coffee", "", date, "IDR", 25000,
+				mockUserID, time.Now(), time.Now(), nil, "{work}", 1.79),
+		mockUserID, sqlmock.AnyArg(), sqlmock.AnyArg(), "USD")
+	expectExportCursor(dbMock, "SELECT id.*LEFT JOIN LATERAL.*ORDER BY date, created_at$",
+		sqlmock.NewRows([]string{"id", "name", "description", "user_id", "date", "currency", "amount",
+			"created_at", "updated_at", "account_id", "tags", "converted_amount"}).
+			AddRow(mockID, "Salary", "January", mockUserID, date, "USD", 1500.5,
+				time.Now(), time.Now(), nil, nil, 1500.5),
+		mockUserID, sqlmock.AnyArg(), sqlmock.AnyArg(), "USD")
+	dbMock.ExpectQuery("SELECT e.currency, SUM.*").WithArgs(mockUserID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "total"}).AddRow("IDR", 25000))
+	dbMock.ExpectQuery("SELECT e.currency, c.id.*").WithArgs(mockUserID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "id", "name", "total"}).AddRow("IDR", mockID, "Food", 25000))
+	dbMock.ExpectQuery("SELECT c.id, c.name, SUM.*").WithArgs(mockUserID, sqlmock.AnyArg(), sqlmock.AnyArg(), "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "total", "missing"}).AddRow(mockID, "Food", 1.79, 0))
+	dbMock.ExpectQuery("SELECT TO_CHAR.*").WithArgs(mockUserID, sqlmock.AnyArg(), sqlmock.AnyArg(), "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"month", "currency", "income", "expenses"}).AddRow("2021-01", "USD", 1500.5, 1.79))
+
+	req, _ = http.NewRequest("GET", "?min_date=2021-01-01&max_date=2021-01-31&base_currency=usd", nil)
+	c.Request = req
+	c.Request.Header.Set("payload", payload)
+	api.GetWorkbookReport(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "attachment;filename=\"report_workbook_2021-01-01_2021-01-31.xlsx\"", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, nil, dbMock.ExpectationsWereMet())
+
+	body := w.Body.Bytes()
+	f, err := excelize.OpenReader(bytes.NewReader(body))
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []string{"Expenses", "Incomes", "Categories", "Summary"}, f.GetSheetList())
+
+	rows, err := f.GetRows("Expenses")
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []string{"Date", "Category", "Product", "Currency", "Amount", "Amount (USD)", "Tags", "ID"}, rows[0])
+	assert.DeepEqual(t, []string{"2021-01-05", "Food", "Coffee", "IDR", "25000", "1.79", "work", mockID}, rows[1])
+
+	categories, err := f.GetRows("Categories")
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []string{"IDR", "Total", "25000"}, categories[2])
+	assert.DeepEqual(t, []string{"USD", "Food", "1.79"}, categories[5])
+
+	summary, err := f.GetRows("Summary")
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []string{"Month", "Currency", "Income", "Expenses", "Net"}, summary[0])
+	assert.DeepEqual(t, []string{"2021-01", "USD", "1500.5", "1.79", "1498.71"}, summary[1])
+
+	// the amounts are number cells in a format of their currency
+	files := map[string][]byte{}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.Equal(t, nil, err)
+
+	for _, file := range archive.File {
+		content, _ := file.Open()
+		files[file.Name], _ = ioutil.ReadAll(content)
+		content.Close()
+	}
+
+	assert.Equal(t, true, regexp.MustCompile(`<c r="E2" s="\d+"><v>25000</v></c>`).Match(files["xl/worksheets/sheet1.xml"]))
+	assert.Equal(t, true, bytes.Contains(files["xl/styles.xml"], []byte(`formatCode="&#34;Rp&#34; #,##0.00"`)))
+	assert.Equal(t, true, bytes.Contains(files["xl/styles.xml"], []byte(`formatCode="&#34;$&#34; #,##0.00"`)))
+
+	_, chart := files["xl/charts/chart1.xml"]
+	assert.Equal(t, true, chart)
+}
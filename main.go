@@ -2,6 +2,7 @@ package main
 
 import (
 	"budgetingapi/routers"
+	"budgetingapi/scheduler"
 	"context"
 	"log"
 	"net/http"
@@ -14,7 +15,7 @@ import (
 func main() {
 	log.SetFlags(log.LstdFlags | log.LUTC | log.Lshortfile)
 	log.Println(os.Environ())
-	router := routers.Route()
+	router, api := routers.Route()
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8000"
@@ -29,9 +30,26 @@ func main() {
 		log.Println(srv.ListenAndServe())
 	}()
 
+	recurringInterval, err := time.ParseDuration(os.Getenv("RECURRING_INTERVAL"))
+	if err != nil {
+		recurringInterval = time.Hour
+	}
+
+	recurring := scheduler.New(recurringInterval, func(now time.Time) {
+		total, err := api.MaterializeRecurring(now)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		log.Printf("materialized %d recurring transactions", total)
+	})
+	recurring.Start()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	recurring.Stop()
 	log.Println(srv.Shutdown(context.Background()))
 }
@@ -2,36 +2,208 @@ package middlewares
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"time"
+
+	"budgetingapi/tokens"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	// CSRFCookie is readable by the web app, which sends it back in CSRFHeader
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Auth takes the token from the Authorization header or the "token" cookie,
+// AUTH_TOKEN_PRECEDENCE=cookie makes the cookie win when a request has both.
+// The requests authenticated by the cookie must double-submit the CSRF token
+// unless they are safe. With AUTH_MODE=stateless the token is verified against
+// the keyring of JWT_KEYS instead of being looked up.
 func Auth(redis *redis.Client) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token, _ := c.Cookie("token")
+	cookieFirst := strings.ToLower(os.Getenv("AUTH_TOKEN_PRECEDENCE")) == "cookie"
+
+	validate := func(token string) (string, error) {
 		redisPayload, err := ValidateToken(token, redis)
+		if err == nil {
+			touchSession(redis, redisPayload)
+		}
+
+		return redisPayload, err
+	}
+
+	if tokens.Stateless() {
+		ring, err := tokens.LoadKeyring()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		validate = func(token string) (string, error) {
+			return VerifyToken(token, ring, redis)
+		}
+	}
+
+	return func(c *gin.Context) {
+		token, fromCookie := requestToken(c, cookieFirst)
+		redisPayload, err := validate(token)
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
 			c.Abort()
 			return
 		}
+
+		if fromCookie {
+			if err := checkCSRF(c); err != nil {
+				log.Println(err)
+				c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Request.Header.Set("payload", redisPayload)
+		// logout drops the session of this token
+		c.Set("token", token)
 		c.Next()
 	}
 }
+
+// touchSession sets the last_seen of the session hash the controllers keep,
+// failing at it is no reason to turn the request down
+func touchSession(redis *redis.Client, redisPayload string) {
+	var payload struct {
+		SessionId string `json:"session-id"`
+	}
+
+	if err := json.Unmarshal([]byte(redisPayload), &payload); err != nil || payload.SessionId == "" {
+		return
+	}
+
+	ctx := context.Background()
+	key := "session:" + payload.SessionId
+
+	added, err := redis.HSet(ctx, key, "last_seen", time.Now().UTC().Format(time.RFC3339)).Result()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// the field is only new when the session was gone, do not bring it back
+	// without its expiry
+	if added > 0 {
+		redis.Del(ctx, key)
+	}
+}
+
+// requestToken returns the token and whether it came from the cookie
+func requestToken(c *gin.Context, cookieFirst bool) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		header = ""
+	}
+
+	cookie, _ := c.Cookie("token")
+
+	if cookie != "" && (cookieFirst || header == "") {
+		return cookie, true
+	}
+
+	return header, false
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// checkCSRF compares the header against the cookie, a safe request without
+// the cookie gets one for the next requests
+func checkCSRF(c *gin.Context) error {
+	cookie, _ := c.Cookie(CSRFCookie)
+
+	if safeMethod(c.Request.Method) {
+		if cookie == "" {
+			return SetCSRFCookie(c)
+		}
+
+		return nil
+	}
+
+	header := c.GetHeader(CSRFHeader)
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		return errors.New("invalid-csrf-token")
+	}
+
+	return nil
+}
+
+// SetCSRFCookie issues a new CSRF token, it lasts as long as the refresh
+// token of the session and each refresh issues another one
+func SetCSRFCookie(c *gin.Context) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	c.SetCookie(CSRFCookie, fmt.Sprintf("%x", b), int(tokens.RefreshTTL.Seconds()), "/", "", c.Request.TLS != nil, false)
+	return nil
+}
+
+// VerifyToken checks the signature and the expiry of a stateless token, redis
+// only tells whether its session was revoked. The payload is built from the
+// claims in the shape the controllers parse.
+func VerifyToken(authorizationHeader string, ring *tokens.Keyring, redis *redis.Client) (string, error) {
+	if !strings.HasPrefix(authorizationHeader, "Bearer ") {
+		return "", errors.New("invalid-token")
+	}
+
+	claims, err := ring.Verify(strings.TrimPrefix(authorizationHeader, "Bearer "))
+	if err != nil {
+		return "", err
+	}
+
+	sessionId, _ := claims["sid"].(string)
+	if sessionId == "" {
+		return "", errors.New("missing-session-id")
+	}
+
+	revoked, err := redis.Exists(context.Background(), tokens.DenylistKey(sessionId)).Result()
+	if err != nil {
+		return "", err
+	}
+
+	if revoked > 0 {
+		return "", errors.New("revoked-session")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"user": claims["user"], "session-id": sessionId})
+
+	return string(payload), err
+}
+
 func ValidateToken(authorizationHeader string, redis *redis.Client) (string, error) {
 	if !strings.Contains(authorizationHeader, "Bearer") {
 		return "", errors.New("invalid-token")
 	}
 	tokenString := strings.Replace(authorizationHeader, "Bearer ", "", -1)
 
-	redisPayload, err := redis.Get(context.Background(), tokenString).Result()
+	// only an access token, a refresh token would outlive it by days
+	redisPayload, err := redis.Get(context.Background(), tokens.AccessKey(tokenString)).Result()
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"budgetingapi/tokens"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redismock/v8"
+	"gotest.tools/assert"
+)
+
+func TestAuth(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	redisDB, redisMock := redismock.NewClientMock()
+	payload := "{\"user\":{\"id\":\"63eb226a-d612-412b-b8d4-a3e17b7d2227\"}}"
+
+	serve := func(method string, headers map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		router := gin.New()
+		handler := func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"payload": c.GetHeader("payload"), "token": c.GetString("token")})
+		}
+		router.Handle(method, "/", Auth(redisDB), handler)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tokenCookie := &http.Cookie{Name: "token", Value: "Bearer cookie-token"}
+	csrfCookie := &http.Cookie{Name: CSRFCookie, Value: "csrf"}
+
+	// no token (401)
+	w := serve("GET", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// unknown token (401)
+	redisMock.ExpectGet("access:header-token").RedisNil()
+	w = serve("GET", map[string]string{"Authorization": "Bearer header-token"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// a refresh token is only looked up as an access token (401)
+	redisMock.ExpectGet("access:refresh-token").RedisNil()
+	w = serve("GET", map[string]string{"Authorization": "Bearer refresh-token"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// bearer header, no csrf needed (200)
+	redisMock.ExpectGet("access:header-token").SetVal(payload)
+	w = serve("POST", map[string]string{"Authorization": "Bearer header-token"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), "Bearer header-token"))
+
+	// the header wins over the cookie by default (200)
+	redisMock.ExpectGet("access:header-token").SetVal(payload)
+	w = serve("GET", map[string]string{"Authorization": "Bearer header-token"}, tokenCookie)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("Set-Cookie"))
+
+	// the last seen of the session is bumped (200)
+	sessionPayload := "{\"session-id\":\"test-session\"}"
+	redisMock.ExpectGet("access:header-token").SetVal(sessionPayload)
+	redisMock.Regexp().ExpectHSet("^session:test-session$", "last_seen", "^20").SetVal(0)
+	w = serve("GET", map[string]string{"Authorization": "Bearer header-token"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a session gone meanwhile is not brought back (200)
+	redisMock.ExpectGet("access:header-token").SetVal(sessionPayload)
+	redisMock.Regexp().ExpectHSet("^session:test-session$", "last_seen", "^20").SetVal(1)
+	redisMock.ExpectDel("session:test-session").SetVal(1)
+	w = serve("GET", map[string]string{"Authorization": "Bearer header-token"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// cookie on a safe request, a csrf cookie is issued (200)
+	redisMock.ExpectGet("access:cookie-token").SetVal(payload)
+	w = serve("GET", nil, tokenCookie)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, strings.HasPrefix(w.Header().Get("Set-Cookie"), CSRFCookie+"="))
+	assert.Equal(t, true, strings.Contains(w.Header().Get("Set-Cookie"), "Max-Age=604800"))
+
+	// cookie without the csrf header (403)
+	redisMock.ExpectGet("access:cookie-token").SetVal(payload)
+	w = serve("POST", nil, tokenCookie, csrfCookie)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), "invalid-csrf-token"))
+
+	// cookie with a csrf header not matching (403)
+	redisMock.ExpectGet("access:cookie-token").SetVal(payload)
+	w = serve("DELETE", map[string]string{CSRFHeader: "other"}, tokenCookie, csrfCookie)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// cookie with the double-submitted csrf token (200)
+	redisMock.ExpectGet("access:cookie-token").SetVal(payload)
+	w = serve("POST", map[string]string{CSRFHeader: "csrf"}, tokenCookie, csrfCookie)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the cookie wins with AUTH_TOKEN_PRECEDENCE=cookie, csrf included (403)
+	os.Setenv("AUTH_TOKEN_PRECEDENCE", "cookie")
+	defer os.Unsetenv("AUTH_TOKEN_PRECEDENCE")
+
+	redisMock.ExpectGet("access:cookie-token").SetVal(payload)
+	w = serve("POST", map[string]string{"Authorization": "Bearer header-token"}, tokenCookie)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+}
+
+func TestAuthStateless(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	keys := "k1:HS256:" + base64.StdEncoding.EncodeToString([]byte("secret"))
+	os.Setenv("AUTH_MODE", "stateless")
+	os.Setenv("JWT_KEYS", keys)
+	defer os.Unsetenv("AUTH_MODE")
+	defer os.Unsetenv("JWT_KEYS")
+
+	ring, err := tokens.ParseKeyring(keys, "")
+	assert.Equal(t, nil, err)
+
+	redisDB, redisMock := redismock.NewClientMock()
+	router := gin.New()
+	router.GET("/", Auth(redisDB), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"payload": c.GetHeader("payload")})
+	})
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := map[string]interface{}{"id": "63eb226a-d612-412b-b8d4-a3e17b7d2227"}
+	token, err := ring.Sign(jwt.MapClaims{"sub": user["id"], "sid": "test-session", "user": user}, time.Minute)
+	assert.Equal(t, nil, err)
+
+	// bad signature (401)
+	w := serve(token + "x")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// expired (401)
+	expired, _ := ring.Sign(jwt.MapClaims{"sid": "test-session", "user": user}, -time.Minute)
+	w = serve(expired)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// without session (401)
+	noSession, _ := ring.Sign(jwt.MapClaims{"user": user}, time.Minute)
+	w = serve(noSession)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// revoked session (401)
+	redisMock.ExpectExists("denylist:test-session").SetVal(1)
+	w = serve(token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// err denylist (401)
+	redisMock.ExpectExists("denylist:test-session").SetErr(errors.New("err-exists"))
+	w = serve(token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 200, the payload comes from the claims
+	redisMock.ExpectExists("denylist:test-session").SetVal(0)
+	w = serve(token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Payload string `json:"payload"`
+	}
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"session-id":"test-session","user":{"id":"63eb226a-d612-412b-b8d4-a3e17b7d2227"}}`, resp.Payload)
+	assert.Equal(t, nil, redisMock.ExpectationsWereMet())
+}
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS budgets;
+
+CREATE TABLE budgets (
+   id UUID NOT NULL default gen_random_uuid(),
+   user_id UUID NOT NULL,
+   category_id UUID NOT NULL,
+   "period" DATE NOT NULL CHECK (EXTRACT(DAY FROM "period") = 1),
+   currency VARCHAR(3) NOT NULL REFERENCES currencies(code),
+   amount DECIMAL(12,2) NOT NULL CHECK (amount >= 0),
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL,
+   deleted BOOLEAN NOT NULL default FALSE,
+   primary key(id)
+);
+
+CREATE UNIQUE INDEX budgets_user_category_period_idx ON budgets(user_id, category_id, "period") WHERE NOT deleted;
+CREATE INDEX budgets_category_idx ON budgets(category_id);
@@ -0,0 +1,4 @@
+ALTER TABLE budgets
+ADD rollover BOOLEAN NOT NULL default FALSE,
+ADD carry_out DECIMAL(12,2) NULL,
+ADD closed_at TIMESTAMP NULL;
@@ -0,0 +1,33 @@
+DROP TABLE IF EXISTS recurring_transactions;
+
+CREATE TABLE recurring_transactions (
+   id UUID NOT NULL default gen_random_uuid(),
+   user_id UUID NOT NULL,
+   "type" VARCHAR(7) NOT NULL CHECK ("type" IN ('EXPENSE', 'INCOME')),
+   product_id UUID NULL,
+   name TEXT NULL,
+   description TEXT NULL,
+   currency VARCHAR(3) NOT NULL REFERENCES currencies(code),
+   amount DECIMAL(12,2) NOT NULL,
+   frequency VARCHAR(7) NOT NULL CHECK (frequency IN ('DAILY', 'WEEKLY', 'MONTHLY', 'YEARLY')),
+   "interval" INT NOT NULL default 1 CHECK ("interval" > 0),
+   start_date DATE NOT NULL,
+   end_date DATE NULL,
+   "count" INT NULL CHECK ("count" > 0),
+   generated INT NOT NULL default 0,
+   next_date DATE NULL,
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL,
+   deleted BOOLEAN NOT NULL default FALSE,
+   primary key(id)
+);
+
+CREATE INDEX recurring_transactions_user_idx ON recurring_transactions(user_id);
+CREATE INDEX recurring_transactions_next_date_idx ON recurring_transactions(next_date) WHERE NOT deleted;
+
+ALTER TABLE expenses ADD recurring_id UUID NULL;
+ALTER TABLE incomes ADD recurring_id UUID NULL;
+
+-- one occurrence per schedule and date, materialising twice is a no-op
+CREATE UNIQUE INDEX expenses_recurring_date_idx ON expenses(recurring_id, "date") WHERE recurring_id IS NOT NULL;
+CREATE UNIQUE INDEX incomes_recurring_date_idx ON incomes(recurring_id, "date") WHERE recurring_id IS NOT NULL;
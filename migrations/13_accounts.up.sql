@@ -0,0 +1,22 @@
+DROP TABLE IF EXISTS accounts;
+
+CREATE TABLE accounts (
+   id UUID NOT NULL default gen_random_uuid(),
+   user_id UUID NOT NULL,
+   name TEXT NOT NULL,
+   "type" VARCHAR(11) NOT NULL CHECK ("type" IN ('BANK', 'CASH', 'CREDIT_CARD', 'E_WALLET', 'SAVINGS', 'INVESTMENT', 'LOAN', 'OTHER')),
+   currency VARCHAR(3) NOT NULL REFERENCES currencies(code),
+   opening_balance DECIMAL(12,2) NOT NULL default 0,
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL,
+   deleted BOOLEAN NOT NULL default FALSE,
+   primary key(id)
+);
+
+CREATE INDEX accounts_user_idx ON accounts(user_id);
+
+ALTER TABLE expenses ADD account_id UUID NULL REFERENCES accounts(id);
+ALTER TABLE incomes ADD account_id UUID NULL REFERENCES accounts(id);
+
+CREATE INDEX expenses_account_idx ON expenses(account_id) WHERE account_id IS NOT NULL;
+CREATE INDEX incomes_account_idx ON incomes(account_id) WHERE account_id IS NOT NULL;
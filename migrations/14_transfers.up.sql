@@ -0,0 +1,23 @@
+DROP TABLE IF EXISTS transfers;
+
+-- moving money between two accounts is neither an income nor an expense,
+-- amount is in the currency of the source account
+CREATE TABLE transfers (
+   id UUID NOT NULL default gen_random_uuid(),
+   user_id UUID NOT NULL,
+   from_account_id UUID NOT NULL REFERENCES accounts(id),
+   to_account_id UUID NOT NULL REFERENCES accounts(id) CHECK (to_account_id <> from_account_id),
+   "date" DATE NOT NULL,
+   description TEXT NULL,
+   currency VARCHAR(3) NOT NULL REFERENCES currencies(code),
+   amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+   rate DECIMAL(18,8) NULL CHECK (rate > 0),
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL,
+   deleted BOOLEAN NOT NULL default FALSE,
+   primary key(id)
+);
+
+CREATE INDEX transfers_user_idx ON transfers(user_id);
+CREATE INDEX transfers_from_account_idx ON transfers(from_account_id);
+CREATE INDEX transfers_to_account_idx ON transfers(to_account_id);
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS expense_splits;
+
+-- the lines of an expense covering several products, they sum up to the
+-- expense amount and replace its product in the category reports
+CREATE TABLE expense_splits (
+   id UUID NOT NULL default gen_random_uuid(),
+   expense_id UUID NOT NULL REFERENCES expenses(id),
+   product_id UUID NOT NULL,
+   amount DECIMAL(12,2) NOT NULL,
+   "position" INT NOT NULL,
+   primary key(id)
+);
+
+CREATE INDEX expense_splits_expense_idx ON expense_splits(expense_id);
+CREATE INDEX expense_splits_product_idx ON expense_splits(product_id);
@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS expense_tags;
+DROP TABLE IF EXISTS income_tags;
+DROP TABLE IF EXISTS tags;
+
+-- free-form labels across categories, names are stored lower case
+CREATE TABLE tags (
+   id UUID NOT NULL default gen_random_uuid(),
+   user_id UUID NOT NULL,
+   name VARCHAR(50) NOT NULL,
+   created_at TIMESTAMP NOT NULL,
+   primary key(id)
+);
+
+CREATE UNIQUE INDEX tags_user_name_idx ON tags(user_id, name);
+
+CREATE TABLE expense_tags (
+   expense_id UUID NOT NULL REFERENCES expenses(id),
+   tag_id UUID NOT NULL REFERENCES tags(id),
+   primary key(expense_id, tag_id)
+);
+
+CREATE TABLE income_tags (
+   income_id UUID NOT NULL REFERENCES incomes(id),
+   tag_id UUID NOT NULL REFERENCES tags(id),
+   primary key(income_id, tag_id)
+);
+
+CREATE INDEX expense_tags_tag_idx ON expense_tags(tag_id);
+CREATE INDEX income_tags_tag_idx ON income_tags(tag_id);
@@ -0,0 +1,7 @@
+-- the bank references of the transactions imported from statements, a
+-- transaction is imported once per account
+ALTER TABLE expenses ADD external_ref VARCHAR(255) NULL;
+ALTER TABLE incomes ADD external_ref VARCHAR(255) NULL;
+
+CREATE UNIQUE INDEX expenses_external_ref_idx ON expenses(account_id, external_ref) WHERE external_ref IS NOT NULL;
+CREATE UNIQUE INDEX incomes_external_ref_idx ON incomes(account_id, external_ref) WHERE external_ref IS NOT NULL;
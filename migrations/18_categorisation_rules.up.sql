@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS categorisation_rules;
+
+-- the rules picking the product of the expenses saved without one, tried by
+-- ascending priority, a rule matches when all its set conditions do
+CREATE TABLE categorisation_rules (
+   id UUID NOT NULL default gen_random_uuid(),
+   user_id UUID NOT NULL,
+   product_id UUID NOT NULL REFERENCES products(id),
+   priority INT NOT NULL default 0,
+   payee_contains TEXT NOT NULL default '',
+   payee_regex TEXT NOT NULL default '',
+   min_amount DECIMAL(12,2) NULL,
+   max_amount DECIMAL(12,2) NULL,
+   currency VARCHAR(3) NULL REFERENCES currencies(code),
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL,
+   deleted BOOLEAN NOT NULL default FALSE,
+   primary key(id)
+);
+
+CREATE INDEX categorisation_rules_user_idx ON categorisation_rules(user_id, priority);
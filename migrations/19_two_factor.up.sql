@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS recovery_codes;
+
+-- the secret is kept while the enrolment waits for its first code, the
+-- login only asks for one once it is enabled
+ALTER TABLE users
+ADD totp_secret TEXT NULL,
+ADD totp_enabled BOOLEAN NOT NULL default FALSE;
+
+-- one-time codes for a lost phone, hashed like the passwords
+CREATE TABLE recovery_codes (
+   id UUID NOT NULL default gen_random_uuid(),
+   user_id UUID NOT NULL REFERENCES users(id),
+   code TEXT NOT NULL,
+   used_at TIMESTAMP NULL,
+   created_at TIMESTAMP NOT NULL,
+   primary key(id)
+);
+
+CREATE INDEX recovery_codes_user_idx ON recovery_codes(user_id);
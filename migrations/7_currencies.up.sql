@@ -0,0 +1,27 @@
+DROP TABLE IF EXISTS currencies CASCADE;
+
+-- amounts are stored as DECIMAL(12,2), so a currency cannot have more than 2 minor units
+CREATE TABLE currencies (
+   code VARCHAR(3) NOT NULL,
+   name TEXT NOT NULL,
+   minor_unit SMALLINT NOT NULL CHECK (minor_unit BETWEEN 0 AND 2),
+   symbol TEXT NOT NULL,
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL,
+   primary key(code)
+);
+
+INSERT INTO currencies (code, name, minor_unit, symbol, created_at, updated_at) VALUES
+('IDR','Indonesian Rupiah', 2, 'Rp', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('USD','US Dollar', 2, '$', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('EUR','Euro', 2, '€', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('SGD','Singapore Dollar', 2, 'S$', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('JPY','Japanese Yen', 0, '¥', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('GBP','Pound Sterling', 2, '£', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('AUD','Australian Dollar', 2, 'A$', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('MYR','Malaysian Ringgit', 2, 'RM', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('CNY','Yuan Renminbi', 2, '¥', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+('KRW','Won', 0, '₩', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+
+ALTER TABLE expenses ADD FOREIGN KEY (currency) REFERENCES currencies(code);
+ALTER TABLE incomes ADD FOREIGN KEY (currency) REFERENCES currencies(code);
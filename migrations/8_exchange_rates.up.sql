@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS exchange_rates;
+
+CREATE TABLE exchange_rates (
+   "date" DATE NOT NULL,
+   from_currency VARCHAR(3) NOT NULL REFERENCES currencies(code),
+   to_currency VARCHAR(3) NOT NULL REFERENCES currencies(code),
+   rate DECIMAL(20,10) NOT NULL CHECK (rate > 0),
+   created_at TIMESTAMP NOT NULL,
+   updated_at TIMESTAMP NOT NULL,
+   primary key("date", from_currency, to_currency)
+);
+
+CREATE INDEX exchange_rates_pair_idx ON exchange_rates(from_currency, to_currency, "date");
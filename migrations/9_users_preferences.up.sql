@@ -0,0 +1,3 @@
+ALTER TABLE users
+ADD base_currency VARCHAR(3) NULL REFERENCES currencies(code),
+ADD locale VARCHAR(35) NULL;
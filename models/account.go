@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+type AccountList struct {
+	Accounts []Account `json:"accounts"`
+	Page     int       `json:"page"`
+	Limit    int       `json:"limit"`
+	Total    int32     `json:"total"`
+}
+
+// Account is where the money of an expense or income came from or went to,
+// a bank account, a cash wallet, a credit card...
+type Account struct {
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Id             string    `json:"id"`
+	UserId         string    `json:"user_id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	Currency       string    `json:"currency"`
+	OpeningBalance float64   `json:"opening_balance"`
+}
+
+type UpsertAccountRequest struct {
+	Data []Account `json:"data"`
+}
+
+type AccountType string
+
+const (
+	BankAccount       AccountType = "BANK"
+	CashAccount       AccountType = "CASH"
+	CreditCardAccount AccountType = "CREDIT_CARD"
+	EWalletAccount    AccountType = "E_WALLET"
+	SavingsAccount    AccountType = "SAVINGS"
+	InvestmentAccount AccountType = "INVESTMENT"
+	LoanAccount       AccountType = "LOAN"
+	OtherAccount      AccountType = "OTHER"
+)
+
+// AccountBalance amounts are in the account currency, transactions in other
+// currencies are converted and counted in MissingRates when no rate is known.
+// Balance is OpeningBalance plus Incomes and TransfersIn minus Expenses and
+// TransfersOut.
+type AccountBalance struct {
+	AccountId      string  `json:"account_id"`
+	UserId         string  `json:"user_id"`
+	Name           string  `json:"name"`
+	Type           string  `json:"type"`
+	Currency       string  `json:"currency"`
+	OpeningBalance float64 `json:"opening_balance"`
+	Incomes        float64 `json:"incomes"`
+	Expenses       float64 `json:"expenses"`
+	TransfersIn    float64 `json:"transfers_in"`
+	TransfersOut   float64 `json:"transfers_out"`
+	Balance        float64 `json:"balance"`
+	MissingRates   int     `json:"missing_rates"`
+}
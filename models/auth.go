@@ -6,13 +6,19 @@ type AuthRequest struct {
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	User         `json:"user"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type RedisPayload struct {
 	User         `json:"user"`
 	RefreshToken string `json:"refresh-token"`
+	SessionId    string `json:"session-id"`
 }
 
 type PasswordReset struct {
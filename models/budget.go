@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+type BudgetList struct {
+	Budgets []Budget `json:"budgets"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	Total   int32    `json:"total"`
+}
+
+// Budget is the planned spending of a category for a month, Period is yyyy-mm.
+// With Rollover the unspent (or overspent) amount carries into the next month.
+type Budget struct {
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ClosedAt     *time.Time `json:"closed_at"`
+	Id           string     `json:"id"`
+	UserId       string     `json:"user_id"`
+	CategoryId   string     `json:"category_id"`
+	CategoryName string     `json:"category_name"`
+	Period       string     `json:"period"`
+	Currency     string     `json:"currency"`
+	Amount       float64    `json:"amount"`
+	Rollover     bool       `json:"rollover"`
+}
+
+type BudgetFilter struct {
+	MinPeriod string `json:"min_period"`
+	MaxPeriod string `json:"max_period"`
+	Budget    `json:"budget"`
+}
+
+type UpsertBudgetRequest struct {
+	Data []Budget `json:"data"`
+}
+
+type CloseBudgetRequest struct {
+	Period string `json:"period"`
+	UserId string `json:"user_id"`
+}
+
+type BudgetStatusReport struct {
+	Period   string         `json:"period"`
+	Statuses []BudgetStatus `json:"statuses"`
+}
+
+// BudgetStatus amounts are in the budget currency, expenses in other
+// currencies are converted and counted in MissingRates when no rate is known.
+// Available is Planned plus CarryIn minus Spent, frozen once the month is closed.
+type BudgetStatus struct {
+	BudgetId     string  `json:"budget_id"`
+	UserId       string  `json:"user_id"`
+	CategoryId   string  `json:"category_id"`
+	CategoryName string  `json:"category_name"`
+	Currency     string  `json:"currency"`
+	Planned      float64 `json:"planned"`
+	Spent        float64 `json:"spent"`
+	Remaining    float64 `json:"remaining"`
+	Percent      float64 `json:"percent"`
+	CarryIn      float64 `json:"carry_in"`
+	Available    float64 `json:"available"`
+	Rollover     bool    `json:"rollover"`
+	Closed       bool    `json:"closed"`
+	MissingRates int     `json:"missing_rates"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// CashflowReport has a bucket for each interval between the dates, the empty
+// ones included
+type CashflowReport struct {
+	Interval string           `json:"interval"`
+	Buckets  []CashflowBucket `json:"buckets"`
+}
+
+// CashflowBucket totals are keyed by currency code
+type CashflowBucket struct {
+	Start  string                    `json:"start"`
+	Totals map[string]CashflowTotals `json:"totals"`
+}
+
+type CashflowTotals struct {
+	Income  float64 `json:"income"`
+	Expense float64 `json:"expense"`
+	Net     float64 `json:"net"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type CurrencyList struct {
+	Currencies []Currency `json:"currencies"`
+}
+
+type Currency struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	MinorUnit int       `json:"minor_unit"`
+	Symbol    string    `json:"symbol"`
+}
+
+type UpsertCurrencyRequest struct {
+	Data []Currency `json:"data"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type ExchangeRateList struct {
+	ExchangeRates []ExchangeRate `json:"exchange_rates"`
+	Page          int            `json:"page"`
+	Limit         int            `json:"limit"`
+	Total         int32          `json:"total"`
+}
+
+type ExchangeRate struct {
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Date         string    `json:"date"`
+	FromCurrency string    `json:"from_currency"`
+	ToCurrency   string    `json:"to_currency"`
+	Rate         float64   `json:"rate"`
+}
+
+type ExchangeRateFilter struct {
+	ExchangeRate `json:"exchange_rate"`
+	MinDate      string `json:"min_date"`
+	MaxDate      string `json:"max_date"`
+}
+
+type UpsertExchangeRateRequest struct {
+	Data []ExchangeRate `json:"data"`
+}
+
+// ConvertedReport holds totals converted into BaseCurrency using the rate
+// effective on each transaction date
+type ConvertedReport struct {
+	BaseCurrency string                `json:"base_currency"`
+	Total        float64               `json:"total"`
+	Reports      []CategoryTotalReport `json:"reports,omitempty"`
+	MissingRates int                   `json:"missing_rates"`
+}
@@ -15,29 +15,47 @@ type ExpenseFilter struct {
 	Expense   `json:"expense"`
 	MinAmount float64 `json:"min_amount"`
 	MaxAmount float64 `json:"max_amount"`
+	TagsMatch string  `json:"tags_match"`
 }
 
 type Expense struct {
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
-	Id                  string    `json:"id"`
-	UserId              string    `json:"user_id"`
-	CategoryId          string    `json:"category_id"`
-	CategoryName        string    `json:"category_name"`
-	CategoryDescription string    `json:"category_description"`
-	ProductId           string    `json:"product_id"`
-	ProductName         string    `json:"product_name"`
-	ProductDescription  string    `json:"product_description"`
-	Date                string    `json:"date"`
-	Currency            string    `json:"currency"`
-	Amount              float64   `json:"amount"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	Id                  string         `json:"id"`
+	UserId              string         `json:"user_id"`
+	AccountId           string         `json:"account_id"`
+	CategoryId          string         `json:"category_id"`
+	CategoryName        string         `json:"category_name"`
+	CategoryDescription string         `json:"category_description"`
+	ProductId           string         `json:"product_id"`
+	ProductName         string         `json:"product_name"`
+	ProductDescription  string         `json:"product_description"`
+	Date                string         `json:"date"`
+	Currency            string         `json:"currency"`
+	Amount              float64        `json:"amount"`
+	ConvertedAmount     *float64       `json:"converted_amount,omitempty"`
+	Splits              []ExpenseSplit `json:"splits,omitempty"`
+	Tags                []string       `json:"tags"`
+	// Payee is matched by the categorisation rules, it is not saved
+	Payee  string `json:"payee,omitempty"`
+	RuleId string `json:"rule_id,omitempty"`
 }
 
+// ExpenseSplit is a line of an expense covering several products, the lines
+// of an expense sum up to its amount
+type ExpenseSplit struct {
+	ProductId    string  `json:"product_id"`
+	ProductName  string  `json:"product_name"`
+	CategoryId   string  `json:"category_id"`
+	CategoryName string  `json:"category_name"`
+	Amount       float64 `json:"amount"`
+}
+
+// ExpenseReport is keyed by currency code
 type ExpenseReport struct {
-	ReportsIdr []CategoryTotalReport `json:"reports_idr"`
-	ReportsUsd []CategoryTotalReport `json:"reports_usd"`
-	TotalIdr   float64               `json:"total_idr"`
-	TotalUsd   float64               `json:"total_usd"`
+	Reports   map[string][]CategoryTotalReport `json:"reports"`
+	Totals    map[string]float64               `json:"totals"`
+	Converted *ConvertedReport                 `json:"converted,omitempty"`
 }
 
 type CategoryTotalReport struct {
@@ -46,6 +64,34 @@ type CategoryTotalReport struct {
 	Total float64 `json:"total"`
 }
 
+// ProductReport breaks the categories down into their products, keyed by
+// currency code. The shares are percentages within the currency.
+type ProductReport struct {
+	Reports map[string][]CategoryProductsReport `json:"reports"`
+	Totals  map[string]float64                  `json:"totals"`
+}
+
+type CategoryProductsReport struct {
+	Id       string               `json:"id"`
+	Name     string               `json:"name"`
+	Total    float64              `json:"total"`
+	Count    int                  `json:"count"`
+	Share    float64              `json:"share"`
+	Products []ProductTotalReport `json:"products"`
+}
+
+type ProductTotalReport struct {
+	Id            string  `json:"id"`
+	Name          string  `json:"name"`
+	Total         float64 `json:"total"`
+	Count         int     `json:"count"`
+	Average       float64 `json:"average"`
+	Min           float64 `json:"min"`
+	Max           float64 `json:"max"`
+	CategoryShare float64 `json:"category_share"`
+	Share         float64 `json:"share"`
+}
+
 type UpsertExpenseRequest struct {
 	Data []Expense `json:"data"`
 }
@@ -0,0 +1,14 @@
+package models
+
+// ImportMapping describes the csv files of the imports. Columns maps a field,
+// like date or amount, to its header in the file, the field name itself by
+// default.
+type ImportMapping struct {
+	Columns          map[string]string `json:"columns"`
+	Delimiter        string            `json:"delimiter"`
+	DateFormat       string            `json:"date_format"`
+	DecimalSeparator string            `json:"decimal_separator"`
+	Currency         string            `json:"currency"`
+	ProductId        string            `json:"product_id"`
+	AccountId        string            `json:"account_id"`
+}
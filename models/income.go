@@ -10,15 +10,18 @@ type IncomeList struct {
 }
 
 type Income struct {
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Id          string    `json:"id"`
-	UserId      string    `json:"user_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Date        string    `json:"date"`
-	Currency    string    `json:"currency"`
-	Amount      float64   `json:"amount"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Id              string    `json:"id"`
+	UserId          string    `json:"user_id"`
+	AccountId       string    `json:"account_id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Date            string    `json:"date"`
+	Currency        string    `json:"currency"`
+	Amount          float64   `json:"amount"`
+	ConvertedAmount *float64  `json:"converted_amount,omitempty"`
+	Tags            []string  `json:"tags"`
 }
 
 type IncomeFilter struct {
@@ -27,13 +30,15 @@ type IncomeFilter struct {
 	Income    `json:"income"`
 	MinAmount float64 `json:"min_amount"`
 	MaxAmount float64 `json:"max_amount"`
+	TagsMatch string  `json:"tags_match"`
 }
 
 type UpsertIncomeRequest struct {
 	Data []Income `json:"data"`
 }
 
+// IncomeReport is keyed by currency code
 type IncomeReport struct {
-	TotalIdr float64 `json:"total_idr"`
-	TotalUsd float64 `json:"total_usd"`
+	Totals    map[string]float64 `json:"totals"`
+	Converted *ConvertedReport   `json:"converted,omitempty"`
 }
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+type RecurringTransactionList struct {
+	RecurringTransactions []RecurringTransaction `json:"recurring_transactions"`
+	Page                  int                    `json:"page"`
+	Limit                 int                    `json:"limit"`
+	Total                 int32                  `json:"total"`
+}
+
+// RecurringTransaction repeats every Interval Frequency from StartDate until
+// EndDate or Count occurrences. EXPENSE uses ProductId, INCOME uses Name and
+// Description. Generated is the number of occurrences already materialised.
+type RecurringTransaction struct {
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Id          string    `json:"id"`
+	UserId      string    `json:"user_id"`
+	Type        string    `json:"type"`
+	ProductId   string    `json:"product_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Currency    string    `json:"currency"`
+	Amount      float64   `json:"amount"`
+	Frequency   string    `json:"frequency"`
+	Interval    int       `json:"interval"`
+	StartDate   string    `json:"start_date"`
+	EndDate     string    `json:"end_date"`
+	Count       int       `json:"count"`
+	Generated   int       `json:"generated"`
+	NextDate    string    `json:"next_date"`
+}
+
+type UpsertRecurringTransactionRequest struct {
+	Data []RecurringTransaction `json:"data"`
+}
+
+type TransactionType string
+
+const (
+	ExpenseTransaction TransactionType = "EXPENSE"
+	IncomeTransaction  TransactionType = "INCOME"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
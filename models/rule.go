@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type CategorisationRuleList struct {
+	Rules []CategorisationRule `json:"rules"`
+	Page  int                  `json:"page"`
+	Limit int                  `json:"limit"`
+	Total int32                `json:"total"`
+}
+
+// CategorisationRule gives its product to the expenses saved without one
+// when all its set conditions match. The rules of a user are tried by
+// ascending priority.
+type CategorisationRule struct {
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Id            string    `json:"id"`
+	UserId        string    `json:"user_id"`
+	ProductId     string    `json:"product_id"`
+	ProductName   string    `json:"product_name"`
+	Priority      int       `json:"priority"`
+	PayeeContains string    `json:"payee_contains"`
+	PayeeRegex    string    `json:"payee_regex"`
+	MinAmount     *float64  `json:"min_amount"`
+	MaxAmount     *float64  `json:"max_amount"`
+	Currency      string    `json:"currency"`
+}
+
+type UpsertCategorisationRuleRequest struct {
+	Data []CategorisationRule `json:"data"`
+}
+
+// RuleMatch tells which rule gave its product to the row of a batch
+type RuleMatch struct {
+	Row    int    `json:"row"`
+	RuleId string `json:"rule_id"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device, the tokens stay server side
+type Session struct {
+	Id           string    `json:"id"`
+	UserAgent    string    `json:"user_agent"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	Current      bool      `json:"current"`
+	Token        string    `json:"-"`
+	RefreshToken string    `json:"-"`
+}
+
+type SessionList struct {
+	Sessions []Session `json:"sessions"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// StatementTransaction is a transaction of a bank statement, debits have a
+// negative amount. ExternalRef is the bank id of the transaction, or a hash
+// of it when the bank gives none.
+type StatementTransaction struct {
+	ExternalRef string  `json:"external_ref"`
+	Date        string  `json:"date"`
+	Amount      float64 `json:"amount"`
+	Payee       string  `json:"payee"`
+	Memo        string  `json:"memo"`
+}
@@ -0,0 +1,17 @@
+package models
+
+type TagsMatch string
+
+const (
+	// AnyTags matches the rows having at least one of the tags
+	AnyTags TagsMatch = "any"
+	// AllTags matches the rows having every tag
+	AllTags TagsMatch = "all"
+)
+
+// TagReport is keyed by currency code, a row with several tags counts in
+// each of them
+type TagReport struct {
+	Reports   map[string][]CategoryTotalReport `json:"reports"`
+	Converted *ConvertedReport                 `json:"converted,omitempty"`
+}
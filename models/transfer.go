@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+type TransferList struct {
+	Transfers []Transfer `json:"transfers"`
+	Page      int        `json:"page"`
+	Limit     int        `json:"limit"`
+	Total     int32      `json:"total"`
+}
+
+// Transfer moves Amount, in the currency of the source account, to another
+// account. Rate converts it into the destination currency when they differ,
+// without it the exchange rate of the date is used.
+type Transfer struct {
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Id            string    `json:"id"`
+	UserId        string    `json:"user_id"`
+	FromAccountId string    `json:"from_account_id"`
+	ToAccountId   string    `json:"to_account_id"`
+	Date          string    `json:"date"`
+	Description   string    `json:"description"`
+	Currency      string    `json:"currency"`
+	Amount        float64   `json:"amount"`
+	Rate          *float64  `json:"rate"`
+	ToCurrency    string    `json:"to_currency"`
+	ToAmount      *float64  `json:"to_amount"`
+}
+
+type TransferFilter struct {
+	AccountId string `json:"account_id"`
+	MinDate   string `json:"min_date"`
+	MaxDate   string `json:"max_date"`
+	Transfer  `json:"transfer"`
+}
+
+type UpsertTransferRequest struct {
+	Data []Transfer `json:"data"`
+}
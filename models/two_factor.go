@@ -0,0 +1,27 @@
+package models
+
+type TwoFactorEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorCode is a TOTP code or, where a login takes it, a recovery code
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorChallenge answers the password of a user with two-factor enabled,
+// the token is exchanged for a session along with a code
+type TwoFactorChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+type TwoFactorLogin struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
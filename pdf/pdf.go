@@ -0,0 +1,209 @@
+// Package pdf writes simple text documents, the printable reports, as PDF.
+// It only knows the Helvetica fonts every reader has, so nothing is embedded,
+// and text outside of the WinAnsi encoding is shown as "?".
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Font is one of the standard fonts a document can write with
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = map[Font]string{
+	Helvetica:     "Helvetica",
+	HelveticaBold: "Helvetica-Bold",
+}
+
+// Document is built page by page, the coordinates are in points from the top
+// left corner of the page
+type Document struct {
+	pages []*bytes.Buffer
+	font  Font
+	size  float64
+}
+
+func New() *Document {
+	return &Document{font: Helvetica, size: 10}
+}
+
+// AddPage starts a new page, the next drawings go on it
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount is the number of pages added so far
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+func (d *Document) SetFont(font Font, size float64) {
+	d.font = font
+	d.size = size
+}
+
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	return d.pages[len(d.pages)-1]
+}
+
+// Text writes s with its baseline at y, starting at x
+func (d *Document) Text(x, y float64, s string) {
+	fmt.Fprintf(d.page(), "BT /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		d.font+1, number(d.size), number(x), number(PageHeight-y), escape(s))
+}
+
+// TextRight writes s ending at x, for the amount columns
+func (d *Document) TextRight(x, y float64, s string) {
+	d.Text(x-d.TextWidth(s), y, s)
+}
+
+// TextWidth is the width of s in the current font
+func (d *Document) TextWidth(s string) float64 {
+	var width int
+	for _, b := range encode(s) {
+		width += glyphWidth(d.font, b)
+	}
+
+	return float64(width) * d.size / 1000
+}
+
+// Truncate shortens s with "..." so that it is not wider than width
+func (d *Document) Truncate(s string, width float64) string {
+	if d.TextWidth(s) <= width {
+		return s
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 && d.TextWidth(string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes) + "..."
+}
+
+// Line draws a thin line between the two points
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %s %s m %s %s l S\n",
+		number(x1), number(PageHeight-y1), number(x2), number(PageHeight-y2))
+}
+
+// Write writes the document, a document without pages gets an empty one
+func (d *Document) Write(w io.Writer) error {
+	d.page()
+
+	out := &bytes.Buffer{}
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 pages, 3 and 4 the fonts, then a page and its content
+	// for each page
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	for _, font := range []Font{Helvetica, HelveticaBold} {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", fontNames[font]))
+	}
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			number(PageWidth), number(PageHeight), 6+2*i))
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return err
+		}
+
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// number writes coordinates with 2 decimals at most
+func number(f float64) string {
+	s := strings.TrimRight(fmt.Sprintf("%.2f", f), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// encode maps s to WinAnsi, the characters it does not have become "?"
+func encode(s string) []byte {
+	encoded := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '€':
+			encoded = append(encoded, 0x80)
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+
+	return encoded
+}
+
+// escape encodes s as the content of a string literal
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range encode(s) {
+		switch c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c >= 0x80 {
+				fmt.Fprintf(&b, "\\%03o", c)
+				continue
+			}
+
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
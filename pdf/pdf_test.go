@@ -0,0 +1,84 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestWrite(t *testing.T) {
+	doc := New()
+	doc.SetFont(HelveticaBold, 14)
+	doc.Text(40, 50, "Statement (March)")
+	doc.AddPage()
+	doc.SetFont(Helvetica, 10)
+	doc.TextRight(555, 60, "Rp 1.500")
+	doc.Line(40, 70, 555, 70)
+
+	var out bytes.Buffer
+	err := doc.Write(&out)
+	assert.Equal(t, nil, err)
+
+	data := out.Bytes()
+	assert.Equal(t, true, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	assert.Equal(t, true, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	assert.Equal(t, true, bytes.Contains(data, []byte("/Kids [5 0 R 7 0 R] /Count 2")))
+
+	// the xref points at each object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	assert.Equal(t, true, bytes.HasPrefix(data[xref:], []byte("xref\n0 9\n")))
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	assert.Equal(t, 8, len(entries))
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		assert.Equal(t, true, bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))))
+	}
+
+	// the contents are deflated
+	streams := regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1)
+	assert.Equal(t, 2, len(streams))
+
+	var contents []string
+	for _, stream := range streams {
+		zr, err := zlib.NewReader(bytes.NewReader(stream[1]))
+		assert.Equal(t, nil, err)
+
+		content, err := ioutil.ReadAll(zr)
+		assert.Equal(t, nil, err)
+		contents = append(contents, string(content))
+	}
+
+	assert.Equal(t, "BT /F2 14 Tf 40 791.89 Td (Statement \\(March\\)) Tj ET\n", contents[0])
+	assert.Equal(t, "BT /F1 10 Tf 514.42 781.89 Td (Rp 1.500) Tj ET\n0.5 w 40 771.89 m 555 771.89 l S\n", contents[1])
+}
+
+func TestText(t *testing.T) {
+	doc := New()
+
+	// "Hello" is 722 + 556 + 222 + 222 + 556 thousandths
+	assert.Equal(t, 22.78, doc.TextWidth("Hello"))
+
+	doc.SetFont(HelveticaBold, 20)
+	assert.Equal(t, 48.9, doc.TextWidth("Hello"))
+
+	doc.SetFont(Helvetica, 10)
+	assert.Equal(t, "Hello", doc.Truncate("Hello", 30))
+	assert.Equal(t, "He...", doc.Truncate("Hello world", 22))
+
+	// WinAnsi keeps the latin letters and the euro, the rest is unknown
+	assert.Equal(t, "Caf\\351 \\200 ? \\\\", escape("Café € ✓ \\"))
+
+	for _, font := range []Font{Helvetica, HelveticaBold} {
+		for c := byte(0x20); c < 0x7f; c++ {
+			assert.Equal(t, true, glyphWidth(font, c) > 0)
+		}
+	}
+}
@@ -15,7 +15,7 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func Route() *gin.Engine {
+func Route() (*gin.Engine, *controllers.API) {
 	router := gin.Default()
 	router.Use(CORS())
 	api := controllers.NewAPI()
@@ -40,8 +40,11 @@ func Route() *gin.Engine {
 	}
 
 	router.POST("/api/login", api.Authenticate)
+	// the second step of the login with two-factor enabled
+	router.POST("/api/login/2fa", api.LoginTwoFactor)
 	router.GET("/api/check-session", middlewares.Auth(api.Redis), api.CheckSession)
-	router.GET("/api/refresh-session", middlewares.Auth(api.Redis), api.RefreshSession)
+	// the access token may have expired, the refresh token is all it takes
+	router.POST("/api/refresh-session", api.RefreshSession)
 	router.GET("/api/logout", middlewares.Auth(api.Redis), api.Logout)
 	router.POST("/api/forgot-password", api.ForgotPassword)
 	router.GET("/api/verify-token/:token", api.VerifyTokenReset)
@@ -50,12 +53,46 @@ func Route() *gin.Engine {
 	router.GET("/api/profile", middlewares.Auth(api.Redis), api.GetUser)
 	router.POST("/api/profile", middlewares.Auth(api.Redis), api.UpdateUser)
 
+	sessions := router.Group("/api/sessions")
+	sessions.Use(middlewares.Auth(api.Redis))
+	{
+		sessions.GET("", api.GetSessions)
+		// log out everywhere
+		sessions.DELETE("", api.DeleteSessions)
+		sessions.DELETE("/:id", api.DeleteSession)
+	}
+
+	twoFactor := router.Group("/api/2fa")
+	twoFactor.Use(middlewares.Auth(api.Redis))
+	{
+		twoFactor.POST("/enrol", api.EnrolTwoFactor)
+		twoFactor.POST("/confirm", api.ConfirmTwoFactor)
+		twoFactor.DELETE("", api.DisableTwoFactor)
+	}
+
+	currencies := router.Group("/api/currencies")
+	currencies.Use(middlewares.Auth(api.Redis))
+	{
+		currencies.GET("", api.GetCurrencies)
+		// batch upsert, admin only
+		currencies.POST("", api.UpsertCurrencies)
+	}
+
+	exchangeRates := router.Group("/api/exchange-rates")
+	exchangeRates.Use(middlewares.Auth(api.Redis))
+	{
+		exchangeRates.GET("", api.GetExchangeRates)
+		// batch upsert, admin only
+		exchangeRates.POST("", api.UpsertExchangeRates)
+	}
+
 	product := router.Group("/api/products")
 	product.Use(middlewares.Auth(api.Redis))
 	{
 		product.GET("", api.GetProducts)
 		// batch upsert/delete
 		product.POST("", api.UpsertProducts)
+		product.POST("/import-excel", api.ImportExcelProducts)
 		product.DELETE("", api.DeleteProducts)
 	}
 
@@ -68,13 +105,45 @@ func Route() *gin.Engine {
 		categories.DELETE("", api.DeleteCategories)
 	}
 
+	accounts := router.Group("/api/accounts")
+	accounts.Use(middlewares.Auth(api.Redis))
+	{
+		accounts.GET("", api.GetAccounts)
+		accounts.GET("/balances", api.GetAccountsBalances)
+		// batch upsert/delete
+		accounts.POST("", api.UpsertAccounts)
+		accounts.POST("/:id/import", api.ImportStatement)
+		accounts.DELETE("", api.DeleteAccounts)
+	}
+
+	rules := router.Group("/api/rules")
+	rules.Use(middlewares.Auth(api.Redis))
+	{
+		rules.GET("", api.GetRules)
+		// batch upsert/delete
+		rules.POST("", api.UpsertRules)
+		rules.DELETE("", api.DeleteRules)
+	}
+
+	transfers := router.Group("/api/transfers")
+	transfers.Use(middlewares.Auth(api.Redis))
+	{
+		transfers.GET("", api.GetTransfers)
+		// batch upsert/delete
+		transfers.POST("", api.UpsertTransfers)
+		transfers.DELETE("", api.DeleteTransfers)
+	}
+
 	expenses := router.Group("/api/expenses")
 	expenses.Use(middlewares.Auth(api.Redis))
 	{
 		expenses.GET("", api.GetExpenses)
 		expenses.GET("/report", api.GetExpensesReport)
+		expenses.GET("/report/products", api.GetExpensesProductsReport)
 		// batch upsert/delete
 		expenses.POST("", api.UpsertExpenses)
+		expenses.POST("/import", api.ImportExpenses)
+		expenses.POST("/import-excel", api.ImportExcelExpenses)
 		expenses.DELETE("", api.DeleteExpenses)
 	}
 
@@ -85,9 +154,40 @@ func Route() *gin.Engine {
 		incomes.GET("/report", api.GetIncomesReport)
 		// batch upsert/delete
 		incomes.POST("", api.UpsertIncomes)
+		incomes.POST("/import", api.ImportIncomes)
+		incomes.POST("/import-excel", api.ImportExcelIncomes)
 		incomes.DELETE("", api.DeleteIncomes)
 	}
-	return router
+
+	recurringTransactions := router.Group("/api/recurring-transactions")
+	recurringTransactions.Use(middlewares.Auth(api.Redis))
+	{
+		recurringTransactions.GET("", api.GetRecurringTransactions)
+		// batch upsert/delete
+		recurringTransactions.POST("", api.UpsertRecurringTransactions)
+		recurringTransactions.DELETE("", api.DeleteRecurringTransactions)
+	}
+
+	reports := router.Group("/api/reports")
+	reports.Use(middlewares.Auth(api.Redis))
+	{
+		reports.GET("/tags", api.GetTagsReport)
+		reports.GET("/workbook", api.GetWorkbookReport)
+		reports.GET("/statement.pdf", api.GetStatementReport)
+		reports.GET("/cashflow", api.GetCashflowReport)
+	}
+
+	budgets := router.Group("/api/budgets")
+	budgets.Use(middlewares.Auth(api.Redis))
+	{
+		budgets.GET("", api.GetBudgets)
+		budgets.GET("/status", api.GetBudgetsStatus)
+		budgets.POST("/close", api.CloseBudgets)
+		// batch upsert/delete
+		budgets.POST("", api.UpsertBudgets)
+		budgets.DELETE("", api.DeleteBudgets)
+	}
+	return router, api
 }
 
 // CORS Cross Origin Resource Sharing
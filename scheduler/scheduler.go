@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// Scheduler runs a job in its own goroutine, once on Start and then every
+// interval until Stop
+type Scheduler struct {
+	interval time.Duration
+	job      func(now time.Time)
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func New(interval time.Duration, job func(now time.Time)) *Scheduler {
+	return &Scheduler{
+		interval: interval,
+		job:      job,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) Start() {
+	go s.run()
+}
+
+// Stop waits for a running job to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.job(time.Now())
+
+	for {
+		select {
+		case <-s.stop:
+			log.Println("scheduler stopped")
+			return
+		case now := <-ticker.C:
+			s.job(now)
+		}
+	}
+}
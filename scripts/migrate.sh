@@ -1,7 +1,8 @@
 #!/bin/sh
 
 echo "DB str: $DB_CONNECTION_STRING_MIGRATE"
-for file in `find $1 | grep -i '.sql' | sort -n`
+# sort on the numeric prefix of the file name, so 10_x runs after 9_x
+for file in `find $1 | grep -i '.sql' | awk -F/ '{print $NF"\t"$0}' | sort -n | cut -f2`
 do
   echo "Applying $file"
   docker exec -ti ${COMPONENT}_database_1 psql -f $file $DB_CONNECTION_STRING_MIGRATE
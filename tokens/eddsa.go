@@ -0,0 +1,58 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA signs with Ed25519, jwt-go does not have it
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+var errEdDSAVerification = errors.New("eddsa: verification error")
+
+type signingMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify takes the public key, the private key verifies too
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	var public ed25519.PublicKey
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		public = k
+	case ed25519.PrivateKey:
+		public = k.Public().(ed25519.PublicKey)
+	default:
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if len(public) != ed25519.PublicKeySize || !ed25519.Verify(public, []byte(signingString), sig) {
+		return errEdDSAVerification
+	}
+
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok || len(private) != ed25519.PrivateKeySize {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
@@ -0,0 +1,162 @@
+// Package tokens signs and verifies the access tokens of the stateless auth
+// mode. The keys come from JWT_KEYS, a comma separated list of
+// kid:alg:base64 entries where alg is HS256 with a secret, or EdDSA with a
+// 64 bytes private key or a 32 bytes public key that only verifies. Every key
+// of the ring verifies, JWT_SIGNING_KEY names the one signing, the first one
+// able to by default. Rotating is adding the new key, signing with it, then
+// dropping the old one once its tokens expired.
+package tokens
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Stateless tells whether AUTH_MODE=stateless, the access tokens are then
+// verified by their signature and redis only keeps the revoked sessions
+func Stateless() bool {
+	return strings.ToLower(os.Getenv("AUTH_MODE")) == "stateless"
+}
+
+// AccessKey and RefreshKey keep the two kinds of tokens apart in redis, the
+// auth middleware only takes access tokens and a refresh only refresh tokens
+func AccessKey(token string) string {
+	return "access:" + token
+}
+
+func RefreshKey(token string) string {
+	return "refresh:" + token
+}
+
+// RefreshTTL is how long a refresh token, and so a session, lives. The CSRF
+// cookie of the web app lasts as long.
+const RefreshTTL = 7 * 24 * time.Hour
+
+// DenylistKey marks a revoked session until its last access token expired
+func DenylistKey(sessionId string) string {
+	return "denylist:" + sessionId
+}
+
+type key struct {
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// Keyring holds the keys by kid
+type Keyring struct {
+	keys    map[string]key
+	signing string
+}
+
+// LoadKeyring reads JWT_KEYS and JWT_SIGNING_KEY
+func LoadKeyring() (*Keyring, error) {
+	return ParseKeyring(os.Getenv("JWT_KEYS"), os.Getenv("JWT_SIGNING_KEY"))
+}
+
+func ParseKeyring(keys, signing string) (*Keyring, error) {
+	ring := &Keyring{keys: map[string]key{}, signing: signing}
+
+	for _, entry := range strings.Split(keys, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid-jwt-key(kid:alg:base64)")
+		}
+
+		kid, alg := parts[0], parts[1]
+		if _, ok := ring.keys[kid]; ok {
+			return nil, fmt.Errorf("duplicate-jwt-key(%s)", kid)
+		}
+
+		material, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid-jwt-key(%s)", kid)
+		}
+
+		var k key
+		switch {
+		case alg == jwt.SigningMethodHS256.Alg() && len(material) > 0:
+			k = key{method: jwt.SigningMethodHS256, sign: material, verify: material}
+		case alg == SigningMethodEdDSA.Alg() && len(material) == ed25519.PrivateKeySize:
+			private := ed25519.PrivateKey(material)
+			k = key{method: SigningMethodEdDSA, sign: private, verify: private.Public()}
+		case alg == SigningMethodEdDSA.Alg() && len(material) == ed25519.PublicKeySize:
+			k = key{method: SigningMethodEdDSA, verify: ed25519.PublicKey(material)}
+		default:
+			return nil, fmt.Errorf("invalid-jwt-key(%s)", kid)
+		}
+
+		ring.keys[kid] = k
+
+		if ring.signing == "" && k.sign != nil {
+			ring.signing = kid
+		}
+	}
+
+	if k, ok := ring.keys[ring.signing]; !ok || k.sign == nil {
+		return nil, errors.New("missing-jwt-signing-key")
+	}
+
+	return ring, nil
+}
+
+// Sign sets iat and exp on the claims and signs them with the signing key,
+// its kid goes in the header
+func (r *Keyring) Sign(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	k := r.keys[r.signing]
+
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = r.signing
+
+	return token.SignedString(k.sign)
+}
+
+// Verify checks the signature with the key named by the kid, the algorithm
+// must be the key's, and requires the token not to be expired
+func (r *Keyring) Verify(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		k, ok := r.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown-kid")
+		}
+
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, errors.New("unexpected-alg")
+		}
+
+		return k.verify, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid-token")
+	}
+
+	// Valid only checks exp and iat when they are there
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) || !claims.VerifyIssuedAt(now, true) {
+		return nil, errors.New("invalid-token")
+	}
+
+	return claims, nil
+}
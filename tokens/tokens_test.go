@@ -0,0 +1,141 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"gotest.tools/assert"
+)
+
+func TestParseKeyring(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte("secret"))
+	public, private, _ := ed25519.GenerateKey(nil)
+
+	// no keys
+	_, err := ParseKeyring("", "")
+	assert.Equal(t, "missing-jwt-signing-key", err.Error())
+
+	// malformed entry
+	_, err = ParseKeyring("k1:HS256", "")
+	assert.Equal(t, "invalid-jwt-key(kid:alg:base64)", err.Error())
+
+	// not base64
+	_, err = ParseKeyring("k1:HS256:***", "")
+	assert.Equal(t, "invalid-jwt-key(k1)", err.Error())
+
+	// unknown alg
+	_, err = ParseKeyring("k1:RS256:"+secret, "")
+	assert.Equal(t, "invalid-jwt-key(k1)", err.Error())
+
+	// eddsa key of the wrong size
+	_, err = ParseKeyring("k1:EdDSA:"+secret, "")
+	assert.Equal(t, "invalid-jwt-key(k1)", err.Error())
+
+	// duplicate kid
+	_, err = ParseKeyring("k1:HS256:"+secret+",k1:HS256:"+secret, "")
+	assert.Equal(t, "duplicate-jwt-key(k1)", err.Error())
+
+	// only a public key, nothing signs
+	_, err = ParseKeyring("k1:EdDSA:"+base64.StdEncoding.EncodeToString(public), "")
+	assert.Equal(t, "missing-jwt-signing-key", err.Error())
+
+	// the signing key is not in the ring
+	_, err = ParseKeyring("k1:HS256:"+secret, "k2")
+	assert.Equal(t, "missing-jwt-signing-key", err.Error())
+
+	// the first key able to sign signs by default
+	ring, err := ParseKeyring("k1:EdDSA:"+base64.StdEncoding.EncodeToString(public)+
+		", k2:EdDSA:"+base64.StdEncoding.EncodeToString(private)+",k3:HS256:"+secret, "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "k2", ring.signing)
+}
+
+func TestSignVerify(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte("secret"))
+	public, private, _ := ed25519.GenerateKey(nil)
+	eddsa := "k2:EdDSA:" + base64.StdEncoding.EncodeToString(private)
+
+	// HS256
+	ring, err := ParseKeyring("k1:HS256:"+secret, "")
+	assert.Equal(t, nil, err)
+
+	token, err := ring.Sign(jwt.MapClaims{"sid": "test-session"}, time.Minute)
+	assert.Equal(t, nil, err)
+
+	claims, err := ring.Verify(token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "test-session", claims["sid"])
+
+	old := token
+
+	// EdDSA, the HS256 key is still verifying while it rotates out
+	ring, err = ParseKeyring("k1:HS256:"+secret+","+eddsa, "k2")
+	assert.Equal(t, nil, err)
+
+	token, err = ring.Sign(jwt.MapClaims{"sid": "test-session"}, time.Minute)
+	assert.Equal(t, nil, err)
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "EdDSA", parsed.Header["alg"])
+	assert.Equal(t, "k2", parsed.Header["kid"])
+
+	_, err = ring.Verify(token)
+	assert.Equal(t, nil, err)
+
+	_, err = ring.Verify(old)
+	assert.Equal(t, nil, err)
+
+	// the HS256 key dropped
+	ring, err = ParseKeyring(eddsa, "")
+	assert.Equal(t, nil, err)
+
+	_, err = ring.Verify(old)
+	assert.Equal(t, true, err != nil)
+
+	// a verify-only public key
+	verifier, err := ParseKeyring("k2:EdDSA:"+base64.StdEncoding.EncodeToString(public)+",k1:HS256:"+secret, "k1")
+	assert.Equal(t, nil, err)
+
+	_, err = verifier.Verify(token)
+	assert.Equal(t, nil, err)
+
+	// another key under the same kid
+	_, other, _ := ed25519.GenerateKey(nil)
+	forged, err := ParseKeyring("k2:EdDSA:"+base64.StdEncoding.EncodeToString(other), "")
+	assert.Equal(t, nil, err)
+
+	token, err = forged.Sign(jwt.MapClaims{"sid": "test-session"}, time.Minute)
+	assert.Equal(t, nil, err)
+
+	_, err = ring.Verify(token)
+	assert.Equal(t, true, err != nil)
+
+	// an alg not the key's
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sid": "test-session",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix()})
+	hs.Header["kid"] = "k2"
+	token, _ = hs.SignedString([]byte("secret"))
+
+	_, err = ring.Verify(token)
+	assert.Equal(t, true, err != nil)
+
+	// expired
+	token, err = ring.Sign(jwt.MapClaims{"sid": "test-session"}, -time.Minute)
+	assert.Equal(t, nil, err)
+
+	_, err = ring.Verify(token)
+	assert.Equal(t, true, err != nil)
+
+	// without exp
+	noExp := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"sid": "test-session", "iat": time.Now().Unix()})
+	noExp.Header["kid"] = "k2"
+	token, err = noExp.SignedString(private)
+	assert.Equal(t, nil, err)
+
+	_, err = ring.Verify(token)
+	assert.Equal(t, "invalid-token", err.Error())
+}
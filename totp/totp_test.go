@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestCode(t *testing.T) {
+	// the SHA1 vectors of RFC 6238, cut to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	for unix, expected := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := Code(secret, Step(time.Unix(unix, 0)))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, expected, code)
+	}
+
+	// not base32
+	_, err := Code("not-base32!", 1)
+	assert.Equal(t, true, err != nil)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 32, len(secret))
+
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	code, _ := Code(secret, step)
+	got, ok := Validate(secret, code, now)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, step, got)
+
+	// a step late
+	code, _ = Code(secret, step-1)
+	got, ok = Validate(secret, code, now)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, step-1, got)
+
+	// too old
+	code, _ = Code(secret, step-2)
+	_, ok = Validate(secret, code, now)
+	assert.Equal(t, false, ok)
+
+	// malformed
+	_, ok = Validate(secret, "12345", now)
+	assert.Equal(t, false, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Budgeting", "test@gmail.com", "JBSWY3DPEHPK3PXP"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Budgeting:test@gmail.com", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "Budgeting", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+}